@@ -0,0 +1,115 @@
+package api
+
+import (
+	"backend/core"
+	"backend/enrich"
+	"errors"
+	"net/http"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+)
+
+func registerAdminRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	group := router.Group("/admin", authMiddleware, adminMiddleware)
+
+	group.GET("/breakers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"breakers": core.BreakerStates()})
+	})
+
+	group.DELETE("/breakers/:host", func(c *gin.Context) {
+		if !core.ResetBreaker(c.Param("host")) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No breaker for host"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Breaker reset"})
+	})
+
+	group.GET("/rpc", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pools": enrich.Default().PoolStates()})
+	})
+
+	group.POST("/rpc/:chain/probe", func(c *gin.Context) {
+		pool, ok := enrich.Default().Pool(c.Param("chain"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No rpc pool for chain"})
+			return
+		}
+		pool.Probe(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"pool": pool.State()})
+	})
+
+	group.GET("/cache", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"caches": core.GetCacheStats()})
+	})
+
+	group.GET("/cache/:name", func(c *gin.Context) {
+		var filter core.CacheFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		entries, err := core.ListCacheEntries(c.Param("name"), filter)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries, "total": len(entries)})
+	})
+
+	group.GET("/cache/:name/entry", func(c *gin.Context) {
+		key := c.Query("key")
+		if key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+			return
+		}
+		value, ok, err := core.GetCacheEntry(c.Param("name"), key)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"key": key, "value": value})
+	})
+
+	group.DELETE("/cache/:name", func(c *gin.Context) {
+		var filter core.CacheFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		purged, err := core.PurgeCache(c.Param("name"), filter)
+		switch {
+		case errors.Is(err, core.ErrUnknownCache):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Cache purged", "purged": purged})
+	})
+}
+
+// requireAdmin only lets through users whose verified token carries the
+// "admin" custom claim. It must run after requireAuth.
+func requireAdmin(isProduction bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isProduction {
+			c.Next()
+			return
+		}
+
+		value, _ := c.Get(idTokenKey)
+		idToken, ok := value.(*auth.Token)
+		if !ok || idToken.Claims["admin"] != true {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"backend/core"
+	"backend/history"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The history holds the scrapes of every user, so it is reserved to admins
+func registerHistoryRoutes(router gin.IRouter, store history.Store, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	group := router.Group("/history", authMiddleware, adminMiddleware)
+
+	group.GET("/runs", func(c *gin.Context) {
+		filter, ok := bindHistoryFilter(c)
+		if !ok {
+			return
+		}
+		runs, err := store.Runs(c.Request.Context(), filter)
+		if err != nil {
+			log.Printf("Error querying history runs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": runs})
+	})
+
+	group.GET("/runs/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+			return
+		}
+		run, err := store.GetRun(c.Request.Context(), id)
+		if errors.Is(err, history.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error querying history run %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"run": run})
+	})
+
+	group.GET("/findings", func(c *gin.Context) {
+		filter, ok := bindHistoryFilter(c)
+		if !ok {
+			return
+		}
+		findings, err := store.Findings(c.Request.Context(), filter)
+		if err != nil {
+			log.Printf("Error querying history findings: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"findings": findings})
+	})
+
+	group.GET("/sightings", func(c *gin.Context) {
+		filter, ok := bindHistoryFilter(c)
+		if !ok {
+			return
+		}
+		sightings, err := store.Sightings(c.Request.Context(), filter)
+		if err != nil {
+			log.Printf("Error querying history sightings: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sightings": sightings})
+	})
+}
+
+func registerAddressRoutes(router gin.IRouter, store history.Store, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	router.GET("/addresses/:address", authMiddleware, adminMiddleware, func(c *gin.Context) {
+		limit := 0
+		if value := c.Query("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+		}
+		report, err := history.LookupAddress(c.Request.Context(), store, c.Param("address"), limit)
+		if errors.Is(err, core.ErrInvalidAddress) || errors.Is(err, core.ErrInvalidChecksum) || errors.Is(err, history.ErrInvalidLimit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up address %s: %v", c.Param("address"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query history"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+}
+
+// bindHistoryFilter writes a 400 response and returns false if the query parameters are unusable
+func bindHistoryFilter(c *gin.Context) (history.Filter, bool) {
+	var filter history.Filter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query, from and to must be RFC 3339 timestamps"})
+		return filter, false
+	}
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return filter, false
+	}
+	return filter, true
+}
+
+// recordRun saves the result of a scrape to store, if history is kept
+func recordRun(store history.Store, source string, startedAt time.Time, result core.ScrapeResult) {
+	if store == nil {
+		return
+	}
+	// The request may already be gone, the run is still worth keeping
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := store.SaveRun(ctx, history.NewRun(source, startedAt, time.Now(), result)); err != nil {
+		log.Printf("Error saving %s run to history: %v", source, err)
+	}
+}
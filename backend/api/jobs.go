@@ -0,0 +1,97 @@
+package api
+
+import (
+	"backend/core"
+	"backend/jobs"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func registerJobRoutes(router gin.IRouter, manager *jobs.Manager, checks lookalikes, authMiddleware gin.HandlerFunc) {
+	group := router.Group("/jobs", authMiddleware)
+
+	group.POST("", func(c *gin.Context) {
+		var request TargetsRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request",
+			})
+			return
+		}
+
+		if !validateTargets(c, request.Targets) {
+			return
+		}
+		trusted, ok := normalizeTrusted(c, request.Trusted)
+		if !ok || !validateEnrich(c, request.Enrich) {
+			return
+		}
+
+		job, err := manager.Submit(request.Targets, checks.options(core.Options{Fresh: request.Fresh, Enrich: request.Enrich, EnrichImplementations: request.EnrichImplementations, ENS: request.ENS}, trusted))
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Job queued",
+			"job":     job,
+		})
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		job, err := manager.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	})
+
+	group.GET("/:id/results", func(c *gin.Context) {
+		var query core.Query
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request",
+			})
+			return
+		}
+		if err := query.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, result, err := manager.Results(c.Param("id"))
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, jobs.ErrNotFinished):
+			c.JSON(http.StatusAccepted, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+		default:
+			response := queryResults(result.Results, query)
+			response["job"] = job
+			response["report"] = result.Report
+			c.JSON(http.StatusOK, response)
+		}
+	})
+
+	group.DELETE("/:id", func(c *gin.Context) {
+		job, err := manager.Cancel(c.Param("id"))
+		switch {
+		case errors.Is(err, jobs.ErrFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+			return
+		case err != nil:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Job cancelled",
+			"job":     job,
+		})
+	})
+}
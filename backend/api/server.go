@@ -2,6 +2,11 @@ package api
 
 import (
 	"backend/core"
+	"backend/enrich"
+	"backend/history"
+	"backend/jobs"
+	"backend/watch"
+	"backend/webhook"
 	"context"
 	"log"
 	"net/http"
@@ -18,6 +23,60 @@ import (
 
 type TargetsRequest struct {
 	Targets []string `json:"targets" binding:"required"`
+	// Fresh bypasses the target and script caches
+	Fresh bool `json:"fresh"`
+	// Trusted addresses, on top of those of TRUSTED_ADDRESSES_FILE, that
+	// results are compared with to flag lookalikes
+	Trusted []string `json:"trusted"`
+	// Enrich lists the chains results are classified on, e.g. ["ethereum", "polygon"]
+	Enrich []string `json:"enrich"`
+	// EnrichImplementations classifies the implementation of proxies as well
+	EnrichImplementations bool `json:"enrich_implementations"`
+	// ENS resolves the .eth names found on pages and looks up the primary
+	// ENS name of the results
+	ENS bool `json:"ens"`
+	// Sorting, filtering and pagination options applied to the results
+	core.Query
+}
+
+// lookalikes is what scrapes compare their results with to flag lookalikes:
+// the trusted addresses of the server and the history of each target
+type lookalikes struct {
+	trusted []string
+	store   history.Store
+}
+
+// options returns opts extended with the lookalike checks, requested being
+// the already normalized trusted addresses of the request
+func (l lookalikes) options(opts core.Options, requested []string) core.Options {
+	opts.Trusted = append(append([]string(nil), l.trusted...), requested...)
+	if l.store != nil {
+		opts.KnownAddresses = history.KnownAddresses(l.store)
+	}
+	return opts
+}
+
+// normalizeTrusted writes a 400 response and returns false if an address is invalid
+func normalizeTrusted(c *gin.Context, addresses []string) ([]string, bool) {
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		address, err := core.NormalizeAddress(address)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid trusted address: " + err.Error()})
+			return nil, false
+		}
+		normalized = append(normalized, address)
+	}
+	return normalized, true
+}
+
+// validateEnrich writes a 400 response and returns false if a chain is not supported
+func validateEnrich(c *gin.Context, chains []string) bool {
+	if err := enrich.ValidateChains(chains); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid enrich: " + err.Error()})
+		return false
+	}
+	return true
 }
 
 // Add this struct and map at the package level
@@ -32,6 +91,20 @@ var (
 )
 
 func RunServer() {
+	if err := core.ConfigureCacheFromEnv(); err != nil {
+		log.Fatalf("error configuring cache: %v\n", err)
+	}
+	historyStore, err := history.OpenFromEnv()
+	if err != nil {
+		log.Fatalf("error opening history: %v\n", err)
+	}
+	checks := lookalikes{store: historyStore}
+	if path := os.Getenv("TRUSTED_ADDRESSES_FILE"); path != "" {
+		if checks.trusted, err = core.LoadTrustedAddresses(path); err != nil {
+			log.Fatalf("error loading trusted addresses: %v\n", err)
+		}
+	}
+
 	router := gin.Default()
 
 	// Add CORS middleware
@@ -86,47 +159,35 @@ func RunServer() {
 		})
 	})
 
-	router.POST("/scrape", func(c *gin.Context) {
+	authMiddleware := requireAuth(isProduction, auth)
+	adminMiddleware := requireAdmin(isProduction)
+	jobManager := jobs.NewManager(4, 100, 10*time.Minute)
+	jobManager.OnFinished = func(snapshot jobs.Snapshot, result core.ScrapeResult) {
+		recordRun(historyStore, history.SourceJob, *snapshot.StartedAt, result)
+	}
+
+	registerJobRoutes(router, jobManager, checks, authMiddleware)
+	registerStreamRoutes(router, historyStore, checks, authMiddleware)
+	if historyStore != nil {
+		registerHistoryRoutes(router, historyStore, authMiddleware, adminMiddleware)
+		registerAddressRoutes(router, historyStore, authMiddleware, adminMiddleware)
+
+		dispatcher := webhook.NewDispatcher(historyStore)
+		scheduler := watch.NewScheduler(historyStore)
+		scheduler.Trusted = checks.trusted
+		scheduler.OnDiff = dispatcher.Notify
+		scheduler.Start(context.Background(), time.Minute)
+		registerWatchRoutes(router, historyStore, scheduler, authMiddleware, adminMiddleware)
+		registerWebhookRoutes(router, historyStore, dispatcher, authMiddleware, adminMiddleware)
+	}
+	registerAdminRoutes(router, authMiddleware, adminMiddleware)
+
+	router.POST("/scrape", authMiddleware, func(c *gin.Context) {
 		var request TargetsRequest
 		// Create a context with a 30-second timeout
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 		defer cancel()
 
-		// Check for authorization headers if in production
-		if isProduction {
-			authHeader := c.GetHeader("Authorization")
-			if authHeader == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": "Authorization header required",
-				})
-				return
-			}
-
-			// If Authorization headers is not starting with "Bearer ", return 401
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": "Authorization header must be a Bearer Token",
-				})
-				return
-			}
-
-			// strip "Bearer " from the beginning of the string
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-
-			// Verify the token
-			_, err := auth.VerifyIDToken(ctx, token)
-			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-				return
-			}
-
-			// Apply rate limiting
-			if !allowRequest(token) {
-				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
-				return
-			}
-		}
-
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid request",
@@ -134,52 +195,46 @@ func RunServer() {
 			return
 		}
 
-		if len(request.Targets) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Targets array must have at least one URL",
-			})
+		if !validateTargets(c, request.Targets) {
 			return
 		}
 
-		for _, target := range request.Targets {
-			if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "All targets must start with 'http://' or 'https://'",
-				})
-				return
-			}
+		if err := request.Query.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		trusted, ok := normalizeTrusted(c, request.Trusted)
+		if !ok || !validateEnrich(c, request.Enrich) {
+			return
 		}
 
-		// Create a channel to receive the scraping results
-		resultsChan := make(chan []core.AddressInfo)
-		errChan := make(chan error)
+		// Scraping stops at the deadline and returns what was gathered so far
+		startedAt := time.Now()
+		result := core.ScrapeContext(ctx, request.Targets, checks.options(core.Options{Fresh: request.Fresh, Enrich: request.Enrich, EnrichImplementations: request.EnrichImplementations, ENS: request.ENS}, trusted))
+		recordRun(historyStore, history.SourceAPI, startedAt, result)
 
-		go func() {
-			results, err := core.Scrape(request.Targets)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			resultsChan <- results
-		}()
-
-		select {
-		case <-ctx.Done():
+		if result.Partial && len(result.Results) == 0 {
 			c.JSON(http.StatusRequestTimeout, gin.H{
-				"error": "Request timed out after 30 seconds",
+				"error":  "Request timed out after 30 seconds",
+				"report": result.Report,
 			})
 			return
-		case err := <-errChan:
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to scrape targets: " + err.Error(),
-			})
+		}
+		response := queryResults(result.Results, request.Query)
+		response["report"] = result.Report
+
+		if result.AllFailed() && !result.Partial {
+			response["error"] = "Failed to fetch data from all targets"
+			c.JSON(http.StatusBadGateway, response)
 			return
-		case results := <-resultsChan:
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Data fetched successfully",
-				"results": results,
-			})
 		}
+
+		response["message"] = "Data fetched successfully"
+		if result.Partial {
+			response["message"] = "Request timed out after 30 seconds, returning partial results"
+		}
+		response["partial"] = result.Partial
+		c.JSON(http.StatusOK, response)
 	})
 
 	go func() {
@@ -192,6 +247,103 @@ func RunServer() {
 	router.Run(":8080")
 }
 
+// idTokenKey is the gin context key of the verified Firebase ID token
+const idTokenKey = "idToken"
+
+// userID returns the UID of the verified Firebase ID token, empty when
+// authentication is disabled
+func userID(c *gin.Context) string {
+	value, _ := c.Get(idTokenKey)
+	if idToken, ok := value.(*auth.Token); ok {
+		return idToken.UID
+	}
+	return ""
+}
+
+// requireAuth verifies the Firebase ID token and applies rate limiting in production
+func requireAuth(isProduction bool, authClient *auth.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isProduction {
+			c.Next()
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authorization header required",
+			})
+			return
+		}
+
+		// If Authorization headers is not starting with "Bearer ", return 401
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authorization header must be a Bearer Token",
+			})
+			return
+		}
+
+		// strip "Bearer " from the beginning of the string
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+
+		// Verify the token
+		idToken, err := authClient.VerifyIDToken(c.Request.Context(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		c.Set(idTokenKey, idToken)
+
+		// Apply rate limiting
+		if !allowRequest(token) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// queryResults applies an already validated query to results and returns the
+// response fields describing the selected page, flat or grouped
+func queryResults(results []core.AddressInfo, query core.Query) gin.H {
+	if query.Shape == core.ShapeGrouped {
+		page, _ := core.ApplyGroupedQuery(results, query)
+		return gin.H{
+			"results":     page.Results,
+			"total":       page.Total,
+			"next_cursor": page.NextCursor,
+		}
+	}
+	page, _ := core.ApplyQuery(results, query)
+	return gin.H{
+		"results":     page.Results,
+		"total":       page.Total,
+		"next_cursor": page.NextCursor,
+	}
+}
+
+// validateTargets writes a 400 response and returns false if targets is unusable
+func validateTargets(c *gin.Context, targets []string) bool {
+	if len(targets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Targets array must have at least one URL",
+		})
+		return false
+	}
+
+	for _, target := range targets {
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "All targets must start with 'http://' or 'https://'",
+			})
+			return false
+		}
+	}
+	return true
+}
+
 func allowRequest(token string) bool {
 	limitersMutex.Lock()
 	defer limitersMutex.Unlock()
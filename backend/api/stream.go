@@ -0,0 +1,70 @@
+package api
+
+import (
+	"backend/core"
+	"backend/history"
+	"context"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func registerStreamRoutes(router gin.IRouter, store history.Store, checks lookalikes, authMiddleware gin.HandlerFunc) {
+	// GET /scrape/stream?targets=...&targets=... emits Server-Sent Events as the
+	// scrape progresses and a final "done" event with the full result
+	router.GET("/scrape/stream", authMiddleware, func(c *gin.Context) {
+		targets := c.QueryArray("targets")
+		if !validateTargets(c, targets) {
+			return
+		}
+		trusted, ok := normalizeTrusted(c, c.QueryArray("trusted"))
+		chains := c.QueryArray("enrich")
+		if !ok || !validateEnrich(c, chains) {
+			return
+		}
+		// The context is not read from the scrape goroutine
+		fresh := c.Query("fresh") == "true"
+		enrichImplementations := c.Query("enrich_implementations") == "true"
+		ens := c.Query("ens") == "true"
+
+		// Closing the connection cancels the scrape
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+
+		events := make(chan core.Event, 64)
+		done := make(chan core.ScrapeResult, 1)
+
+		go func() {
+			defer close(events)
+			startedAt := time.Now()
+			result := core.ScrapeContext(ctx, targets, checks.options(core.Options{
+				Fresh:                 fresh,
+				Enrich:                chains,
+				EnrichImplementations: enrichImplementations,
+				ENS:                   ens,
+				Observer: func(event core.Event) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+					}
+				},
+			}, trusted))
+			recordRun(store, history.SourceStream, startedAt, result)
+			done <- result
+		}()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Stream(func(w io.Writer) bool {
+			event, ok := <-events
+			if !ok {
+				result := <-done
+				c.SSEvent("done", result)
+				return false
+			}
+			c.SSEvent(string(event.Type), event)
+			return true
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"backend/history"
+	"backend/watch"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WatchlistRequest creates a watchlist
+type WatchlistRequest struct {
+	Name            string   `json:"name"`
+	Targets         []string `json:"targets" binding:"required"`
+	IntervalSeconds int      `json:"interval_seconds" binding:"required"`
+}
+
+// Watchlists are re-scraped by the server for as long as they exist, so they
+// are reserved to admins
+func registerWatchRoutes(router gin.IRouter, store history.Store, scheduler *watch.Scheduler, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	group := router.Group("/watchlists", authMiddleware, adminMiddleware)
+
+	group.POST("", func(c *gin.Context) {
+		var request WatchlistRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		watchlist := &history.Watchlist{Name: request.Name, Targets: request.Targets, IntervalSeconds: request.IntervalSeconds, Owner: userID(c)}
+		if err := watchlist.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_, err := store.CreateWatchlist(c.Request.Context(), watchlist)
+		if errors.Is(err, history.ErrTooManyWatchlists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating watchlist: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watchlist"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"watchlist": watchlist})
+	})
+
+	group.GET("", func(c *gin.Context) {
+		watchlists, err := store.Watchlists(c.Request.Context())
+		if err != nil {
+			log.Printf("Error listing watchlists: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list watchlists"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"watchlists": watchlists})
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		id, ok := watchlistID(c)
+		if !ok {
+			return
+		}
+		watchlist, err := store.GetWatchlist(c.Request.Context(), id)
+		if !watchlistFound(c, id, err) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"watchlist": watchlist})
+	})
+
+	group.DELETE("/:id", func(c *gin.Context) {
+		id, ok := watchlistID(c)
+		if !ok {
+			return
+		}
+		if !watchlistFound(c, id, store.DeleteWatchlist(c.Request.Context(), id)) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Watchlist deleted"})
+	})
+
+	group.POST("/:id/run", func(c *gin.Context) {
+		id, ok := watchlistID(c)
+		if !ok {
+			return
+		}
+		// The run is stored even if the client goes away
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		diff, err := scheduler.Run(ctx, id)
+		if errors.Is(err, watch.ErrAlreadyRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if !watchlistFound(c, id, err) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"diff": diff})
+	})
+
+	group.GET("/:id/diffs", func(c *gin.Context) {
+		id, ok := watchlistID(c)
+		if !ok {
+			return
+		}
+		var filter history.DiffFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query, from and to must be RFC 3339 timestamps"})
+			return
+		}
+		if err := filter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := store.GetWatchlist(c.Request.Context(), id); !watchlistFound(c, id, err) {
+			return
+		}
+		diffs, err := store.Diffs(c.Request.Context(), id, filter)
+		if err != nil {
+			log.Printf("Error querying diffs of watchlist %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query diffs"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"diffs": diffs})
+	})
+}
+
+// watchlistID writes a 400 response and returns false if the ID is not a number
+func watchlistID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid watchlist ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// watchlistFound writes a 404 or 500 response and returns false if err is not nil
+func watchlistFound(c *gin.Context, id int64, err error) bool {
+	if errors.Is(err, history.ErrWatchlistNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		log.Printf("Error accessing watchlist %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access watchlist"})
+		return false
+	}
+	return true
+}
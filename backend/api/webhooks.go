@@ -0,0 +1,157 @@
+package api
+
+import (
+	"backend/history"
+	"backend/webhook"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRequest creates a webhook. A secret is generated when none is given.
+type WebhookRequest struct {
+	URL              string   `json:"url" binding:"required"`
+	Secret           string   `json:"secret"`
+	Events           []string `json:"events"`
+	WatchlistID      int64    `json:"watchlist_id"`
+	FailureThreshold int      `json:"failure_threshold"`
+}
+
+// Webhooks can be subscribed to the diffs of any watchlist and make the
+// server POST to any URL, so they are reserved to admins
+func registerWebhookRoutes(router gin.IRouter, store history.Store, dispatcher *webhook.Dispatcher, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	group := router.Group("/webhooks", authMiddleware, adminMiddleware)
+
+	group.POST("", func(c *gin.Context) {
+		var request WebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		hook := &history.Webhook{
+			URL:              request.URL,
+			Secret:           request.Secret,
+			Events:           request.Events,
+			WatchlistID:      request.WatchlistID,
+			FailureThreshold: request.FailureThreshold,
+		}
+		if hook.Secret == "" {
+			secret := make([]byte, 32)
+			rand.Read(secret)
+			hook.Secret = hex.EncodeToString(secret)
+		}
+		if err := hook.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if hook.WatchlistID != 0 {
+			if _, err := store.GetWatchlist(c.Request.Context(), hook.WatchlistID); !watchlistFound(c, hook.WatchlistID, err) {
+				return
+			}
+		}
+		if _, err := store.CreateWebhook(c.Request.Context(), hook); err != nil {
+			log.Printf("Error creating webhook: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		// The secret is only ever returned here
+		c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": hook.Secret})
+	})
+
+	group.GET("", func(c *gin.Context) {
+		webhooks, err := store.Webhooks(c.Request.Context())
+		if err != nil {
+			log.Printf("Error listing webhooks: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		hook, ok := lookupWebhook(c, store)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhook": hook})
+	})
+
+	group.DELETE("/:id", func(c *gin.Context) {
+		hook, ok := lookupWebhook(c, store)
+		if !ok {
+			return
+		}
+		if err := store.DeleteWebhook(c.Request.Context(), hook.ID); err != nil && !errors.Is(err, history.ErrWebhookNotFound) {
+			log.Printf("Error deleting webhook %d: %v", hook.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	})
+
+	group.GET("/:id/deliveries", func(c *gin.Context) {
+		hook, ok := lookupWebhook(c, store)
+		if !ok {
+			return
+		}
+		filter := history.Filter{}
+		if value := c.Query("limit"); value != "" {
+			var err error
+			if filter.Limit, err = strconv.Atoi(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+		}
+		if err := filter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		deliveries, err := store.Deliveries(c.Request.Context(), hook.ID, filter.Limit)
+		if err != nil {
+			log.Printf("Error querying deliveries of webhook %d: %v", hook.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query deliveries"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	})
+
+	// Sends a ping event once, to check that the receiver is reachable and verifies signatures
+	group.POST("/:id/ping", func(c *gin.Context) {
+		hook, ok := lookupWebhook(c, store)
+		if !ok {
+			return
+		}
+		delivery, err := dispatcher.Ping(c.Request.Context(), *hook)
+		if delivery == nil {
+			log.Printf("Error pinging webhook %d: %v", hook.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ping webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"delivery": delivery})
+	})
+}
+
+// lookupWebhook writes a 400, 404 or 500 response and returns false if the webhook can't be loaded
+func lookupWebhook(c *gin.Context, store history.Store) (*history.Webhook, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+	hook, err := store.GetWebhook(c.Request.Context(), id)
+	if errors.Is(err, history.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading webhook %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load webhook"})
+		return nil, false
+	}
+	return hook, true
+}
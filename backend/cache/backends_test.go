@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type record struct {
+	Name  string
+	Count int
+}
+
+type inspectableCache interface {
+	Cache[string, record]
+	Inspector[string]
+}
+
+// Function to exercise the behaviour every Cache implementation shares
+func testCacheContract(t *testing.T, c inspectableCache) {
+	t.Helper()
+
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected missing key to not exist in cache")
+	}
+
+	c.Set("key1", record{Name: "one", Count: 1})
+	c.Set("key2", record{Name: "two", Count: 2})
+	value, ok := c.Get("key1")
+	if !ok || value != (record{Name: "one", Count: 1}) {
+		t.Errorf("Expected key1 to round-trip, got %+v (%v)", value, ok)
+	}
+
+	entries := c.Entries()
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 entries, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Size <= 0 {
+			t.Errorf("Expected %s to have a size", entry.Key)
+		}
+		if entry.ExpiresAt.IsZero() || time.Until(entry.ExpiresAt) > time.Minute || entry.StoredAt.After(time.Now()) {
+			t.Errorf("Unexpected timestamps for %+v", entry)
+		}
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+
+	if !c.Delete("key1") {
+		t.Error("Expected key1 to be deleted")
+	}
+	if _, ok := c.Get("key1"); ok {
+		t.Error("Expected key1 to be gone after delete")
+	}
+
+	c.Purge()
+	if _, ok := c.Get("key2"); ok {
+		t.Error("Expected key2 to be gone after purge")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCacheContract(t, NewWeightedMemory[string, record](10, 1000, time.Minute, func(record) int64 { return 1 }))
+}
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := OpenDiskDB(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c, err := NewDisk[record](db, "records", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testCacheContract(t, c)
+
+	// Values survive reopening the file
+	c.Set("persistent", record{Name: "kept"})
+	db.Close()
+	db, err = OpenDiskDB(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	c, _ = NewDisk[record](db, "records", time.Minute)
+	if value, ok := c.Get("persistent"); !ok || value.Name != "kept" {
+		t.Errorf("Expected value to survive a restart, got %+v (%v)", value, ok)
+	}
+
+	now := time.Now()
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, ok := c.Get("persistent"); ok {
+		t.Error("Expected value to expire")
+	}
+	c.now = time.Now
+	c.Set("expiring", record{})
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if removed := c.RemoveExpired(); removed != 1 {
+		t.Errorf("Expected 1 expired item to be removed, got %d", removed)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	server := startFakeRedis(t)
+
+	c := NewRedis[record](server.addr, "test:", time.Minute)
+	if err := c.Ping(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testCacheContract(t, c)
+
+	c.Set("key3", record{Name: "three"})
+	other := NewRedis[record](server.addr, "other:", time.Minute)
+	other.Set("key3", record{Name: "other"})
+	c.Purge()
+	if _, ok := other.Get("key3"); !ok {
+		t.Error("Expected purge to leave keys of other prefixes alone")
+	}
+	if ttl := server.ttl("test:key3"); ttl != 0 {
+		t.Errorf("Expected purged key to be gone, got ttl %v", ttl)
+	}
+	if ttl := server.ttl("other:key3"); ttl != time.Minute {
+		t.Errorf("Expected key to be set with a TTL of 1m, got %v", ttl)
+	}
+}
+
+// fakeRedis is an in-process stand-in for a Redis server that understands the
+// handful of commands the Redis cache uses
+type fakeRedis struct {
+	addr   string
+	mutex  sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{
+		addr:   listener.Addr().String(),
+		values: make(map[string]string),
+		ttls:   make(map[string]time.Duration),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRedis) ttl(key string) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ttls[key]
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		conn.Write([]byte(s.handle(args)))
+	}
+}
+
+func (s *fakeRedis) handle(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "SET":
+		s.values[args[1]] = args[2]
+		delete(s.ttls, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.ttls[args[1]] = time.Duration(ms) * time.Millisecond
+		}
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				delete(s.values, key)
+				delete(s.ttls, key)
+				deleted++
+			}
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	case "STRLEN":
+		return ":" + strconv.Itoa(len(s.values[args[1]])) + "\r\n"
+	case "PTTL":
+		if _, ok := s.values[args[1]]; !ok {
+			return ":-2\r\n"
+		}
+		ttl, ok := s.ttls[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return ":" + strconv.FormatInt(ttl.Milliseconds(), 10) + "\r\n"
+	case "SCAN":
+		prefix := strings.TrimSuffix(args[3], "*")
+		var keys []string
+		for key := range s.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		reply := "*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			reply += "$" + strconv.Itoa(len(key)) + "\r\n" + key + "\r\n"
+		}
+		return reply
+	}
+	return "-ERR unknown command\r\n"
+}
@@ -1,47 +1,248 @@
 package cache
 
 import (
-	"math/rand"
+	"container/list"
 	"sync"
+	"time"
 )
 
-type FixedSizeCache struct {
-	items        map[string]interface{}
-	keys         []string
-	mutex        sync.RWMutex
+// Cache is implemented by every cache backend: in memory, on disk and Redis
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	// Delete removes key and reports whether it was present
+	Delete(key K) bool
+	// Purge removes every item
+	Purge()
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	weight    int64
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// Memory holds at most maxCacheSize items, evicting the least recently used
+// one when full. Items may also expire after a TTL, and a weighted cache
+// additionally keeps the total weight of its items within maxWeight.
+type Memory[K comparable, V any] struct {
+	items        map[K]*list.Element
+	order        *list.List
+	mutex        sync.Mutex
 	maxCacheSize int
+	ttl          time.Duration
+	now          func() time.Time
+	weigh        func(value V) int64
+	maxWeight    int64
+	weight       int64
+	counters     counters
 }
 
-func NewFixedSizeCache(maxCacheSize int) *FixedSizeCache {
-	return &FixedSizeCache{
-		items:        make(map[string]interface{}),
-		keys:         make([]string, 0, maxCacheSize),
+// NewMemory creates a cache whose items expire ttl after they were set. A ttl
+// of 0 means items never expire.
+func NewMemory[K comparable, V any](maxCacheSize int, ttl time.Duration) *Memory[K, V] {
+	return &Memory[K, V]{
+		items:        make(map[K]*list.Element),
+		order:        list.New(),
 		maxCacheSize: maxCacheSize,
+		ttl:          ttl,
+		now:          time.Now,
+	}
+}
+
+// NewWeightedMemory creates a cache that evicts least recently used items until
+// the sum of weigh(value) over all items fits in maxWeight, e.g. a byte budget
+func NewWeightedMemory[K comparable, V any](maxCacheSize int, maxWeight int64, ttl time.Duration, weigh func(value V) int64) *Memory[K, V] {
+	c := NewMemory[K, V](maxCacheSize, ttl)
+	c.weigh = weigh
+	c.maxWeight = maxWeight
+	return c
+}
+
+func (c *Memory[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores value under key, overriding the default TTL of the cache
+func (c *Memory[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+	var weight int64
+	if c.weigh != nil {
+		weight = c.weigh(value)
+	}
+
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+	}
+	if c.weigh != nil && weight > c.maxWeight {
+		// The value would never fit, don't flush the whole cache for it
+		return
+	}
+
+	for c.order.Len() > 0 && (c.order.Len() >= c.maxCacheSize || (c.weigh != nil && c.weight+weight > c.maxWeight)) {
+		// Evict the least recently used item
+		c.removeElement(c.order.Back())
+		c.counters.evictions.Add(1)
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, weight: weight, storedAt: now, expiresAt: expiresAt})
+	c.weight += weight
+}
+
+func (c *Memory[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var zero V
+	element, exists := c.items[key]
+	if !exists {
+		c.counters.lookup(false)
+		return zero, false
+	}
+	e := element.Value.(*entry[K, V])
+	if c.expired(e) {
+		c.removeElement(element)
+		c.counters.expirations.Add(1)
+		c.counters.lookup(false)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	c.counters.lookup(true)
+	return e.value, true
+}
+
+func (c *Memory[K, V]) Delete(key K) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.items[key]
+	if exists {
+		c.removeElement(element)
+	}
+	return exists
+}
+
+func (c *Memory[K, V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.weight = 0
+}
+
+func (c *Memory[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+// Weight returns the total weight of the items in a weighted cache
+func (c *Memory[K, V]) Weight() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.weight
+}
+
+// RemoveExpired drops every expired item and returns how many were removed
+func (c *Memory[K, V]) RemoveExpired() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for element := c.order.Back(); element != nil; {
+		prev := element.Prev()
+		if c.expired(element.Value.(*entry[K, V])) {
+			c.removeElement(element)
+			removed++
+		}
+		element = prev
 	}
+	c.counters.expirations.Add(int64(removed))
+	return removed
 }
 
-func (c *FixedSizeCache) Set(key string, value interface{}) {
+func (c *Memory[K, V]) Stats() Stats {
+	return c.counters.stats()
+}
+
+// Entries lists the items from most to least recently used. Their size is
+// their weight, or 0 in an unweighted cache.
+func (c *Memory[K, V]) Entries() []EntryInfo[K] {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if _, exists := c.items[key]; !exists {
-		if len(c.keys) >= c.maxCacheSize {
-			// Evict a random item
-			evictIndex := rand.Intn(len(c.keys))
-			evictKey := c.keys[evictIndex]
-			delete(c.items, evictKey)
-			c.keys[evictIndex] = c.keys[len(c.keys)-1]
-			c.keys = c.keys[:len(c.keys)-1]
+	entries := make([]EntryInfo[K], 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		e := element.Value.(*entry[K, V])
+		if c.expired(e) {
+			continue
 		}
-		c.keys = append(c.keys, key)
+		entries = append(entries, EntryInfo[K]{Key: e.key, StoredAt: e.storedAt, ExpiresAt: e.expiresAt, Size: e.weight})
 	}
-	c.items[key] = value
+	return entries
+}
+
+// StartJanitor removes expired items every interval in the background until
+// the returned stop function is called
+func (c *Memory[K, V]) StartJanitor(interval time.Duration) (stop func()) {
+	return startJanitor(interval, c.RemoveExpired)
+}
+
+func (c *Memory[K, V]) expired(e *entry[K, V]) bool {
+	return !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt)
+}
+
+func (c *Memory[K, V]) removeElement(element *list.Element) {
+	e := element.Value.(*entry[K, V])
+	c.order.Remove(element)
+	delete(c.items, e.key)
+	c.weight -= e.weight
 }
 
-func (c *FixedSizeCache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+func startJanitor(interval time.Duration, removeExpired func() int) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				removeExpired()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// FixedSizeCache is an untyped Memory cache keyed by strings
+type FixedSizeCache struct {
+	*Memory[string, interface{}]
+}
+
+func NewFixedSizeCache(maxCacheSize int) *FixedSizeCache {
+	return NewFixedSizeCacheWithTTL(maxCacheSize, 0)
+}
+
+func NewFixedSizeCacheWithTTL(maxCacheSize int, ttl time.Duration) *FixedSizeCache {
+	return &FixedSizeCache{NewMemory[string, interface{}](maxCacheSize, ttl)}
+}
 
-	value, exists := c.items[key]
-	return value, exists
+func NewWeightedCache(maxCacheSize int, maxWeight int64, ttl time.Duration, weigh func(value interface{}) int64) *FixedSizeCache {
+	return &FixedSizeCache{NewWeightedMemory[string, interface{}](maxCacheSize, maxWeight, ttl, weigh)}
 }
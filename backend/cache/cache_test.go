@@ -2,6 +2,7 @@ package cache
 
 import (
 	"testing"
+	"time"
 )
 
 func TestNewFixedSizeCache(t *testing.T) {
@@ -83,3 +84,130 @@ func TestOverwrite(t *testing.T) {
 		t.Errorf("Expected 3 items in cache, got %d", len(cache.items))
 	}
 }
+
+func TestLRUEviction(t *testing.T) {
+	cache := NewFixedSizeCache(3)
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key3", "value3")
+
+	// Touch key1 so key2 becomes the least recently used item
+	cache.Get("key1")
+	cache.Set("key4", "value4")
+
+	if _, exists := cache.Get("key2"); exists {
+		t.Error("Expected key2 to be evicted")
+	}
+	for _, key := range []string{"key1", "key3", "key4"} {
+		if _, exists := cache.Get(key); !exists {
+			t.Errorf("Expected %s to exist in cache", key)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	now := time.Now()
+	cache := NewFixedSizeCacheWithTTL(3, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key1", "value1")
+	cache.SetWithTTL("key2", "value2", time.Hour)
+	cache.SetWithTTL("key3", "value3", 0)
+
+	now = now.Add(2 * time.Minute)
+
+	if _, exists := cache.Get("key1"); exists {
+		t.Error("Expected key1 to have expired")
+	}
+	if len(cache.items) != 2 {
+		t.Errorf("Expected expired key1 to be removed lazily, got %d items", len(cache.items))
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	if removed := cache.RemoveExpired(); removed != 1 {
+		t.Errorf("Expected 1 expired item to be removed, got %d", removed)
+	}
+	if _, exists := cache.Get("key3"); !exists {
+		t.Error("Expected key3 without TTL to never expire")
+	}
+	if stats := cache.Stats(); stats.Expirations != 2 || stats.Evictions != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	cache := NewFixedSizeCacheWithTTL(3, time.Millisecond)
+	cache.Set("key1", "value1")
+
+	stop := cache.StartJanitor(5 * time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for cache.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cache.Len() != 0 {
+		t.Error("Expected janitor to remove expired item")
+	}
+}
+
+func TestDeleteAndPurge(t *testing.T) {
+	cache := NewFixedSizeCache(3)
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+
+	if !cache.Delete("key1") {
+		t.Error("Expected key1 to be deleted")
+	}
+	if cache.Delete("key1") {
+		t.Error("Expected second delete of key1 to report a miss")
+	}
+
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("Expected empty cache after purge, got %d items", cache.Len())
+	}
+	cache.Set("key3", "value3")
+	if _, exists := cache.Get("key3"); !exists {
+		t.Error("Expected cache to be usable after purge")
+	}
+}
+
+func TestWeightedEviction(t *testing.T) {
+	cache := NewWeightedCache(10, 10, 0, func(value interface{}) int64 {
+		return int64(len(value.(string)))
+	})
+
+	cache.Set("key1", "aaaa")
+	cache.Set("key2", "bbbb")
+	if cache.Weight() != 8 {
+		t.Errorf("Expected weight of 8, got %d", cache.Weight())
+	}
+
+	cache.Set("key3", "cccc")
+	if _, exists := cache.Get("key1"); exists {
+		t.Error("Expected key1 to be evicted to stay within the weight budget")
+	}
+	if cache.Weight() != 8 {
+		t.Errorf("Expected weight of 8, got %d", cache.Weight())
+	}
+
+	cache.Set("key2", "bb")
+	if cache.Weight() != 6 {
+		t.Errorf("Expected overwrite to update the weight to 6, got %d", cache.Weight())
+	}
+
+	cache.Set("huge", "this value is larger than the whole budget")
+	if _, exists := cache.Get("huge"); exists {
+		t.Error("Expected value larger than the budget not to be cached")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected oversized value not to evict anything, got %d items", cache.Len())
+	}
+}
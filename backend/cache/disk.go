@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// diskRecord is the JSON document stored for every key
+type diskRecord[V any] struct {
+	Value     V         `json:"value"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Disk stores JSON encoded values in one bucket of a bbolt file, so they
+// survive restarts. Several Disk caches may share the same database.
+type Disk[V any] struct {
+	db       *bolt.DB
+	bucket   []byte
+	ttl      time.Duration
+	now      func() time.Time
+	counters counters
+}
+
+// OpenDiskDB opens or creates the bbolt file at path
+func OpenDiskDB(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+}
+
+// NewDisk creates a cache stored in bucket of db whose items expire ttl after
+// they were set. A ttl of 0 means items never expire.
+func NewDisk[V any](db *bolt.DB, bucket string, ttl time.Duration) (*Disk[V], error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Disk[V]{db: db, bucket: []byte(bucket), ttl: ttl, now: time.Now}, nil
+}
+
+func (c *Disk[V]) Get(key string) (V, bool) {
+	var record diskRecord[V]
+	var found bool
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(c.bucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		log.Printf("Error reading %s from disk cache: %v", key, err)
+		c.counters.lookup(false)
+		return record.Value, false
+	}
+	if !found {
+		c.counters.lookup(false)
+		return record.Value, false
+	}
+	if c.expired(record.ExpiresAt) {
+		c.Delete(key)
+		c.counters.expirations.Add(1)
+		c.counters.lookup(false)
+		var zero V
+		return zero, false
+	}
+	c.counters.lookup(true)
+	return record.Value, true
+}
+
+func (c *Disk[V]) Set(key string, value V) {
+	record := diskRecord[V]{Value: value, StoredAt: c.now()}
+	if c.ttl > 0 {
+		record.ExpiresAt = record.StoredAt.Add(c.ttl)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Error encoding %s for disk cache: %v", key, err)
+		return
+	}
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).Put([]byte(key), data)
+	})
+	if err != nil {
+		log.Printf("Error writing %s to disk cache: %v", key, err)
+	}
+}
+
+func (c *Disk[V]) Delete(key string) bool {
+	var existed bool
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(c.bucket)
+		existed = bucket.Get([]byte(key)) != nil
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		log.Printf("Error deleting %s from disk cache: %v", key, err)
+	}
+	return existed
+}
+
+func (c *Disk[V]) Purge() {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(c.bucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(c.bucket)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error purging disk cache: %v", err)
+	}
+}
+
+// RemoveExpired drops every expired item and returns how many were removed
+func (c *Disk[V]) RemoveExpired() int {
+	removed := 0
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(c.bucket)
+		var expiredKeys [][]byte
+		err := bucket.ForEach(func(key, data []byte) error {
+			var record struct {
+				ExpiresAt time.Time `json:"expires_at"`
+			}
+			if err := json.Unmarshal(data, &record); err != nil || c.expired(record.ExpiresAt) {
+				expiredKeys = append(expiredKeys, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expiredKeys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		removed = len(expiredKeys)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error removing expired items from disk cache: %v", err)
+	}
+	c.counters.expirations.Add(int64(removed))
+	return removed
+}
+
+func (c *Disk[V]) Stats() Stats {
+	return c.counters.stats()
+}
+
+// Entries lists the items in key order, sized by their encoded length
+func (c *Disk[V]) Entries() []EntryInfo[string] {
+	var entries []EntryInfo[string]
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).ForEach(func(key, data []byte) error {
+			var record struct {
+				StoredAt  time.Time `json:"stored_at"`
+				ExpiresAt time.Time `json:"expires_at"`
+			}
+			if err := json.Unmarshal(data, &record); err != nil || c.expired(record.ExpiresAt) {
+				return nil
+			}
+			entries = append(entries, EntryInfo[string]{
+				Key:       string(key),
+				StoredAt:  record.StoredAt,
+				ExpiresAt: record.ExpiresAt,
+				Size:      int64(len(data)),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("Error listing disk cache: %v", err)
+	}
+	return entries
+}
+
+// StartJanitor removes expired items every interval in the background until
+// the returned stop function is called
+func (c *Disk[V]) StartJanitor(interval time.Duration) (stop func()) {
+	return startJanitor(interval, c.RemoveExpired)
+}
+
+func (c *Disk[V]) expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !c.now().Before(expiresAt)
+}
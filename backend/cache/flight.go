@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+type Origin string
+
+const (
+	// Loaded means the caller ran the load itself
+	Loaded Origin = "loaded"
+	// Shared means the caller joined a load already in flight for the same key
+	Shared Origin = "shared"
+	// Cached means the value was served from the cache
+	Cached Origin = "cached"
+)
+
+type call[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelCauseFunc
+}
+
+// Flight coalesces concurrent calls for the same key into one. The shared
+// call keeps running while at least one caller is still waiting for it.
+type Flight[V any] struct {
+	mutex sync.Mutex
+	calls map[string]*call[V]
+}
+
+// Do runs fn once for all concurrent callers of key and hands every caller
+// its value and error. When ctx is done the caller stops waiting; if it was
+// the last one, fn's context is cancelled with the same cause and whatever fn
+// returns is used.
+func (f *Flight[V]) Do(ctx context.Context, key string, fn func(ctx context.Context) (V, error)) (V, Origin, error) {
+	f.mutex.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*call[V])
+	}
+	c, shared := f.calls[key]
+	if shared {
+		c.waiters++
+	} else {
+		loadCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		f.calls[key] = c
+		go func() {
+			c.value, c.err = fn(loadCtx)
+			f.mutex.Lock()
+			delete(f.calls, key)
+			f.mutex.Unlock()
+			cancel(nil)
+			close(c.done)
+		}()
+	}
+	f.mutex.Unlock()
+
+	origin := Loaded
+	if shared {
+		origin = Shared
+	}
+
+	select {
+	case <-c.done:
+		return c.value, origin, c.err
+	case <-ctx.Done():
+	}
+
+	f.mutex.Lock()
+	c.waiters--
+	last := c.waiters == 0
+	if last {
+		// Pass on why the caller gave up, e.g. context.DeadlineExceeded
+		c.cancel(context.Cause(ctx))
+	}
+	f.mutex.Unlock()
+
+	if last {
+		<-c.done
+		return c.value, origin, c.err
+	}
+	var zero V
+	return zero, origin, ctx.Err()
+}
+
+// Loader reads through a Cache, coalescing concurrent loads of missing keys
+type Loader[V any] struct {
+	cache  Cache[string, V]
+	flight Flight[V]
+}
+
+func NewLoader[V any](cache Cache[string, V]) *Loader[V] {
+	return &Loader[V]{cache: cache}
+}
+
+func (l *Loader[V]) Cache() Cache[string, V] {
+	return l.cache
+}
+
+// Load returns the cached value of key or, on a miss or when fresh is set,
+// the value of load shared with every concurrent caller of the same key.
+// Values are only cached when load succeeds without being cancelled.
+func (l *Loader[V]) Load(ctx context.Context, key string, fresh bool, load func(ctx context.Context) (V, error)) (V, Origin, error) {
+	if !fresh {
+		if value, ok := l.cache.Get(key); ok {
+			return value, Cached, nil
+		}
+	}
+	return l.flight.Do(ctx, key, func(ctx context.Context) (V, error) {
+		value, err := load(ctx)
+		if err == nil && ctx.Err() == nil {
+			l.cache.Set(key, value)
+		}
+		return value, err
+	})
+}
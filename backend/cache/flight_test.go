@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoaderCoalescesConcurrentLoads(t *testing.T) {
+	loader := NewLoader[string](NewMemory[string, string](10, 0))
+	release := make(chan struct{})
+	var loads int32
+
+	load := func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	origins := make([]Origin, 5)
+	for i := range origins {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, origin, err := loader.Load(context.Background(), "key", false, load)
+			if err != nil || value != "value" {
+				t.Errorf("Unexpected result %q, %v", value, err)
+			}
+			origins[i] = origin
+		}(i)
+	}
+
+	// Give every caller the chance to join the flight before it lands
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Expected 1 load, got %d", loads)
+	}
+	shared := 0
+	for _, origin := range origins {
+		if origin == Shared {
+			shared++
+		}
+	}
+	if shared != 4 {
+		t.Errorf("Expected 4 callers to share the load, got %v", origins)
+	}
+
+	if _, origin, _ := loader.Load(context.Background(), "key", false, load); origin != Cached {
+		t.Errorf("Expected value to be cached, got %s", origin)
+	}
+}
+
+func TestLoaderSharesErrors(t *testing.T) {
+	loader := NewLoader[string](NewMemory[string, string](10, 0))
+	failure := errors.New("boom")
+
+	_, _, err := loader.Load(context.Background(), "key", false, func(ctx context.Context) (string, error) {
+		return "", failure
+	})
+	if err != failure {
+		t.Errorf("Expected load error, got %v", err)
+	}
+	if _, ok := loader.Cache().Get("key"); ok {
+		t.Error("Expected failed load not to be cached")
+	}
+}
+
+func TestFlightCancellation(t *testing.T) {
+	var flight Flight[string]
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "partial", ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+
+	results := make(chan string, 2)
+	go func() {
+		value, _, _ := flight.Do(first, "key", fn)
+		results <- "first:" + value
+	}()
+	<-started
+	go func() {
+		value, _, _ := flight.Do(second, "key", fn)
+		results <- "second:" + value
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The first caller leaves, the load keeps running for the second one
+	cancelFirst()
+	if result := <-results; result != "first:" {
+		t.Errorf("Expected first caller to give up without a value, got %q", result)
+	}
+
+	// The last caller leaving cancels the load and receives what it returned
+	cancelSecond()
+	if result := <-results; result != "second:partial" {
+		t.Errorf("Expected last caller to receive the partial value, got %q", result)
+	}
+}
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxRedisConns = 8
+
+// Redis stores JSON encoded values under prefix+key on any server that speaks
+// the Redis protocol, so replicas can share one cache. Expiry is left to the
+// server.
+type Redis[V any] struct {
+	addr     string
+	prefix   string
+	ttl      time.Duration
+	timeout  time.Duration
+	conns    chan *redisConn
+	counters counters
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis creates a cache on the server at addr. Connections are opened
+// lazily, use Ping to check the server is reachable.
+func NewRedis[V any](addr, prefix string, ttl time.Duration) *Redis[V] {
+	return &Redis[V]{
+		addr:    addr,
+		prefix:  prefix,
+		ttl:     ttl,
+		timeout: 2 * time.Second,
+		conns:   make(chan *redisConn, maxRedisConns),
+	}
+}
+
+func (c *Redis[V]) Ping() error {
+	_, err := c.do("PING")
+	return err
+}
+
+func (c *Redis[V]) Get(key string) (V, bool) {
+	var value V
+	reply, err := c.do("GET", c.prefix+key)
+	if err != nil {
+		log.Printf("Error reading %s from redis cache: %v", key, err)
+		c.counters.lookup(false)
+		return value, false
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		c.counters.lookup(false)
+		return value, false
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		log.Printf("Error decoding %s from redis cache: %v", key, err)
+		c.counters.lookup(false)
+		var zero V
+		return zero, false
+	}
+	c.counters.lookup(true)
+	return value, true
+}
+
+func (c *Redis[V]) Set(key string, value V) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Error encoding %s for redis cache: %v", key, err)
+		return
+	}
+	args := []string{"SET", c.prefix + key, string(data)}
+	if c.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	}
+	if _, err := c.do(args...); err != nil {
+		log.Printf("Error writing %s to redis cache: %v", key, err)
+	}
+}
+
+func (c *Redis[V]) Delete(key string) bool {
+	reply, err := c.do("DEL", c.prefix+key)
+	if err != nil {
+		log.Printf("Error deleting %s from redis cache: %v", key, err)
+		return false
+	}
+	deleted, _ := reply.(int64)
+	return deleted > 0
+}
+
+// Purge deletes every key under the prefix of this cache
+func (c *Redis[V]) Purge() {
+	err := c.scan(func(keys []string) error {
+		_, err := c.do(append([]string{"DEL"}, keys...)...)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error purging redis cache: %v", err)
+	}
+}
+
+// Stats counts the lookups of this process. Evictions and expirations
+// happen on the server and are not counted.
+func (c *Redis[V]) Stats() Stats {
+	return c.counters.stats()
+}
+
+// Entries lists the keys under the prefix of this cache, sized by the length
+// of their encoded value. StoredAt is derived from the remaining TTL.
+func (c *Redis[V]) Entries() []EntryInfo[string] {
+	var entries []EntryInfo[string]
+	now := time.Now()
+	err := c.scan(func(keys []string) error {
+		for _, key := range keys {
+			size, err := c.do("STRLEN", key)
+			if err != nil {
+				return err
+			}
+			remaining, err := c.do("PTTL", key)
+			if err != nil {
+				return err
+			}
+			info := EntryInfo[string]{Key: strings.TrimPrefix(key, c.prefix)}
+			info.Size, _ = size.(int64)
+			if ms, _ := remaining.(int64); ms >= 0 {
+				info.ExpiresAt = now.Add(time.Duration(ms) * time.Millisecond)
+				if c.ttl > 0 {
+					info.StoredAt = info.ExpiresAt.Add(-c.ttl)
+				}
+			} else if ms == -2 {
+				// Expired or deleted since the scan
+				continue
+			}
+			entries = append(entries, info)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error listing redis cache: %v", err)
+	}
+	return entries
+}
+
+// Function to call fn with every batch of keys under the prefix of this cache
+func (c *Redis[V]) scan(fn func(keys []string) error) error {
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "MATCH", c.prefix+"*", "COUNT", "100")
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		next, _ := parts[0].([]byte)
+		items, _ := parts[1].([]interface{})
+		var keys []string
+		for _, item := range items {
+			if b, ok := item.([]byte); ok {
+				keys = append(keys, string(b))
+			}
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Function to send one command and read its reply over a pooled connection
+func (c *Redis[V]) do(args ...string) (interface{}, error) {
+	conn, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.conn.SetDeadline(time.Now().Add(c.timeout))
+	reply, err := conn.roundTrip(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state, don't reuse it
+		conn.conn.Close()
+		return nil, err
+	}
+	c.putConn(conn)
+	return reply, err
+}
+
+func (c *Redis[V]) getConn() (*redisConn, error) {
+	select {
+	case conn := <-c.conns:
+		return conn, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *Redis[V]) putConn(conn *redisConn) {
+	select {
+	case c.conns <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (rc *redisConn) roundTrip(args []string) (interface{}, error) {
+	if _, err := rc.conn.Write(encodeRESP(args)); err != nil {
+		return nil, err
+	}
+	return readRESP(rc.reader)
+}
+
+func encodeRESP(args []string) []byte {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// readRESP reads one reply. Bulk strings are returned as []byte, nil bulk
+// strings and arrays as nil, integers as int64 and arrays as []interface{}.
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", kind)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts what happened to a cache since it was created
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Evictions are items dropped to make room for new ones
+	Evictions int64 `json:"evictions"`
+	// Expirations are items dropped because their TTL passed
+	Expirations int64 `json:"expirations"`
+}
+
+// EntryInfo describes one cached item without its value
+type EntryInfo[K comparable] struct {
+	Key K `json:"key"`
+	// StoredAt is zero when the backend doesn't know when the item was set
+	StoredAt time.Time `json:"stored_at"`
+	// ExpiresAt is zero for items that never expire
+	ExpiresAt time.Time `json:"expires_at"`
+	// Size is the weight of the item in memory or its encoded size in bytes
+	Size int64 `json:"size"`
+}
+
+// Inspector is implemented by caches that can describe their contents
+type Inspector[K comparable] interface {
+	Stats() Stats
+	// Entries lists every item that has not expired
+	Entries() []EntryInfo[K]
+}
+
+type counters struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+// Function to count a lookup as a hit or a miss
+func (c *counters) lookup(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
@@ -1,29 +1,193 @@
 package cli
 
 import (
+    "context"
     "encoding/json"
+    "flag"
     "fmt"
     "log"
     "os"
+    "os/signal"
+    "strings"
+    "time"
 
     "backend/core"
+    "backend/enrich"
+    "backend/history"
 )
 
 func RunCLI() {
-    if len(os.Args) < 2 {
-        log.Fatalf("Usage: go run scraper.go url1 url2 ...")
+    if len(os.Args) > 1 && os.Args[1] == "address" {
+        runAddress(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "watch" {
+        runWatch(os.Args[2:])
+        return
+    }
+
+    report := flag.Bool("report", false, "include the per-target scrape report in the output")
+    timeout := flag.Duration("timeout", 0, "stop scraping after this long and print partial results (e.g. 2m)")
+    var query core.Query
+    flag.StringVar(&query.Sort, "sort", "", "sort results by address, src, type or count")
+    flag.StringVar(&query.Order, "order", "", "sort order, asc or desc")
+    flag.StringVar(&query.Type, "type", "", "only keep results of this type (html or script)")
+    flag.StringVar(&query.Target, "target", "", "only keep results found on this target")
+    flag.StringVar(&query.SourceHost, "source-host", "", "only keep results whose source URL is on this host")
+    flag.StringVar(&query.Tag, "tag", "", "only keep results with this tag")
+    flag.IntVar(&query.Limit, "limit", 0, "print at most this many results")
+    fresh := flag.Bool("fresh", false, "bypass cached targets and scripts")
+    grouped := flag.Bool("grouped", false, "print one entry per address with all of its sources and targets")
+    trustedPath := flag.String("trusted", os.Getenv("TRUSTED_ADDRESSES_FILE"), "file of trusted addresses, one per line, to flag lookalikes of")
+    enrichChains := flag.String("enrich", "", "comma-separated chains to classify results on as EOAs, contracts or ERC-20 tokens (e.g. ethereum,polygon)")
+    enrichImplementations := flag.Bool("enrich-implementations", false, "classify the implementation of proxies found with -enrich as well")
+    ens := flag.Bool("ens", false, "resolve .eth names found on pages and look up the primary ENS name of results")
+    flag.Usage = func() {
+        fmt.Fprintln(os.Stderr, "Usage: go run scraper-main/main.go [flags] url1 url2 ...")
+        fmt.Fprintln(os.Stderr, "       go run scraper-main/main.go address [-limit n] 0x...")
+        fmt.Fprintln(os.Stderr, "       go run scraper-main/main.go watch <command> ...")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if flag.NArg() < 1 {
+        flag.Usage()
+        os.Exit(1)
+    }
+    if err := query.Validate(); err != nil {
+        log.Fatalf("Invalid query: %v", err)
+    }
+    if err := core.ConfigureCacheFromEnv(); err != nil {
+        log.Fatalf("Failed to configure cache: %v", err)
+    }
+    trusted, err := loadTrusted(*trustedPath)
+    if err != nil {
+        log.Fatalf("Failed to load trusted addresses: %v", err)
+    }
+    var chains []string
+    if *enrichChains != "" {
+        chains = strings.Split(*enrichChains, ",")
+        if err := enrich.ValidateChains(chains); err != nil {
+            log.Fatalf("Invalid -enrich: %v", err)
+        }
     }
 
-    targets := os.Args[1:]
-    results, err := core.Scrape(targets)
+    store, err := history.OpenFromEnv()
     if err != nil {
-        log.Fatalf("Failed to scrape targets: %v", err)
+        log.Printf("Failed to open history: %v", err)
+    }
+    if store != nil {
+        defer store.Close()
+    }
+
+    targets := flag.Args()
+
+    // Ctrl+C stops the scrape early, the partial results are still printed
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    if *timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, *timeout)
+        defer cancel()
+    }
+
+    startedAt := time.Now()
+    opts := core.Options{Fresh: *fresh, Trusted: trusted, Enrich: chains, EnrichImplementations: *enrichImplementations, ENS: *ens}
+    if store != nil {
+        opts.KnownAddresses = history.KnownAddresses(store)
+    }
+    result := core.ScrapeContext(ctx, targets, opts)
+    saveHistory(store, startedAt, result)
+    if result.Partial {
+        fmt.Fprintln(os.Stderr, "Scrape stopped early, results are partial")
+    }
+
+    for _, targetReport := range result.Report {
+        if targetReport.Error != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", targetReport.Target, targetReport.Error.Message, targetReport.Error.Category)
+        }
+    }
+
+    var results interface{}
+    if *grouped {
+        page, _ := core.ApplyGroupedQuery(result.Results, query)
+        results = page.Results
+    } else {
+        page, _ := core.ApplyQuery(result.Results, query)
+        results = page.Results
     }
 
-    jsonResults, err := json.MarshalIndent(results, "", "  ")
+    output := results
+    if *report {
+        output = map[string]interface{}{
+            "results": results,
+            "report":  result.Report,
+            "partial": result.Partial,
+        }
+    }
+
+    jsonResults, err := json.MarshalIndent(output, "", "  ")
     if err != nil {
         log.Fatalf("Failed to marshal results: %v", err)
     }
 
     fmt.Println(string(jsonResults))
+
+    if result.AllFailed() {
+        os.Exit(1)
+    }
+}
+
+// Function to save the run to the history store if there is one, a failure is only reported
+func saveHistory(store history.Store, startedAt time.Time, result core.ScrapeResult) {
+    if store == nil {
+        return
+    }
+    if _, err := store.SaveRun(context.Background(), history.NewRun(history.SourceCLI, startedAt, time.Now(), result)); err != nil {
+        log.Printf("Failed to save run to history: %v", err)
+    }
+}
+
+// Function to print which sites and sources referenced an address, according to the history store
+func runAddress(args []string) {
+    flags := flag.NewFlagSet("address", flag.ExitOnError)
+    limit := flags.Int("limit", 0, "list at most this many sightings and references")
+    flags.Usage = func() {
+        fmt.Fprintln(os.Stderr, "Usage: go run scraper-main/main.go address [-limit n] 0x...")
+        flags.PrintDefaults()
+    }
+    flags.Parse(args)
+
+    if flags.NArg() != 1 {
+        flags.Usage()
+        os.Exit(1)
+    }
+
+    store, err := history.OpenFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open history: %v", err)
+    }
+    if store == nil {
+        log.Fatal("History is disabled, set HISTORY_BACKEND to sqlite")
+    }
+    defer store.Close()
+
+    report, err := history.LookupAddress(context.Background(), store, flags.Arg(0), *limit)
+    if err != nil {
+        log.Fatalf("Failed to look up address: %v", err)
+    }
+
+    jsonReport, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        log.Fatalf("Failed to marshal address: %v", err)
+    }
+    fmt.Println(string(jsonReport))
+}
+
+// Function to load the trusted address list at path, if any
+func loadTrusted(path string) ([]string, error) {
+    if path == "" {
+        return nil, nil
+    }
+    return core.LoadTrustedAddresses(path)
 }
@@ -0,0 +1,151 @@
+package cli
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "os/signal"
+    "strconv"
+    "time"
+
+    "backend/history"
+    "backend/watch"
+    "backend/webhook"
+)
+
+const watchUsage = `Usage: go run scraper-main/main.go watch <command> [flags] [args]
+
+Commands:
+  add [-name name] [-interval 1h] url1 url2 ...   create a watchlist
+  list                                            list watchlists
+  remove id                                       delete a watchlist and its diffs
+  run id                                          scrape a watchlist now, print the diff and notify webhooks
+  diffs [-changed] [-limit n] id                  print the stored diffs of a watchlist
+  serve [-tick 1m]                                re-scrape watchlists when due and notify webhooks until interrupted`
+
+// Function to manage watchlists and their diffs, kept in the history store
+func runWatch(args []string) {
+    if len(args) < 1 {
+        fmt.Fprintln(os.Stderr, watchUsage)
+        os.Exit(1)
+    }
+
+    store, err := history.OpenFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open history: %v", err)
+    }
+    if store == nil {
+        log.Fatal("History is disabled, set HISTORY_BACKEND to sqlite")
+    }
+    defer store.Close()
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+
+    trusted, err := loadTrusted(os.Getenv("TRUSTED_ADDRESSES_FILE"))
+    if err != nil {
+        log.Fatalf("Failed to load trusted addresses: %v", err)
+    }
+
+    command, args := args[0], args[1:]
+    flags := flag.NewFlagSet("watch "+command, flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Fprintln(os.Stderr, watchUsage)
+    }
+
+    switch command {
+    case "add":
+        name := flags.String("name", "", "name of the watchlist")
+        interval := flags.Duration("interval", time.Hour, "how often the targets are re-scraped")
+        flags.Parse(args)
+        watchlist := &history.Watchlist{Name: *name, Targets: flags.Args(), IntervalSeconds: int(interval.Seconds())}
+        if err := watchlist.Validate(); err != nil {
+            log.Fatal(err)
+        }
+        if _, err := store.CreateWatchlist(ctx, watchlist); err != nil {
+            log.Fatalf("Failed to create watchlist: %v", err)
+        }
+        printJSON(watchlist)
+    case "list":
+        flags.Parse(args)
+        watchlists, err := store.Watchlists(ctx)
+        if err != nil {
+            log.Fatalf("Failed to list watchlists: %v", err)
+        }
+        printJSON(watchlists)
+    case "remove":
+        flags.Parse(args)
+        if err := store.DeleteWatchlist(ctx, parseWatchlistID(flags)); err != nil {
+            log.Fatalf("Failed to delete watchlist: %v", err)
+        }
+    case "run":
+        flags.Parse(args)
+        scheduler := watch.NewScheduler(store)
+        scheduler.Trusted = trusted
+        dispatcher := webhook.NewDispatcher(store)
+        scheduler.OnDiff = dispatcher.Notify
+        diff, err := scheduler.Run(ctx, parseWatchlistID(flags))
+        if err != nil {
+            log.Fatalf("Failed to run watchlist: %v", err)
+        }
+        printJSON(diff)
+        dispatcher.Wait()
+    case "diffs":
+        var filter history.DiffFilter
+        flags.BoolVar(&filter.Changed, "changed", false, "only print diffs with added, removed or moved addresses")
+        flags.IntVar(&filter.Limit, "limit", 0, "print at most this many diffs")
+        flags.Parse(args)
+        id := parseWatchlistID(flags)
+        if err := filter.Validate(); err != nil {
+            log.Fatal(err)
+        }
+        diffs, err := store.Diffs(ctx, id, filter)
+        if err != nil {
+            log.Fatalf("Failed to query diffs: %v", err)
+        }
+        printJSON(diffs)
+    case "serve":
+        tick := flags.Duration("tick", time.Minute, "how often to check for due watchlists")
+        flags.Parse(args)
+        scheduler := watch.NewScheduler(store)
+        scheduler.Trusted = trusted
+        dispatcher := webhook.NewDispatcher(store)
+        scheduler.OnDiff = func(watchlist history.Watchlist, diff history.Diff) {
+            dispatcher.Notify(watchlist, diff)
+            if diff.Changed() {
+                fmt.Fprintf(os.Stderr, "Watchlist %d changed: %d added, %d removed, %d moved\n", watchlist.ID, len(diff.Added), len(diff.Removed), len(diff.Moved))
+                printJSON(diff)
+            }
+        }
+        scheduler.Start(ctx, *tick)
+        <-ctx.Done()
+        dispatcher.Wait()
+    default:
+        fmt.Fprintln(os.Stderr, watchUsage)
+        os.Exit(1)
+    }
+}
+
+// Function to parse the single watchlist ID argument, exiting on failure
+func parseWatchlistID(flags *flag.FlagSet) int64 {
+    if flags.NArg() != 1 {
+        flags.Usage()
+        os.Exit(1)
+    }
+    id, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+    if err != nil {
+        log.Fatalf("Invalid watchlist ID %q", flags.Arg(0))
+    }
+    return id
+}
+
+func printJSON(value interface{}) {
+    encoded, err := json.MarshalIndent(value, "", "  ")
+    if err != nil {
+        log.Fatalf("Failed to marshal output: %v", err)
+    }
+    fmt.Println(string(encoded))
+}
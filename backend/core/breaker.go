@@ -0,0 +1,251 @@
+package core
+
+import (
+	"backend/cache"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+const (
+	// breakerThreshold is the number of consecutive failures that opens the breaker of a host
+	breakerThreshold = 5
+	// breakerCooldown is how long an open breaker fails fast before letting one trial fetch through
+	breakerCooldown = 30 * time.Second
+	// defaultFailureTTL is how long a failed fetch is remembered, see NEGATIVE_CACHE_TTL
+	defaultFailureTTL   = 30 * time.Second
+	maxFailureCacheSize = 10000
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open for host")
+
+var (
+	// failureCache remembers recent fetch failures per normalized URL together with their error class
+	failureCache = newFailureCache()
+	failureTTL   = defaultFailureTTL
+	hostBreakers = newBreakers(breakerThreshold, breakerCooldown)
+)
+
+func newFailureCache() *cache.Memory[string, *ScrapeError] {
+	c := cache.NewMemory[string, *ScrapeError](maxFailureCacheSize, defaultFailureTTL)
+	c.StartJanitor(time.Minute)
+	return c
+}
+
+// cachedFailure is a fetch error replayed from the failure cache
+type cachedFailure struct {
+	*ScrapeError
+}
+
+func (e *cachedFailure) Error() string {
+	return e.Message + " (cached failure)"
+}
+
+// BreakerState describes the circuit breaker of one host
+type BreakerState struct {
+	Host  string `json:"host"`
+	State string `json:"state"`
+	// Failures is the number of consecutive failed fetches
+	Failures  int          `json:"failures"`
+	LastError *ScrapeError `json:"last_error,omitempty"`
+	// RetryAt is when an open breaker lets the next trial fetch through
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+type hostBreaker struct {
+	state     string
+	failures  int
+	lastError *ScrapeError
+	openedAt  time.Time
+	// trial is set while the single fetch allowed by a half-open breaker is running
+	trial bool
+}
+
+// breakers keeps one circuit breaker per host. A breaker opens after
+// threshold consecutive failures, fails fast for cooldown, then half-opens
+// and lets one fetch decide whether it closes or opens again.
+type breakers struct {
+	mutex     sync.Mutex
+	hosts     map[string]*hostBreaker
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{
+		hosts:     make(map[string]*hostBreaker),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns errCircuitOpen if a fetch from host should fail fast
+func (b *breakers) allow(host string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker, ok := b.hosts[host]
+	if !ok {
+		return nil
+	}
+	switch breaker.state {
+	case BreakerOpen:
+		if b.now().Sub(breaker.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		breaker.state = BreakerHalfOpen
+		breaker.trial = true
+		return nil
+	case BreakerHalfOpen:
+		if breaker.trial {
+			return errCircuitOpen
+		}
+		breaker.trial = true
+	}
+	return nil
+}
+
+// success closes the breaker of host
+func (b *breakers) success(host string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.hosts, host)
+}
+
+// failure counts a failed fetch from host and opens its breaker once the
+// threshold is reached or a half-open trial fails
+func (b *breakers) failure(host string, failure *ScrapeError) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker, ok := b.hosts[host]
+	if !ok {
+		breaker = &hostBreaker{state: BreakerClosed}
+		b.hosts[host] = breaker
+	}
+	breaker.failures++
+	breaker.lastError = failure
+	breaker.trial = false
+	if breaker.state == BreakerHalfOpen || breaker.failures >= b.threshold {
+		breaker.state = BreakerOpen
+		breaker.openedAt = b.now()
+	}
+}
+
+// release ends a half-open trial that was cancelled before it said anything about host
+func (b *breakers) release(host string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if breaker, ok := b.hosts[host]; ok {
+		breaker.trial = false
+	}
+}
+
+func (b *breakers) states() []BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	states := make([]BreakerState, 0, len(b.hosts))
+	for host, breaker := range b.hosts {
+		state := BreakerState{Host: host, State: breaker.state, Failures: breaker.failures, LastError: breaker.lastError}
+		if breaker.state == BreakerOpen {
+			retryAt := breaker.openedAt.Add(b.cooldown)
+			state.RetryAt = &retryAt
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
+
+func (b *breakers) reset(host string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	_, ok := b.hosts[host]
+	delete(b.hosts, host)
+	return ok
+}
+
+// BreakerStates lists every host that recently failed, sorted by host
+func BreakerStates() []BreakerState {
+	return hostBreakers.states()
+}
+
+// ResetBreaker closes the breaker of host and reports whether it had one
+func ResetBreaker(host string) bool {
+	return hostBreakers.reset(strings.ToLower(host))
+}
+
+// Function to check whether an error class says something about the health of a host
+func isHostFailure(category ErrorCategory) bool {
+	switch category {
+	case ErrorDNS, ErrorTimeout, ErrorTLS, ErrorConnection:
+		return true
+	}
+	return false
+}
+
+// Function to fetch targetURL unless it failed recently or the breaker of
+// its host is open, recording the outcome for both. 5xx and 429 responses
+// count against the host like connection failures.
+func (r *scrapeRun) fetch(ctx context.Context, targetURL string, conditional validators) (*fetchResult, error) {
+	key := normalizeURL(targetURL)
+	if !r.opts.Fresh {
+		if failure, ok := failureCache.Get(key); ok {
+			return nil, &cachedFailure{failure}
+		}
+	}
+
+	host := breakerHost(targetURL)
+	if err := hostBreakers.allow(host); err != nil {
+		return nil, fmt.Errorf("%w %s", err, host)
+	}
+
+	fetched, err := fetchContent(ctx, targetURL, conditional)
+	switch {
+	case err == nil:
+		hostBreakers.success(host)
+	case ctx.Err() != nil:
+		// Giving up on our side says nothing about the host
+		hostBreakers.release(host)
+	default:
+		failure := newScrapeError(err)
+		var statusErr *httpStatusError
+		answered := errors.As(err, &statusErr)
+		hostFailure := isHostFailure(failure.Category) || (answered && statusErr.serverSide())
+		switch {
+		case hostFailure:
+			hostBreakers.failure(host, failure)
+		case answered:
+			// A client error such as 404 is about the URL, the host is up
+			hostBreakers.success(host)
+		default:
+			hostBreakers.release(host)
+		}
+		if failureTTL > 0 && (hostFailure || failure.Category == ErrorTooLarge) {
+			failureCache.SetWithTTL(key, failure, failureTTL)
+		}
+	}
+	return fetched, err
+}
+
+func breakerHost(targetURL string) string {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndHalfOpens(t *testing.T) {
+	now := time.Now()
+	b := newBreakers(2, time.Minute)
+	b.now = func() time.Time { return now }
+	failure := &ScrapeError{Category: ErrorConnection, Message: "connection refused"}
+
+	b.failure("down.example", failure)
+	if err := b.allow("down.example"); err != nil {
+		t.Errorf("Expected breaker to stay closed below the threshold, got %v", err)
+	}
+	b.failure("down.example", failure)
+	if err := b.allow("down.example"); err != errCircuitOpen {
+		t.Errorf("Expected breaker to be open, got %v", err)
+	}
+	if states := b.states(); len(states) != 1 || states[0].State != BreakerOpen || states[0].RetryAt == nil {
+		t.Errorf("Unexpected breaker states: %+v", states)
+	}
+
+	// After the cooldown a single trial fetch is let through
+	now = now.Add(time.Minute)
+	if err := b.allow("down.example"); err != nil {
+		t.Errorf("Expected trial fetch to be allowed, got %v", err)
+	}
+	if err := b.allow("down.example"); err != errCircuitOpen {
+		t.Errorf("Expected other fetches to fail fast during the trial, got %v", err)
+	}
+
+	// A failed trial opens the breaker again, a successful one closes it
+	b.failure("down.example", failure)
+	if states := b.states(); states[0].State != BreakerOpen {
+		t.Errorf("Expected failed trial to reopen the breaker, got %+v", states[0])
+	}
+	now = now.Add(time.Minute)
+	b.allow("down.example")
+	b.success("down.example")
+	if states := b.states(); len(states) != 0 {
+		t.Errorf("Expected successful trial to close the breaker, got %+v", states)
+	}
+}
+
+func TestFailedFetchesAreCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	target := server.URL + "/gone"
+	// Connections to a closed server are refused
+	server.Close()
+	defer ResetBreaker(strings.TrimPrefix(server.URL, "http://"))
+
+	first := ScrapeContext(context.Background(), []string{target}, Options{})
+	if first.Report[0].Error == nil || first.Report[0].Error.Category != ErrorConnection {
+		t.Fatalf("Expected connection error, got %+v", first.Report[0])
+	}
+
+	second := ScrapeContext(context.Background(), []string{target}, Options{})
+	if err := second.Report[0].Error; err == nil || err.Category != ErrorConnection || !strings.Contains(err.Message, "cached failure") {
+		t.Errorf("Expected cached connection error, got %+v", second.Report[0].Error)
+	}
+	if states := BreakerStates(); len(states) != 1 || states[0].Failures != 1 {
+		t.Errorf("Expected one failure to be counted against the host, got %+v", states)
+	}
+}
+
+func TestHTTPErrorsAreFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "0x4444444444444444444444444444444444444444 is down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer ResetBreaker(strings.TrimPrefix(server.URL, "http://"))
+
+	result := ScrapeContext(context.Background(), []string{server.URL + "/"}, Options{})
+	report := result.Report[0]
+	if report.Status != StatusError || report.Error == nil || report.Error.Category != ErrorHTTPStatus || report.HTTPCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected an HTTP status error, got %+v", report)
+	}
+	if len(result.Results) != 0 || !result.AllFailed() {
+		t.Errorf("Expected the error page to yield nothing, got %+v", result.Results)
+	}
+	if states := BreakerStates(); len(states) != 1 || states[0].Failures != 1 {
+		t.Errorf("Expected the 503 to be counted against the host, got %+v", states)
+	}
+
+	// Neither the page nor the error is cached as a successful fetch
+	if _, ok := targetCache.Get(normalizeURL(server.URL + "/")); ok {
+		t.Error("Expected the failed target not to be cached")
+	}
+	ScrapeContext(context.Background(), []string{server.URL + "/"}, Options{Fresh: true})
+	if requests.Load() != 2 {
+		t.Errorf("Expected the fresh scrape to fetch again, got %d requests", requests.Load())
+	}
+}
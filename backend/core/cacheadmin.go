@@ -0,0 +1,213 @@
+package core
+
+import (
+	"backend/cache"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	CacheTargets = "targets"
+	CacheScripts = "scripts"
+)
+
+var (
+	ErrUnknownCache = errors.New("unknown cache, expected targets or scripts")
+	ErrPurgeFilter  = errors.New("exactly one of key, prefix, host or all is required")
+)
+
+// CacheStats describes the contents and counters of one of the scrape caches
+type CacheStats struct {
+	cache.Stats
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+}
+
+// CacheEntry describes one cached target or script without its value
+type CacheEntry struct {
+	cache.EntryInfo[string]
+	AgeSeconds int64 `json:"age_seconds"`
+}
+
+// CachedTarget is the value of an entry of the targets cache
+type CachedTarget struct {
+	Results []AddressInfo `json:"results"`
+	Report  TargetReport  `json:"report"`
+}
+
+// CachedScript is the value of an entry of the scripts cache
+type CachedScript struct {
+	StatusCode  int      `json:"status_code"`
+	Bytes       int      `json:"bytes"`
+	ContentHash string   `json:"content_hash"`
+	Addresses   []string `json:"addresses"`
+}
+
+// CacheFilter selects cache entries by exact key, key prefix or host. Keys
+// are normalized URLs, see normalizeURL.
+type CacheFilter struct {
+	Key    string `form:"key"`
+	Prefix string `form:"prefix"`
+	Host   string `form:"host"`
+	// All selects every entry
+	All bool `form:"all"`
+}
+
+// Validate checks that the filter selects entries in exactly one way
+func (f CacheFilter) Validate() error {
+	set := 0
+	for _, ok := range []bool{f.Key != "", f.Prefix != "", f.Host != "", f.All} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return ErrPurgeFilter
+	}
+	return nil
+}
+
+func (f CacheFilter) matches(key string) bool {
+	switch {
+	case f.Key != "":
+		return key == normalizeURL(f.Key)
+	case f.Prefix != "":
+		return strings.HasPrefix(key, f.Prefix)
+	case f.Host != "":
+		parsed, err := url.Parse(key)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(f.Host)
+		return parsed.Hostname() == host || parsed.Host == host
+	}
+	return true
+}
+
+// adminCache gives untyped access to one of the scrape caches
+type adminCache struct {
+	inspector cache.Inspector[string]
+	get       func(key string) (interface{}, bool)
+	delete    func(key string) bool
+}
+
+func lookupCache(name string) (adminCache, error) {
+	switch name {
+	case CacheTargets:
+		c := targetCache
+		inspector, _ := c.(cache.Inspector[string])
+		return adminCache{
+			inspector: inspector,
+			get: func(key string) (interface{}, bool) {
+				entry, ok := c.Get(key)
+				return CachedTarget{Results: entry.Infos, Report: entry.Report}, ok
+			},
+			delete: c.Delete,
+		}, nil
+	case CacheScripts:
+		c := scriptCache
+		inspector, _ := c.(cache.Inspector[string])
+		return adminCache{
+			inspector: inspector,
+			get: func(key string) (interface{}, bool) {
+				entry, ok := c.Get(key)
+				if !ok {
+					return nil, false
+				}
+				return CachedScript{StatusCode: entry.StatusCode, Bytes: entry.Bytes, ContentHash: entry.ContentHash, Addresses: entry.Addresses}, true
+			},
+			delete: c.Delete,
+		}, nil
+	}
+	return adminCache{}, ErrUnknownCache
+}
+
+// GetCacheStats returns the stats of the targets and scripts caches
+func GetCacheStats() map[string]CacheStats {
+	stats := make(map[string]CacheStats)
+	for _, name := range []string{CacheTargets, CacheScripts} {
+		c, _ := lookupCache(name)
+		if c.inspector == nil {
+			continue
+		}
+		cacheStats := CacheStats{Stats: c.inspector.Stats()}
+		for _, entry := range c.inspector.Entries() {
+			cacheStats.Entries++
+			cacheStats.Size += entry.Size
+		}
+		stats[name] = cacheStats
+	}
+	return stats
+}
+
+// ListCacheEntries describes the entries of cache name matching filter. An
+// empty filter matches every entry.
+func ListCacheEntries(name string, filter CacheFilter) ([]CacheEntry, error) {
+	c, err := lookupCache(name)
+	if err != nil {
+		return nil, err
+	}
+	entries := []CacheEntry{}
+	if c.inspector == nil {
+		return entries, nil
+	}
+	now := time.Now()
+	for _, info := range c.inspector.Entries() {
+		if !filter.matches(info.Key) {
+			continue
+		}
+		entry := CacheEntry{EntryInfo: info}
+		if !info.StoredAt.IsZero() {
+			entry.AgeSeconds = int64(now.Sub(info.StoredAt).Seconds())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetCacheEntry returns the value cached under key, a CachedTarget or a CachedScript
+func GetCacheEntry(name, key string) (interface{}, bool, error) {
+	c, err := lookupCache(name)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := c.get(normalizeURL(key))
+	return value, ok, nil
+}
+
+// PurgeCache drops the entries of cache name matching filter, along with
+// the validators and failures remembered for them, and returns how many
+// entries were dropped
+func PurgeCache(name string, filter CacheFilter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	c, err := lookupCache(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var keys []string
+	if filter.Key != "" {
+		keys = []string{normalizeURL(filter.Key)}
+	} else if c.inspector != nil {
+		for _, info := range c.inspector.Entries() {
+			if filter.matches(info.Key) {
+				keys = append(keys, info.Key)
+			}
+		}
+	}
+
+	purged := 0
+	for _, key := range keys {
+		if c.delete(key) {
+			purged++
+		}
+		// A poisoned entry must not come back through revalidation
+		resourceCache.Delete(key)
+		failureCache.Delete(key)
+	}
+	return purged, nil
+}
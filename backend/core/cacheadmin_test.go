@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheAdmin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	}))
+	defer server.Close()
+
+	targets := []string{server.URL + "/admin-one", server.URL + "/admin-two"}
+	ScrapeContext(context.Background(), targets, Options{})
+
+	entries, err := ListCacheEntries(CacheTargets, CacheFilter{Prefix: server.URL + "/admin-"})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v (%v)", entries, err)
+	}
+	if entries[0].Size <= 0 || entries[0].StoredAt.IsZero() {
+		t.Errorf("Expected entry with size and age, got %+v", entries[0])
+	}
+
+	value, ok, err := GetCacheEntry(CacheTargets, strings.ToUpper(server.URL[:4])+server.URL[4:]+"/admin-one")
+	if err != nil || !ok {
+		t.Fatalf("Expected entry to be found by an unnormalized key, got %v (%v)", ok, err)
+	}
+	if target := value.(CachedTarget); len(target.Results) != 1 {
+		t.Errorf("Unexpected cached target: %+v", target)
+	}
+
+	if _, err := PurgeCache(CacheTargets, CacheFilter{}); err != ErrPurgeFilter {
+		t.Errorf("Expected filter error, got %v", err)
+	}
+	if _, err := PurgeCache("bodies", CacheFilter{All: true}); err != ErrUnknownCache {
+		t.Errorf("Expected unknown cache error, got %v", err)
+	}
+
+	purged, err := PurgeCache(CacheTargets, CacheFilter{Key: targets[0]})
+	if err != nil || purged != 1 {
+		t.Errorf("Expected 1 entry purged by key, got %d (%v)", purged, err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	purged, _ = PurgeCache(CacheTargets, CacheFilter{Host: host})
+	if purged != 1 {
+		t.Errorf("Expected 1 entry purged by host, got %d", purged)
+	}
+	if _, ok, _ := GetCacheEntry(CacheTargets, targets[1]); ok {
+		t.Error("Expected purged entry to be gone")
+	}
+
+	if stats := GetCacheStats()[CacheTargets]; stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("Expected lookups to be counted, got %+v", stats)
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"backend/cache"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	maxCacheSize   = 1000
+	targetCacheTTL = 10 * time.Minute
+	scriptCacheTTL = 1 * time.Hour
+	// Byte budgets of the in-memory caches, measured with weighTargetEntry and weighScriptEntry
+	targetCacheBytes = 32 * 1024 * 1024
+	scriptCacheBytes = 64 * 1024 * 1024
+	// entryOverhead approximates the fixed cost of a cache entry in bytes
+	entryOverhead = 128
+)
+
+var (
+	targetCache cache.Cache[string, targetEntry]  = newTargetMemoryCache()
+	scriptCache cache.Cache[string, *scriptEntry] = newScriptMemoryCache()
+
+	// Loaders read through the caches and coalesce concurrent fetches of one URL
+	targetLoader = cache.NewLoader(targetCache)
+	scriptLoader = cache.NewLoader(scriptCache)
+)
+
+func newTargetMemoryCache() *cache.Memory[string, targetEntry] {
+	c := cache.NewWeightedMemory[string, targetEntry](maxCacheSize, targetCacheBytes, targetCacheTTL, weighTargetEntry)
+	c.StartJanitor(time.Minute)
+	return c
+}
+
+func newScriptMemoryCache() *cache.Memory[string, *scriptEntry] {
+	c := cache.NewWeightedMemory[string, *scriptEntry](maxCacheSize, scriptCacheBytes, scriptCacheTTL, weighScriptEntry)
+	c.StartJanitor(time.Minute)
+	return c
+}
+
+// ConfigureCacheFromEnv selects where scraped targets and scripts are cached,
+// based on CACHE_BACKEND:
+//   - "memory" (default): in process, lost on restart
+//   - "disk": a bbolt file at CACHE_PATH (default scraper-cache.db)
+//   - "redis": a Redis compatible server at REDIS_ADDR, shared between replicas
+//
+// Failed fetches are remembered in memory for NEGATIVE_CACHE_TTL (a duration
+// such as "1m", default 30s, "0" disables it).
+func ConfigureCacheFromEnv() error {
+	if value := os.Getenv("NEGATIVE_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid NEGATIVE_CACHE_TTL %q, expected a duration such as 30s", value)
+		}
+		failureTTL = ttl
+	}
+
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "", "memory":
+		return nil
+	case "disk":
+		path := os.Getenv("CACHE_PATH")
+		if path == "" {
+			path = "scraper-cache.db"
+		}
+		db, err := cache.OpenDiskDB(path)
+		if err != nil {
+			return fmt.Errorf("failed to open cache file %s: %w", path, err)
+		}
+		targets, err := cache.NewDisk[targetEntry](db, "targets", targetCacheTTL)
+		if err != nil {
+			return err
+		}
+		scripts, err := cache.NewDisk[*scriptEntry](db, "scripts", scriptCacheTTL)
+		if err != nil {
+			return err
+		}
+		targets.StartJanitor(10 * time.Minute)
+		scripts.StartJanitor(10 * time.Minute)
+		setCaches(targets, scripts)
+		return nil
+	case "redis":
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			addr = "localhost:6379"
+		}
+		targets := cache.NewRedis[targetEntry](addr, "scraper:target:", targetCacheTTL)
+		if err := targets.Ping(); err != nil {
+			return fmt.Errorf("failed to reach redis at %s: %w", addr, err)
+		}
+		setCaches(targets, cache.NewRedis[*scriptEntry](addr, "scraper:script:", scriptCacheTTL))
+		return nil
+	default:
+		return fmt.Errorf("unknown CACHE_BACKEND %q, expected memory, disk or redis", backend)
+	}
+}
+
+func setCaches(targets cache.Cache[string, targetEntry], scripts cache.Cache[string, *scriptEntry]) {
+	targetCache, scriptCache = targets, scripts
+	targetLoader, scriptLoader = cache.NewLoader(targets), cache.NewLoader(scripts)
+}
+
+func weighScriptEntry(entry *scriptEntry) int64 {
+	weight := int64(entryOverhead + len(entry.ContentHash))
+	for _, address := range entry.Addresses {
+		weight += int64(len(address)) + 16
+	}
+	for _, context := range entry.Contexts {
+		weight += int64(len(context)) + 16
+	}
+	return weight
+}
+
+func weighTargetEntry(entry targetEntry) int64 {
+	weight := int64(entryOverhead + len(entry.Report.Target))
+	for _, info := range entry.Infos {
+		weight += int64(entryOverhead + len(info.Address) + len(info.Name) + len(info.Src) + len(info.Type) + len(info.Context))
+	}
+	for _, script := range entry.Report.Scripts {
+		weight += int64(entryOverhead + len(script.URL))
+	}
+	return weight
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrInvalidAddress  = errors.New("address must be 0x followed by 40 hexadecimal characters")
+	ErrInvalidChecksum = errors.New("mixed-case address has an invalid EIP-55 checksum")
+)
+
+// ChecksumAddress returns the EIP-55 mixed-case form of a valid address
+func ChecksumAddress(address string) string {
+	lower := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(lower))
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	checksummed := []byte(lower)
+	for i, c := range checksummed {
+		// Letters are uppercased where the matching nibble of the hash is 8 or more
+		if c >= 'a' && c <= 'f' && digest[i] >= '8' {
+			checksummed[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(checksummed)
+}
+
+// NormalizeAddress validates address and returns it lowercased. All-lowercase
+// and all-uppercase addresses are accepted as is, mixed-case ones must carry
+// a valid EIP-55 checksum.
+func NormalizeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if len(address) != 42 || !addressPattern.MatchString(address) {
+		return "", ErrInvalidAddress
+	}
+	digits := address[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && address != ChecksumAddress(address) {
+		return "", ErrInvalidChecksum
+	}
+	return normalizeAddress(address), nil
+}
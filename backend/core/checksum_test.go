@@ -0,0 +1,39 @@
+package core
+
+import "testing"
+
+func TestChecksumAddress(t *testing.T) {
+	// Test vectors from EIP-55
+	for _, expected := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if result := ChecksumAddress(normalizeAddress(expected)); result != expected {
+			t.Errorf("ChecksumAddress(%s) = %s, expected %s", normalizeAddress(expected), result, expected)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      error
+	}{
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{" 0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed ", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", "", ErrInvalidChecksum},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", "", ErrInvalidAddress},
+		{"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", "", ErrInvalidAddress},
+	}
+
+	for _, test := range tests {
+		result, err := NormalizeAddress(test.input)
+		if result != test.expected || err != test.err {
+			t.Errorf("NormalizeAddress(%q) = %q, %v; expected %q, %v", test.input, result, err, test.expected, test.err)
+		}
+	}
+}
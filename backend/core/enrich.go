@@ -0,0 +1,59 @@
+package core
+
+import (
+	"backend/enrich"
+	"context"
+)
+
+// TagProxy tags the results that are a proxy on any of the chains
+const TagProxy = "proxy"
+
+// Function to classify the results on the chains of opts.Enrich, tagging each
+// result with its type, the standards it implements, the interface its
+// bytecode matches and proxy for proxies.
+// Chains that could not be queried are reported with their error and add no
+// tag. Nothing is classified once ctx is done.
+func (r *scrapeRun) enrich(ctx context.Context, results []AddressInfo) {
+	if len(r.opts.Enrich) == 0 || len(results) == 0 || ctx.Err() != nil {
+		return
+	}
+	enricher := r.opts.Enricher
+	if enricher == nil {
+		enricher = enrich.Default()
+	}
+
+	addresses := make([]string, len(results))
+	for i, info := range results {
+		addresses[i] = info.Address
+	}
+	classified := enricher.ClassifyAll(ctx, r.opts.Enrich, addresses, enrich.ClassifyOptions{Implementations: r.opts.EnrichImplementations})
+
+	for i := range results {
+		info := &results[i]
+		chains := classified[normalizeAddress(info.Address)]
+		if len(chains) == 0 {
+			continue
+		}
+		info.Chains = chains
+		tags := append([]string(nil), info.Tags...)
+		for _, chain := range r.opts.Enrich {
+			classification := chains[chain]
+			if classification == nil || classification.Type == "" {
+				continue
+			}
+			found := append([]string{classification.Type}, classification.Standards...)
+			if classification.Fingerprint != nil && classification.Fingerprint.Interface != "" {
+				found = append(found, classification.Fingerprint.Interface)
+			}
+			if classification.Proxy != nil {
+				found = append(found, TagProxy)
+			}
+			for _, tag := range found {
+				if !contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		info.Tags = tags
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"backend/enrich"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// codeCaller answers eth_getCode with code for contract and nothing for
+// anything else, storage is empty and every eth_call reverts
+type codeCaller struct {
+	contract string
+}
+
+func (c codeCaller) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if method == "eth_getStorageAt" {
+		*result.(*string) = "0x0"
+		return nil
+	}
+	if method != "eth_getCode" {
+		return &enrich.RPCError{Code: 3, Message: "execution reverted"}
+	}
+	code := "0x"
+	if params[0] == c.contract {
+		code = "0x6080604052"
+	}
+	*result.(*string) = code
+	return nil
+}
+
+func TestScrapeEnrichesResults(t *testing.T) {
+	const wallet = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	const contract = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>Send to %s via %s</p>", wallet, "0xBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB")
+	}))
+	defer server.Close()
+
+	enricher := enrich.New(map[string]enrich.Caller{"ethereum": codeCaller{contract: contract}})
+	result := ScrapeContext(context.Background(), []string{server.URL}, Options{Fresh: true, Enrich: []string{"ethereum"}, Enricher: enricher})
+	if len(result.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", result.Results)
+	}
+	for _, info := range result.Results {
+		expected := enrich.TypeEOA
+		if normalizeAddress(info.Address) == contract {
+			expected = enrich.TypeContract
+		}
+		classification := info.Chains["ethereum"]
+		if classification == nil || classification.Type != expected || !contains(info.Tags, expected) {
+			t.Errorf("Expected %s to be tagged %s, got %+v", info.Address, expected, info)
+		}
+	}
+
+	for _, info := range ScrapeContext(context.Background(), []string{server.URL}, Options{Fresh: true, Enricher: enricher}).Results {
+		if info.Chains != nil || len(info.Tags) != 0 {
+			t.Errorf("Expected no enrichment without chains, got %+v", info)
+		}
+	}
+}
+
+func TestPostProcessContext(t *testing.T) {
+	// Post-processing shares what is left of the deadline of the scrape
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	post, cancelPost := postProcessContext(ctx)
+	defer cancelPost()
+	if deadline, _ := post.Deadline(); deadline.After(time.Now().Add(time.Second)) {
+		t.Errorf("Expected the deadline of the scrape to be kept, got %v", deadline)
+	}
+
+	// A scrape that timed out gets a grace period
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	post, cancelPost = postProcessContext(expired)
+	defer cancelPost()
+	if deadline, ok := post.Deadline(); post.Err() != nil || !ok || time.Until(deadline) > postProcessGrace {
+		t.Errorf("Expected a grace period after a timeout, got %v", post.Err())
+	}
+
+	// A scrape cancelled by its caller is not post-processed
+	cancelled, cancelCancelled := context.WithCancel(context.Background())
+	cancelCancelled()
+	post, cancelPost = postProcessContext(cancelled)
+	defer cancelPost()
+	if post.Err() == nil {
+		t.Error("Expected no post-processing after a cancellation")
+	}
+	enricher := enrich.New(map[string]enrich.Caller{"ethereum": codeCaller{}})
+	run := &scrapeRun{opts: Options{Enrich: []string{"ethereum"}, Enricher: enricher, ENS: true}}
+	results := []AddressInfo{{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}, {Name: "vitalik.eth"}}
+	results = run.resolveENS(post, results)
+	run.enrich(post, results)
+	if len(results) != 1 || results[0].Chains != nil {
+		t.Errorf("Expected names to be dropped and nothing enriched, got %+v", results)
+	}
+}
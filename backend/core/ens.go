@@ -0,0 +1,145 @@
+package core
+
+import (
+	"backend/enrich"
+	"context"
+	"log"
+	"regexp"
+)
+
+var (
+	// ensNamePattern matches candidate .eth names, those that are not valid
+	// ENS names being dropped by enrich.NormalizeName
+	ensNamePattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9][a-z0-9_-]*\.)+eth\b`)
+	// inlineCodePattern matches inline scripts and styles, where web3.eth is
+	// code rather than a name
+	inlineCodePattern = regexp.MustCompile(`(?is)<script\b[^>]*>.*?</script\s*>|<style\b[^>]*>.*?</style\s*>`)
+	// memberCallPattern matches the rest of a call such as web3.eth.getAccounts()
+	// in an event handler attribute
+	memberCallPattern = regexp.MustCompile(`^(?:\.[A-Za-z_$][\w$]*)*\(`)
+)
+
+// Function to find the .eth names in the HTML content, outside of inline
+// scripts and styles, along with the text around each of them
+func findNames(content string) (names, contexts []string) {
+	content = inlineCodePattern.ReplaceAllString(content, " ")
+	for _, loc := range ensNamePattern.FindAllStringIndex(content, -1) {
+		name, ok := enrich.NormalizeName(content[loc[0]:loc[1]])
+		if !ok || memberCallPattern.MatchString(content[loc[1]:]) {
+			continue
+		}
+		names = append(names, name)
+		contexts = append(contexts, contextSnippet(content, loc[0], loc[1]))
+	}
+	return names, contexts
+}
+
+// Function to turn the names found in src into AddressInfos, whose Address is
+// only known once the names are resolved
+func nameInfosFromMatches(names, contexts []string, src, contentType, target string) []AddressInfo {
+	var nameInfos []AddressInfo
+	for i, name := range names {
+		info := AddressInfo{
+			Name:    name,
+			Src:     src,
+			Type:    contentType,
+			Targets: []string{target},
+			Count:   1,
+		}
+		if i < len(contexts) {
+			info.Context = contexts[i]
+		}
+		nameInfos = append(nameInfos, info)
+	}
+	return nameInfos
+}
+
+// Function to resolve the names found by the scrape to addresses and look up
+// the primary name of every result when opts.ENS is set. Names that don't
+// resolve, or all of them without opts.ENS or once ctx is done, are dropped
+// from the results.
+func (r *scrapeRun) resolveENS(ctx context.Context, results []AddressInfo) []AddressInfo {
+	if !r.opts.ENS || ctx.Err() != nil {
+		return withResolvedNames(results, nil)
+	}
+	enricher := r.opts.Enricher
+	if enricher == nil {
+		enricher = enrich.Default()
+	}
+
+	var names []string
+	for _, info := range results {
+		if info.Address == "" {
+			names = append(names, info.Name)
+		}
+	}
+	var resolved map[string]string
+	if len(names) > 0 {
+		var err error
+		if resolved, err = enricher.ResolveNames(ctx, names); err != nil {
+			log.Printf("Error resolving ENS names: %v", err)
+		}
+	}
+	results = mergeResolvedNames(withResolvedNames(results, resolved))
+
+	addresses := make([]string, len(results))
+	for i, info := range results {
+		addresses[i] = info.Address
+	}
+	primary, err := enricher.LookupNames(ctx, addresses)
+	if err != nil {
+		log.Printf("Error looking up ENS names: %v", err)
+	}
+	for i := range results {
+		results[i].PrimaryName = primary[normalizeAddress(results[i].Address)]
+	}
+	return results
+}
+
+// Function to set the address of the names found to the one they resolve to,
+// dropping the names missing from resolved
+func withResolvedNames(results []AddressInfo, resolved map[string]string) []AddressInfo {
+	kept := results[:0]
+	for _, info := range results {
+		if info.Address == "" {
+			address, ok := resolved[info.Name]
+			if !ok {
+				continue
+			}
+			info.Address = ChecksumAddress(address)
+		}
+		kept = append(kept, info)
+	}
+	return kept
+}
+
+// Function to merge the names that resolved to an address found in the same
+// src into the entry of that address, which takes the name and its count.
+// Case variants of an address written out are kept apart, as
+// uniqueAddressInfos does.
+func mergeResolvedNames(results []AddressInfo) []AddressInfo {
+	seen := make(map[string]int)
+	var merged []AddressInfo
+	for _, info := range results {
+		key := normalizeAddress(info.Address) + info.Src + info.Type
+		i, ok := seen[key]
+		if !ok || (info.Name == "" && merged[i].Name == "") {
+			if !ok {
+				seen[key] = len(merged)
+			}
+			merged = append(merged, info)
+			continue
+		}
+		existing := &merged[i]
+		if existing.Name == "" {
+			existing.Name = info.Name
+		}
+		existing.Count += info.Count
+		for _, target := range info.Targets {
+			if !contains(existing.Targets, target) {
+				existing.Targets = append(existing.Targets, target)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"backend/enrich"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// ensCaller answers the eth_call of calls, keyed by address and calldata,
+// every other call reverts
+type ensCaller struct {
+	calls map[[2]string]string
+}
+
+func (c ensCaller) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if method != "eth_call" {
+		return &enrich.RPCError{Code: 3, Message: "execution reverted"}
+	}
+	call := params[0].(map[string]string)
+	output, ok := c.calls[[2]string{call["to"], call["data"]}]
+	if !ok {
+		return &enrich.RPCError{Code: 3, Message: "execution reverted"}
+	}
+	*result.(*string) = output
+	return nil
+}
+
+func node(name string) string {
+	node := enrich.Namehash(name)
+	return hex.EncodeToString(node[:])
+}
+
+func TestFindNames(t *testing.T) {
+	names, contexts := findNames(`Donate to Treasury.Protocol.eth or vitalik.eth.limo, not ab.eth or web3.ethereum`)
+	if want := []string{"treasury.protocol.eth", "vitalik.eth"}; !slices.Equal(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+	if len(contexts) != 2 || contexts[0] == "" || contexts[1] == "" {
+		t.Errorf("Expected a context per name, got %v", contexts)
+	}
+
+	// Code using web3.js is not mistaken for names
+	names, _ = findNames(`<script>const accounts = await web3.eth.getAccounts()</script>
+<style>.wallet.eth { color: red }</style>
+<button onclick="web3.eth.sendTransaction({})">Pay alice.eth</button>`)
+	if want := []string{"alice.eth"}; !slices.Equal(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+}
+
+func TestScrapeResolvesNames(t *testing.T) {
+	const wallet = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	const resolver = "0xcccccccccccccccccccccccccccccccccccccccc"
+	const registry = enrich.ENSRegistry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/both" {
+			fmt.Fprintf(w, "<p>Donate to treasury.protocol.eth (%s)</p>", wallet)
+			return
+		}
+		fmt.Fprint(w, "<p>Donate to treasury.protocol.eth or unknown.eth</p>")
+	}))
+	defer server.Close()
+
+	reverse := wallet[2:] + ".addr.reverse"
+	enricher := enrich.New(map[string]enrich.Caller{"ethereum": ensCaller{calls: map[[2]string]string{
+		{registry, "0x0178b8bf" + node("treasury.protocol.eth")}: "0x000000000000000000000000" + resolver[2:],
+		{registry, "0x0178b8bf" + node(reverse)}:                 "0x000000000000000000000000" + resolver[2:],
+		{resolver, "0x3b3b57de" + node("treasury.protocol.eth")}: "0x000000000000000000000000" + wallet[2:],
+		{resolver, "0x691f3431" + node(reverse)}:                 fmt.Sprintf("0x%064x%064x%x%s", 32, 21, "treasury.protocol.eth", "0000000000000000000000"),
+	}}})
+
+	result := ScrapeContext(context.Background(), []string{server.URL}, Options{Fresh: true, ENS: true, Enricher: enricher})
+	if len(result.Results) != 1 {
+		t.Fatalf("Expected only the resolved name, got %+v", result.Results)
+	}
+	info := result.Results[0]
+	if info.Address != ChecksumAddress(wallet) || info.Name != "treasury.protocol.eth" || info.PrimaryName != "treasury.protocol.eth" {
+		t.Errorf("Expected the name to resolve to the wallet, got %+v", info)
+	}
+
+	// A name resolving to an address written on the same page is merged into it
+	result = ScrapeContext(context.Background(), []string{server.URL + "/both"}, Options{Fresh: true, ENS: true, Enricher: enricher})
+	if len(result.Results) != 1 || result.Results[0].Address != wallet || result.Results[0].Name != "treasury.protocol.eth" || result.Results[0].Count != 2 {
+		t.Errorf("Expected one entry for the wallet and its name, got %+v", result.Results)
+	}
+
+	if result := ScrapeContext(context.Background(), []string{server.URL}, Options{Fresh: true, Enricher: enricher}); len(result.Results) != 0 {
+		t.Errorf("Expected names to be dropped without ENS, got %+v", result.Results)
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import "sync"
+
+type EventType string
+
+const (
+	EventTargetStarted  EventType = "target_started"
+	EventScriptFetched  EventType = "script_fetched"
+	EventAddressFound   EventType = "address_found"
+	EventTargetFinished EventType = "target_finished"
+)
+
+// Event describes progress made by ScrapeContext while it is still running
+type Event struct {
+	Type    EventType     `json:"type"`
+	Target  string        `json:"target"`
+	Script  *ScriptReport `json:"script,omitempty"`
+	Address *AddressInfo  `json:"address,omitempty"`
+	Report  *TargetReport `json:"report,omitempty"`
+}
+
+// observer serializes calls to Options.Observer, which may be triggered from
+// several script goroutines at once, and drops repeated address findings
+type observer struct {
+	fn    func(Event)
+	mutex sync.Mutex
+	seen  map[string]bool
+}
+
+func newObserver(fn func(Event)) *observer {
+	return &observer{fn: fn, seen: make(map[string]bool)}
+}
+
+func (o *observer) emit(event Event) {
+	if o == nil || o.fn == nil {
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.fn(event)
+}
+
+func (o *observer) addressesFound(target string, infos []AddressInfo) {
+	if o == nil || o.fn == nil {
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for i := range infos {
+		// Names are only reported once resolved, with the results
+		if infos[i].Address == "" {
+			continue
+		}
+		key := infos[i].Address + infos[i].Src + infos[i].Type + target
+		if o.seen[key] {
+			continue
+		}
+		o.seen[key] = true
+		info := infos[i]
+		o.fn(Event{Type: EventAddressFound, Target: target, Address: &info})
+	}
+}
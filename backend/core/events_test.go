@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScrapeContextObserver(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `0x4444444444444444444444444444444444444444 0x4444444444444444444444444444444444444444 <script src="/app.js"></script>`)
+	})
+	mux.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `0x5555555555555555555555555555555555555555`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var events []Event
+	ScrapeContext(context.Background(), []string{server.URL + "/observed"}, Options{
+		Observer: func(event Event) {
+			events = append(events, event)
+		},
+	})
+
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	expected := []EventType{EventTargetStarted, EventAddressFound, EventScriptFetched, EventAddressFound, EventTargetFinished}
+	if fmt.Sprint(types) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types)
+	}
+	if events[3].Address.Address != "0x5555555555555555555555555555555555555555" {
+		t.Errorf("Expected script address, got %+v", events[3].Address)
+	}
+	if events[4].Report.ScriptsFetched != 1 {
+		t.Errorf("Expected finished report with 1 fetched script, got %+v", events[4].Report)
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"backend/enrich"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type SourceInfo struct {
+	URL   string `json:"url"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// GroupedAddress aggregates every finding of one address regardless of case
+type GroupedAddress struct {
+	Address string `json:"address"`
+	// Variants lists the distinct spellings the address was found with
+	Variants []string `json:"variants"`
+	Count    int      `json:"count"`
+	// FirstSeen is the position of the address in discovery order
+	FirstSeen int          `json:"first_seen"`
+	Sources   []SourceInfo `json:"sources"`
+	Targets   []string     `json:"targets"`
+	Tags      []string     `json:"tags,omitempty"`
+	// Severity and Lookalikes are merged from every finding of the address
+	Severity   string                            `json:"severity,omitempty"`
+	Lookalikes []Lookalike                       `json:"lookalikes,omitempty"`
+	Chains     map[string]*enrich.Classification `json:"chains,omitempty"`
+	// Names are the ENS names found that resolved to the address
+	Names       []string `json:"names,omitempty"`
+	PrimaryName string   `json:"primary_name,omitempty"`
+}
+
+type GroupedPage struct {
+	Results    []GroupedAddress `json:"results"`
+	Total      int              `json:"total"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(address)
+}
+
+// GroupAddressInfos merges infos into one entry per normalized address, in the
+// order the addresses were first seen
+func GroupAddressInfos(infos []AddressInfo) []GroupedAddress {
+	var groups []GroupedAddress
+	index := make(map[string]int)
+
+	for _, info := range infos {
+		address := normalizeAddress(info.Address)
+		i, ok := index[address]
+		if !ok {
+			i = len(groups)
+			index[address] = i
+			groups = append(groups, GroupedAddress{
+				Address:   address,
+				Variants:  []string{},
+				FirstSeen: i,
+				Sources:   []SourceInfo{},
+				Targets:   []string{},
+			})
+		}
+		group := &groups[i]
+
+		count := info.Count
+		if count == 0 {
+			count = 1
+		}
+		group.Count += count
+
+		if !contains(group.Variants, info.Address) {
+			group.Variants = append(group.Variants, info.Address)
+		}
+
+		merged := false
+		for j := range group.Sources {
+			if group.Sources[j].URL == info.Src && group.Sources[j].Type == info.Type {
+				group.Sources[j].Count += count
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			group.Sources = append(group.Sources, SourceInfo{URL: info.Src, Type: info.Type, Count: count})
+		}
+
+		for _, target := range info.Targets {
+			if !contains(group.Targets, target) {
+				group.Targets = append(group.Targets, target)
+			}
+		}
+		for _, tag := range info.Tags {
+			if !contains(group.Tags, tag) {
+				group.Tags = append(group.Tags, tag)
+			}
+		}
+		if info.Severity != "" {
+			group.Severity = info.Severity
+		}
+		for _, lookalike := range info.Lookalikes {
+			if !slices.Contains(group.Lookalikes, lookalike) {
+				group.Lookalikes = append(group.Lookalikes, lookalike)
+			}
+		}
+		if info.Name != "" && !contains(group.Names, info.Name) {
+			group.Names = append(group.Names, info.Name)
+		}
+		if info.PrimaryName != "" {
+			group.PrimaryName = info.PrimaryName
+		}
+		for chain, classification := range info.Chains {
+			if group.Chains == nil {
+				group.Chains = make(map[string]*enrich.Classification)
+			}
+			group.Chains[chain] = classification
+		}
+	}
+
+	return groups
+}
+
+// ApplyGroupedQuery filters infos with q, groups them by address and returns
+// the page of groups selected by q. Sorting by src or type uses the first
+// source of each group.
+func ApplyGroupedQuery(infos []AddressInfo, q Query) (GroupedPage, error) {
+	if err := q.Validate(); err != nil {
+		return GroupedPage{}, err
+	}
+
+	groups := GroupAddressInfos(filterInfos(infos, q))
+	if less := groupSortFunc(q.Sort); less != nil {
+		sort.SliceStable(groups, func(i, j int) bool {
+			if q.Order == OrderDesc {
+				return less(groups[j], groups[i])
+			}
+			return less(groups[i], groups[j])
+		})
+	}
+
+	page := GroupedPage{Total: len(groups)}
+	page.Results, page.NextCursor = paginate(groups, q)
+	return page, nil
+}
+
+func groupSortFunc(field string) func(a, b GroupedAddress) bool {
+	switch field {
+	case SortAddress:
+		return func(a, b GroupedAddress) bool { return a.Address < b.Address }
+	case SortSrc:
+		return func(a, b GroupedAddress) bool { return a.Sources[0].URL < b.Sources[0].URL }
+	case SortType:
+		return func(a, b GroupedAddress) bool { return a.Sources[0].Type < b.Sources[0].Type }
+	case SortCount:
+		return func(a, b GroupedAddress) bool { return a.Count < b.Count }
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupAddressInfos(t *testing.T) {
+	infos := []AddressInfo{
+		{Address: "0xABCDEFabcdefABCDEFabcdefABCDEFabcdefABCD", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
+		{Address: "0x1111111111111111111111111111111111111111", Src: "https://example.com/a.js", Type: "script", Targets: []string{"https://example.com"}, Count: 1},
+		{Address: "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd", Src: "https://example.com/a.js", Type: "script", Targets: []string{"https://example.com"}, Count: 2},
+		{Address: "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd", Src: "https://example.com/a.js", Type: "script", Targets: []string{"https://example.com/page"}, Count: 1},
+	}
+
+	expected := []GroupedAddress{
+		{
+			Address:   "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd",
+			Variants:  []string{"0xABCDEFabcdefABCDEFabcdefABCDEFabcdefABCD", "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd"},
+			Count:     4,
+			FirstSeen: 0,
+			Sources: []SourceInfo{
+				{URL: "https://example.com", Type: "html", Count: 1},
+				{URL: "https://example.com/a.js", Type: "script", Count: 3},
+			},
+			Targets: []string{"https://example.com", "https://example.com/page"},
+		},
+		{
+			Address:   "0x1111111111111111111111111111111111111111",
+			Variants:  []string{"0x1111111111111111111111111111111111111111"},
+			Count:     1,
+			FirstSeen: 1,
+			Sources:   []SourceInfo{{URL: "https://example.com/a.js", Type: "script", Count: 1}},
+			Targets:   []string{"https://example.com"},
+		},
+	}
+
+	if result := GroupAddressInfos(infos); !reflect.DeepEqual(result, expected) {
+		t.Errorf("GroupAddressInfos() = %+v; expected %+v", result, expected)
+	}
+
+	page, err := ApplyGroupedQuery(infos, Query{Sort: SortCount, Limit: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.Total != 2 || len(page.Results) != 1 || page.Results[0].Count != 1 || page.NextCursor == "" {
+		t.Errorf("Unexpected grouped page: %+v", page)
+	}
+}
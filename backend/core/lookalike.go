@@ -0,0 +1,197 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	SeverityHigh = "high"
+	TagLookalike = "lookalike"
+
+	// Where the address a lookalike resembles comes from
+	LookalikeTrusted = "trusted"
+	LookalikeHistory = "history"
+
+	// Why an address is considered a lookalike
+	ReasonPrefixSuffix = "prefix_suffix"
+	ReasonEditDistance = "edit_distance"
+)
+
+// LookalikeRules decide when an address is a lookalike of another. Lengths
+// count hexadecimal characters after 0x.
+type LookalikeRules struct {
+	// PrefixLength and SuffixLength are how many leading and trailing
+	// characters must be equal
+	PrefixLength int
+	SuffixLength int
+	// VisiblePrefix and VisibleSuffix are the characters wallets commonly
+	// display, e.g. 0x1234ab…cdef. Addresses whose visible portions are at
+	// most MaxDistance edits apart are lookalikes too.
+	VisiblePrefix int
+	VisibleSuffix int
+	MaxDistance   int
+}
+
+var DefaultLookalikeRules = LookalikeRules{PrefixLength: 4, SuffixLength: 4, VisiblePrefix: 6, VisibleSuffix: 4, MaxDistance: 1}
+
+// Lookalike is an address that a found address resembles without being it
+type Lookalike struct {
+	Resembles string `json:"resembles"`
+	// Source is trusted or history
+	Source string `json:"source"`
+	// Target is the site the resembled address was seen on, for history
+	Target string `json:"target,omitempty"`
+	Reason string `json:"reason"`
+	// Distance is the edit distance between the visible portions
+	Distance int `json:"distance"`
+}
+
+// Resembles checks whether address is a lookalike of known, returning the
+// reason. Identical addresses, in any case, are not lookalikes.
+func (rules LookalikeRules) Resembles(address, known string) (reason string, distance int, ok bool) {
+	a, b := strings.ToLower(strings.TrimPrefix(address, "0x")), strings.ToLower(strings.TrimPrefix(known, "0x"))
+	if a == b || len(a) != 40 || len(b) != 40 {
+		return "", 0, false
+	}
+	distance = editDistance(a[:rules.VisiblePrefix]+a[40-rules.VisibleSuffix:], b[:rules.VisiblePrefix]+b[40-rules.VisibleSuffix:])
+	if a[:rules.PrefixLength] == b[:rules.PrefixLength] && a[40-rules.SuffixLength:] == b[40-rules.SuffixLength:] {
+		return ReasonPrefixSuffix, distance, true
+	}
+	if distance <= rules.MaxDistance {
+		return ReasonEditDistance, distance, true
+	}
+	return "", 0, false
+}
+
+// editDistance is the Levenshtein distance between two ASCII strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Function to flag the results resembling a trusted address or one seen on
+// their targets before. Trusted addresses are left alone, and addresses
+// known on their targets are only compared with the trusted ones.
+func (r *scrapeRun) flagLookalikes(ctx context.Context, results []AddressInfo) {
+	if len(r.opts.Trusted) == 0 && r.opts.KnownAddresses == nil {
+		return
+	}
+	trusted := make(map[string]bool)
+	for _, address := range r.opts.Trusted {
+		trusted[normalizeAddress(address)] = true
+	}
+	known := make(map[string]map[string]bool)
+	knownOn := func(target string) map[string]bool {
+		if addresses, ok := known[target]; ok {
+			return addresses
+		}
+		addresses := make(map[string]bool)
+		if r.opts.KnownAddresses != nil {
+			list, err := r.opts.KnownAddresses(ctx, target)
+			if err != nil {
+				log.Printf("Error loading known addresses of %s: %v", target, err)
+			}
+			for _, address := range list {
+				addresses[normalizeAddress(address)] = true
+			}
+		}
+		known[target] = addresses
+		return addresses
+	}
+
+	for i := range results {
+		info := &results[i]
+		address := normalizeAddress(info.Address)
+		if trusted[address] {
+			continue
+		}
+		var lookalikes []Lookalike
+		for candidate := range trusted {
+			if reason, distance, ok := DefaultLookalikeRules.Resembles(address, candidate); ok {
+				lookalikes = append(lookalikes, Lookalike{Resembles: candidate, Source: LookalikeTrusted, Reason: reason, Distance: distance})
+			}
+		}
+		// An address seen on its targets before is not compared with their
+		// history again, but still with the trusted addresses
+		var fromHistory []Lookalike
+		for _, target := range info.Targets {
+			addresses := knownOn(target)
+			if addresses[address] {
+				fromHistory = nil
+				break
+			}
+			for candidate := range addresses {
+				if reason, distance, ok := DefaultLookalikeRules.Resembles(address, candidate); ok {
+					fromHistory = append(fromHistory, Lookalike{Resembles: candidate, Source: LookalikeHistory, Target: target, Reason: reason, Distance: distance})
+				}
+			}
+		}
+		lookalikes = append(lookalikes, fromHistory...)
+		if len(lookalikes) == 0 {
+			continue
+		}
+		sortLookalikes(lookalikes)
+		info.Lookalikes = lookalikes
+		info.Severity = SeverityHigh
+		info.Tags = append(append([]string(nil), info.Tags...), TagLookalike)
+	}
+}
+
+func sortLookalikes(lookalikes []Lookalike) {
+	sort.Slice(lookalikes, func(i, j int) bool {
+		if lookalikes[i].Distance != lookalikes[j].Distance {
+			return lookalikes[i].Distance < lookalikes[j].Distance
+		}
+		if lookalikes[i].Resembles != lookalikes[j].Resembles {
+			return lookalikes[i].Resembles < lookalikes[j].Resembles
+		}
+		return lookalikes[i].Target < lookalikes[j].Target
+	})
+}
+
+// LoadTrustedAddresses reads a trusted address list, one address per line.
+// Blank lines and lines starting with # are skipped, and so is anything
+// after the address on a line, such as a label.
+func LoadTrustedAddresses(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addresses []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		address, err := NormalizeAddress(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, scanner.Err()
+}
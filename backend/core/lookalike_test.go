@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	genuine = "0x1234abcd00000000000000000000000000005678"
+	// vanity shares the first and last four characters of genuine
+	vanity = "0x1234ffffffffffffffffffffffffffffffff5678"
+)
+
+func TestResembles(t *testing.T) {
+	tests := []struct {
+		address, known string
+		reason         string
+		distance       int
+	}{
+		{vanity, genuine, ReasonPrefixSuffix, 2},
+		// One character off in the visible 0x1234ab…5678, outside of the first four
+		{"0x1244ab9999999999999999999999999999995678", genuine, ReasonEditDistance, 1},
+		{"0x1235abcd00000000000000000000000000005679", genuine, "", 0},
+		{"0x1234ABCD00000000000000000000000000005678", genuine, "", 0},
+		{"0x9999999999999999999999999999999999999999", genuine, "", 0},
+	}
+	for _, test := range tests {
+		reason, distance, ok := DefaultLookalikeRules.Resembles(test.address, test.known)
+		if reason != test.reason || (ok && distance != test.distance) || ok != (test.reason != "") {
+			t.Errorf("Resembles(%s, %s) = %q, %d, %v, expected %q, %d", test.address, test.known, reason, distance, ok, test.reason, test.distance)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"abc", "abd", 1},
+		{"abc", "ab", 1},
+		{"1234ab5678", "234ab56781", 2},
+	}
+	for _, test := range tests {
+		if distance := editDistance(test.a, test.b); distance != test.expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.a, test.b, distance, test.expected)
+		}
+	}
+}
+
+func TestScrapeFlagsLookalikes(t *testing.T) {
+	const other = "0x9999999999999999999999999999999999999999"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>Deposit to %s</p><p>Router %s</p><p>Fees %s</p>", vanity, genuine, other)
+	}))
+	defer server.Close()
+
+	trustedRouter := "0x9999aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa9999"
+	result := ScrapeContext(context.Background(), []string{server.URL}, Options{
+		Fresh:   true,
+		Trusted: []string{trustedRouter},
+		KnownAddresses: func(ctx context.Context, target string) ([]string, error) {
+			return []string{genuine}, nil
+		},
+	})
+	flagged := make(map[string]AddressInfo)
+	for _, info := range result.Results {
+		if info.Severity != "" {
+			flagged[info.Address] = info
+		}
+	}
+	if len(flagged) != 2 {
+		t.Fatalf("Expected the vanity and the fee addresses to be flagged, got %+v", result.Results)
+	}
+	info := flagged[vanity]
+	expected := Lookalike{Resembles: genuine, Source: LookalikeHistory, Target: server.URL, Reason: ReasonPrefixSuffix, Distance: 2}
+	if info.Severity != SeverityHigh || len(info.Lookalikes) != 1 || info.Lookalikes[0] != expected || !contains(info.Tags, TagLookalike) {
+		t.Errorf("Unexpected lookalike: %+v", info)
+	}
+	if info := flagged[other]; len(info.Lookalikes) != 1 || info.Lookalikes[0].Source != LookalikeTrusted {
+		t.Errorf("Expected %s to resemble the trusted router, got %+v", other, info)
+	}
+
+	// Without trusted or known addresses nothing is compared
+	for _, info := range ScrapeContext(context.Background(), []string{server.URL}, Options{Fresh: true}).Results {
+		if info.Severity != "" || len(info.Tags) != 0 {
+			t.Errorf("Expected no flags, got %+v", info)
+		}
+	}
+}
+
+func TestKnownLookalikesOfTrustedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>Deposit to %s</p>", vanity)
+	}))
+	defer server.Close()
+
+	// The second scrape finds the vanity address in the history of the first
+	var history []string
+	opts := Options{
+		Fresh:   true,
+		Trusted: []string{genuine},
+		KnownAddresses: func(ctx context.Context, target string) ([]string, error) {
+			return history, nil
+		},
+	}
+	for scrape := 1; scrape <= 2; scrape++ {
+		result := ScrapeContext(context.Background(), []string{server.URL}, opts)
+		if len(result.Results) != 1 {
+			t.Fatalf("Scrape %d: expected 1 result, got %+v", scrape, result.Results)
+		}
+		info := result.Results[0]
+		if info.Severity != SeverityHigh || len(info.Lookalikes) != 1 || info.Lookalikes[0].Source != LookalikeTrusted || info.Lookalikes[0].Resembles != genuine {
+			t.Errorf("Scrape %d: expected the trusted lookalike to be reported, got %+v", scrape, info)
+		}
+		history = []string{vanity}
+	}
+}
+
+func TestLoadTrustedAddresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	os.WriteFile(path, []byte("# Treasury\n0x1234ABCD00000000000000000000000000005678 treasury\n\n"), 0o644)
+	addresses, err := LoadTrustedAddresses(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(addresses) != 1 || addresses[0] != genuine {
+		t.Errorf("Expected the lowercased treasury address, got %v", addresses)
+	}
+
+	os.WriteFile(path, []byte("0x1234\n"), 0o644)
+	if _, err := LoadTrustedAddresses(path); err == nil {
+		t.Error("Expected an error for an invalid address")
+	}
+}
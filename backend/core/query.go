@@ -0,0 +1,164 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	SortAddress = "address"
+	SortSrc     = "src"
+	SortType    = "type"
+	SortCount   = "count"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+
+	ShapeFlat    = "flat"
+	ShapeGrouped = "grouped"
+)
+
+// Query sorts, filters and paginates scrape results. The zero value keeps
+// every result in the order it was first seen.
+type Query struct {
+	Sort       string `json:"sort" form:"sort"`
+	Order      string `json:"order" form:"order"`
+	Type       string `json:"type" form:"type"`
+	Target     string `json:"target" form:"target"`
+	SourceHost string `json:"source_host" form:"source_host"`
+	Tag        string `json:"tag" form:"tag"`
+	Limit      int    `json:"limit" form:"limit"`
+	Cursor     string `json:"cursor" form:"cursor"`
+	// Shape selects between the flat results and one entry per address
+	Shape string `json:"shape" form:"shape"`
+}
+
+type Page struct {
+	Results    []AddressInfo `json:"results"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Validate reports whether q can be applied, so callers can reject it early
+func (q Query) Validate() error {
+	if _, err := sortFunc(q.Sort); err != nil {
+		return err
+	}
+	if q.Order != "" && q.Order != OrderAsc && q.Order != OrderDesc {
+		return fmt.Errorf("invalid order %q, expected %q or %q", q.Order, OrderAsc, OrderDesc)
+	}
+	if q.Shape != "" && q.Shape != ShapeFlat && q.Shape != ShapeGrouped {
+		return fmt.Errorf("invalid shape %q, expected %q or %q", q.Shape, ShapeFlat, ShapeGrouped)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("invalid limit %d", q.Limit)
+	}
+	_, err := decodeCursor(q.Cursor)
+	return err
+}
+
+// ApplyQuery returns the page of infos selected by q
+func ApplyQuery(infos []AddressInfo, q Query) (Page, error) {
+	if err := q.Validate(); err != nil {
+		return Page{}, err
+	}
+	less, _ := sortFunc(q.Sort)
+
+	filtered := filterInfos(infos, q)
+	if less != nil {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			if q.Order == OrderDesc {
+				return less(filtered[j], filtered[i])
+			}
+			return less(filtered[i], filtered[j])
+		})
+	}
+
+	page := Page{Total: len(filtered)}
+	page.Results, page.NextCursor = paginate(filtered, q)
+	return page, nil
+}
+
+func filterInfos(infos []AddressInfo, q Query) []AddressInfo {
+	var filtered []AddressInfo
+	for _, info := range infos {
+		if matchesQuery(info, q) {
+			filtered = append(filtered, info)
+		}
+	}
+	return filtered
+}
+
+// Function to cut the page selected by q.Cursor and q.Limit out of items
+func paginate[T any](items []T, q Query) ([]T, string) {
+	offset, _ := decodeCursor(q.Cursor)
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := len(items)
+	var nextCursor string
+	if q.Limit > 0 && offset+q.Limit < end {
+		end = offset + q.Limit
+		nextCursor = encodeCursor(end)
+	}
+	return items[offset:end], nextCursor
+}
+
+func sortFunc(field string) (func(a, b AddressInfo) bool, error) {
+	switch field {
+	case "":
+		return nil, nil
+	case SortAddress:
+		return func(a, b AddressInfo) bool { return strings.ToLower(a.Address) < strings.ToLower(b.Address) }, nil
+	case SortSrc:
+		return func(a, b AddressInfo) bool { return a.Src < b.Src }, nil
+	case SortType:
+		return func(a, b AddressInfo) bool { return a.Type < b.Type }, nil
+	case SortCount:
+		return func(a, b AddressInfo) bool { return a.Count < b.Count }, nil
+	}
+	return nil, fmt.Errorf("invalid sort %q, expected one of address, src, type or count", field)
+}
+
+func matchesQuery(info AddressInfo, q Query) bool {
+	if q.Type != "" && info.Type != q.Type {
+		return false
+	}
+	if q.Target != "" && !contains(info.Targets, q.Target) {
+		return false
+	}
+	if q.SourceHost != "" {
+		srcURL, err := url.Parse(info.Src)
+		if err != nil || !strings.EqualFold(srcURL.Hostname(), q.SourceHost) {
+			return false
+		}
+	}
+	if q.Tag != "" && !contains(info.Tags, q.Tag) {
+		return false
+	}
+	return true
+}
+
+// Cursors are opaque to clients but simply encode the offset of the next page
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
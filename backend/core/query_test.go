@@ -0,0 +1,94 @@
+package core
+
+import (
+	"testing"
+)
+
+func addressesOf(infos []AddressInfo) []string {
+	var addresses []string
+	for _, info := range infos {
+		addresses = append(addresses, info.Address)
+	}
+	return addresses
+}
+
+func TestApplyQuery(t *testing.T) {
+	infos := []AddressInfo{
+		{Address: "0xcccccccccccccccccccccccccccccccccccccccc", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
+		{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Src: "https://cdn.example.com/app.js", Type: "script", Targets: []string{"https://example.com"}, Count: 3, Tags: []string{"contract"}},
+		{Address: "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Src: "https://other.com", Type: "html", Targets: []string{"https://other.com"}, Count: 2},
+	}
+
+	tests := []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{}, []string{infos[0].Address, infos[1].Address, infos[2].Address}},
+		{Query{Sort: SortAddress}, []string{infos[1].Address, infos[2].Address, infos[0].Address}},
+		{Query{Sort: SortCount, Order: OrderDesc}, []string{infos[1].Address, infos[2].Address, infos[0].Address}},
+		{Query{Type: "html"}, []string{infos[0].Address, infos[2].Address}},
+		{Query{Target: "https://other.com"}, []string{infos[2].Address}},
+		{Query{SourceHost: "cdn.example.com"}, []string{infos[1].Address}},
+		{Query{Tag: "contract"}, []string{infos[1].Address}},
+	}
+
+	for _, test := range tests {
+		page, err := ApplyQuery(infos, test.query)
+		if err != nil {
+			t.Errorf("ApplyQuery(%+v) returned error: %v", test.query, err)
+			continue
+		}
+		if result := addressesOf(page.Results); !equalStrings(result, test.expected) {
+			t.Errorf("ApplyQuery(%+v) = %v; expected %v", test.query, result, test.expected)
+		}
+	}
+}
+
+func TestApplyQueryPagination(t *testing.T) {
+	infos := []AddressInfo{
+		{Address: "0x1111111111111111111111111111111111111111"},
+		{Address: "0x2222222222222222222222222222222222222222"},
+		{Address: "0x3333333333333333333333333333333333333333"},
+	}
+
+	var pages [][]string
+	query := Query{Limit: 2}
+	for {
+		page, err := ApplyQuery(infos, query)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if page.Total != 3 {
+			t.Errorf("Expected total of 3, got %d", page.Total)
+		}
+		pages = append(pages, addressesOf(page.Results))
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if len(pages) != 2 || len(pages[0]) != 2 || len(pages[1]) != 1 || pages[1][0] != infos[2].Address {
+		t.Errorf("Unexpected pages: %v", pages)
+	}
+}
+
+func TestApplyQueryInvalid(t *testing.T) {
+	for _, query := range []Query{{Sort: "nope"}, {Order: "sideways"}, {Cursor: "!!"}, {Limit: -1}} {
+		if _, err := ApplyQuery(nil, query); err == nil {
+			t.Errorf("Expected error for %+v", query)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
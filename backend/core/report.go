@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+type ErrorCategory string
+
+const (
+	ErrorDNS         ErrorCategory = "dns"
+	ErrorTimeout     ErrorCategory = "timeout"
+	ErrorTLS         ErrorCategory = "tls"
+	ErrorTooLarge    ErrorCategory = "too_large"
+	ErrorBlacklisted ErrorCategory = "blacklisted"
+	ErrorInvalidURL  ErrorCategory = "invalid_url"
+	ErrorConnection  ErrorCategory = "connection"
+	ErrorCanceled    ErrorCategory = "canceled"
+	ErrorCircuitOpen ErrorCategory = "circuit_open"
+	ErrorHTTPStatus  ErrorCategory = "http_status"
+	ErrorOther       ErrorCategory = "other"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+
+	ScriptFetched = "fetched"
+	ScriptCached  = "cached"
+	ScriptSkipped = "skipped"
+	ScriptError   = "error"
+
+	SkipBlacklisted = "blacklisted"
+	SkipThirdParty  = "third_party"
+)
+
+var (
+	errContentTooLarge = errors.New("content exceeds maximum size of 20MB")
+	errBlacklisted     = errors.New("hostname is blacklisted")
+	errInvalidURL      = errors.New("invalid URL")
+)
+
+// httpStatusError is a response whose status is not 2xx, nor a 304 to a
+// conditional request
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// serverSide tells whether the status says the host itself is unhealthy
+func (e *httpStatusError) serverSide() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Function to get the HTTP status an error was caused by, 0 if none
+func httpStatusOf(err error) int {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+type ScrapeError struct {
+	Category ErrorCategory `json:"category"`
+	Message  string        `json:"message"`
+}
+
+type ScriptReport struct {
+	URL         string       `json:"url"`
+	Status      string       `json:"status"`
+	SkipReason  string       `json:"skip_reason,omitempty"`
+	HTTPCode    int          `json:"http_code,omitempty"`
+	Bytes       int          `json:"bytes"`
+	ContentHash string       `json:"content_hash,omitempty"`
+	Addresses   int          `json:"addresses"`
+	Error       *ScrapeError `json:"error,omitempty"`
+	Shared      bool         `json:"shared,omitempty"`
+	// Unchanged is set when a conditional request found the script not modified
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+type TargetReport struct {
+	Target         string         `json:"target"`
+	Status         string         `json:"status"`
+	Cached         bool           `json:"cached"`
+	HTTPCode       int            `json:"http_code,omitempty"`
+	Bytes          int            `json:"bytes"`
+	DurationMs     int64          `json:"duration_ms"`
+	Addresses      int            `json:"addresses"`
+	ScriptsFound   int            `json:"scripts_found"`
+	ScriptsFetched int            `json:"scripts_fetched"`
+	ScriptsSkipped int            `json:"scripts_skipped"`
+	ScriptsFailed  int            `json:"scripts_failed"`
+	Scripts        []ScriptReport `json:"scripts"`
+	Error          *ScrapeError   `json:"error,omitempty"`
+	// Shared is set when the target was fetched once for several concurrent scrapes
+	Shared bool `json:"shared,omitempty"`
+	// Unchanged is set when a conditional request found the page not modified
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+type ScrapeResult struct {
+	Results []AddressInfo  `json:"results"`
+	Report  []TargetReport `json:"report"`
+	// Partial is set when the scrape was cancelled before every target finished
+	Partial bool `json:"partial"`
+}
+
+// AllFailed reports whether no target could be scraped at all
+func (r ScrapeResult) AllFailed() bool {
+	for _, report := range r.Report {
+		if report.Status == StatusOK {
+			return false
+		}
+	}
+	return len(r.Report) > 0
+}
+
+// Function to map a fetch error onto one of the reported error categories
+func classifyError(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+	var urlErr *url.Error
+	var cached *cachedFailure
+	var statusErr *httpStatusError
+
+	switch {
+	case errors.As(err, &cached):
+		return cached.Category
+	case errors.As(err, &statusErr):
+		return ErrorHTTPStatus
+	case errors.Is(err, errCircuitOpen):
+		return ErrorCircuitOpen
+	case errors.Is(err, errBlacklisted):
+		return ErrorBlacklisted
+	case errors.Is(err, errContentTooLarge):
+		return ErrorTooLarge
+	case errors.Is(err, errInvalidURL):
+		return ErrorInvalidURL
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCertErr):
+		return ErrorTLS
+	case errors.As(err, &urlErr):
+		return ErrorConnection
+	}
+	return ErrorOther
+}
+
+// Function to attach the reason ctx was cancelled to an error it caused, so a
+// deadline passed on through a shared fetch is still reported as a timeout
+func withCause(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w (%w)", err, cause)
+}
+
+func newScrapeError(err error) *ScrapeError {
+	return &ScrapeError{
+		Category: classifyError(err),
+		Message:  err.Error(),
+	}
+}
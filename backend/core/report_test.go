@@ -0,0 +1,41 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected ErrorCategory
+	}{
+		{fmt.Errorf("wrapped: %w", errBlacklisted), ErrorBlacklisted},
+		{errContentTooLarge, ErrorTooLarge},
+		{&url.Error{Op: "Get", URL: "https://nx.example", Err: &net.DNSError{Err: "no such host", Name: "nx.example"}}, ErrorDNS},
+		{&url.Error{Op: "Get", URL: "https://slow.example", Err: context.DeadlineExceeded}, ErrorTimeout},
+		{&url.Error{Op: "Get", URL: "https://down.example", Err: &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}}, ErrorConnection},
+		{fmt.Errorf("something else"), ErrorOther},
+	}
+
+	for _, test := range tests {
+		if result := classifyError(test.err); result != test.expected {
+			t.Errorf("classifyError(%v) = %s; expected %s", test.err, result, test.expected)
+		}
+	}
+}
+
+func TestAllFailed(t *testing.T) {
+	result := ScrapeResult{Report: []TargetReport{{Status: StatusError}, {Status: StatusError}}}
+	if !result.AllFailed() {
+		t.Error("Expected AllFailed to be true when every target failed")
+	}
+
+	result.Report[1].Status = StatusOK
+	if result.AllFailed() {
+		t.Error("Expected AllFailed to be false when one target succeeded")
+	}
+}
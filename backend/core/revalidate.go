@@ -0,0 +1,114 @@
+package core
+
+import (
+	"backend/cache"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+const (
+	// resourceCacheTTL is how long validators are kept, well past the target and script caches
+	resourceCacheTTL   = 24 * time.Hour
+	resourceCacheBytes = 32 * 1024 * 1024
+)
+
+// resourceCache keeps the validators and findings of pages and scripts that
+// sent an ETag or Last-Modified header, so they can be revalidated later
+var resourceCache = newResourceCache()
+
+func newResourceCache() *cache.Memory[string, *resource] {
+	c := cache.NewWeightedMemory[string, *resource](maxCacheSize, resourceCacheBytes, resourceCacheTTL, weighResource)
+	c.StartJanitor(10 * time.Minute)
+	return c
+}
+
+// validators are the response headers a conditional request is built from
+type validators struct {
+	ETag         string
+	LastModified string
+}
+
+func (v validators) empty() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// resource is what was extracted from a page or script, along with the
+// validators of the response it came from
+type resource struct {
+	validators
+	StatusCode  int
+	Bytes       int
+	ContentHash string
+	Addresses   []string
+	Contexts    []string
+	// Names are the .eth names found on a page, with the text around them
+	Names        []string
+	NameContexts []string
+	// Scripts are the script sources of a page
+	Scripts []string
+}
+
+// Function to fetch a page or script and extract its findings. When an
+// earlier response carried validators the request is conditional, and on 304
+// Not Modified the previous findings are returned with unchanged set.
+func (r *scrapeRun) fetchResource(ctx context.Context, resourceURL string, page bool) (res *resource, unchanged bool, err error) {
+	key := normalizeURL(resourceURL)
+	previous, _ := resourceCache.Get(key)
+
+	var conditional validators
+	if previous != nil {
+		conditional = previous.validators
+	}
+	fetched, err := r.fetch(ctx, resourceURL, conditional)
+	if err != nil {
+		return nil, false, err
+	}
+	if fetched.StatusCode == http.StatusNotModified && previous != nil {
+		// Keep the validators around for another day
+		resourceCache.Set(key, previous)
+		return previous, true, nil
+	}
+
+	hash := sha256.Sum256([]byte(fetched.Body))
+	res = &resource{
+		validators:  fetched.validators,
+		StatusCode:  fetched.StatusCode,
+		Bytes:       len(fetched.Body),
+		ContentHash: hex.EncodeToString(hash[:]),
+	}
+	res.Addresses, res.Contexts = findMatches(fetched.Body)
+	if page {
+		res.Names, res.NameContexts = findNames(fetched.Body)
+		res.Scripts = extractScripts(fetched.Body)
+	}
+
+	if res.validators.empty() {
+		resourceCache.Delete(key)
+	} else {
+		resourceCache.Set(key, res)
+	}
+	return res, false, nil
+}
+
+func weighResource(res *resource) int64 {
+	weight := int64(entryOverhead + len(res.ETag) + len(res.LastModified) + len(res.ContentHash))
+	for _, address := range res.Addresses {
+		weight += int64(len(address)) + 16
+	}
+	for _, context := range res.Contexts {
+		weight += int64(len(context)) + 16
+	}
+	for _, name := range res.Names {
+		weight += int64(len(name)) + 16
+	}
+	for _, context := range res.NameContexts {
+		weight += int64(len(context)) + 16
+	}
+	for _, script := range res.Scripts {
+		weight += int64(len(script)) + 16
+	}
+	return weight
+}
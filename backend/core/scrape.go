@@ -2,38 +2,58 @@ package core
 
 import (
 	"backend/cache"
+	"backend/enrich"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/weppos/publicsuffix-go/publicsuffix"
 	"golang.org/x/net/html"
 )
 
-const maxCacheSize = 1000
-
-var (
-	targetCache = cache.NewFixedSizeCache(maxCacheSize)
-	scriptCache = cache.NewFixedSizeCache(maxCacheSize)
-)
-
 type AddressInfo struct {
 	Address string   `json:"address"`
 	Src     string   `json:"src"`
 	Type    string   `json:"type"`
 	Targets []string `json:"targets"`
+	// Count is the number of times the address occurs in Src, summed over
+	// Targets when a script is shared by several of them
+	Count int      `json:"count"`
+	Tags  []string `json:"tags,omitempty"`
+	// Context is the text around the first occurrence of the address in Src
+	Context string `json:"context,omitempty"`
+	// Severity is high for lookalikes of trusted or previously seen addresses
+	Severity   string      `json:"severity,omitempty"`
+	Lookalikes []Lookalike `json:"lookalikes,omitempty"`
+	// Chains holds what the address is on each chain it was enriched on
+	Chains map[string]*enrich.Classification `json:"chains,omitempty"`
+	// Name is the ENS name found in Src that resolved to Address
+	Name string `json:"name,omitempty"`
+	// PrimaryName is the ENS name Address claims in its reverse record, when
+	// that name resolves back to Address
+	PrimaryName string `json:"primary_name,omitempty"`
 }
 
 const (
 	userAgent      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36"
 	maxContentSize = 20 * 1024 * 1024 // 20MB in bytes
+	// contextRadius is the number of bytes kept on each side of an address as its context
+	contextRadius = 40
+	// postProcessTimeout bounds the ENS lookups and enrichment of the results
+	// of a scrape together
+	postProcessTimeout = 30 * time.Second
+	// postProcessGrace is what is left for them once the scrape timed out
+	postProcessGrace = 5 * time.Second
 )
 
 // Function to extract script URLs from HTML content
@@ -61,6 +81,33 @@ func extractScripts(htmlContent string) []string {
 	return scripts
 }
 
+// Function to normalize a URL into a cache and coalescing key: the scheme and
+// host are lowercased, default ports and fragments dropped
+func normalizeURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	parsed.Host = host
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String()
+}
+
 // Function to resolve full script URL
 func resolveURL(base, ref string) (string, error) {
 	baseURL, err := url.Parse(base)
@@ -79,87 +126,120 @@ func resolveURL(base, ref string) (string, error) {
 	return baseURL.ResolveReference(refURL).String(), nil
 }
 
-// Function to fetch script content
-func fetchScriptContent(scriptURL string) (string, error) {
-	client := &http.Client{
-		Timeout: 3 * time.Second,
-	}
-	req, err := http.NewRequest("GET", scriptURL, nil)
+var httpClient = &http.Client{
+	Timeout: 3 * time.Second,
+}
+
+type fetchResult struct {
+	Body       string
+	StatusCode int
+	validators
+}
+
+// Function to fetch the content of a target page or script. Non-empty
+// validators make the request conditional. Responses other than 2xx, or 304
+// to a conditional request, are returned as an httpStatusError.
+func fetchContent(ctx context.Context, targetURL string, conditional validators) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %v", errInvalidURL, err)
 	}
 	req.Header.Set("User-Agent", userAgent)
+	if conditional.ETag != "" {
+		req.Header.Set("If-None-Match", conditional.ETag)
+	}
+	if conditional.LastModified != "" {
+		req.Header.Set("If-Modified-Since", conditional.LastModified)
+	}
 
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	notModified := resp.StatusCode == http.StatusNotModified && !conditional.empty()
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && !notModified {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
 	limitedReader := io.LimitReader(resp.Body, maxContentSize)
 	body, err := io.ReadAll(limitedReader)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if len(body) >= maxContentSize {
-		return "", errors.New("content exceeds maximum size of 20MB")
+		return nil, errContentTooLarge
 	}
 
-	return string(body), nil
+	return &fetchResult{
+		Body:       string(body),
+		StatusCode: resp.StatusCode,
+		validators: validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")},
+	}, nil
 }
 
-// Function to fetch HTML content
-func fetchHTMLContent(targetURL string) (string, error) {
-	client := &http.Client{
-		Timeout: 3 * time.Second,
-	}
-	req, err := http.NewRequest("GET", targetURL, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", userAgent)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+var addressPattern = regexp.MustCompile(`0x[0-9a-fA-F]{40}`)
 
-	limitedReader := io.LimitReader(resp.Body, maxContentSize)
-	body, err := io.ReadAll(limitedReader)
-	if err != nil {
-		return "", err
-	}
+// Function to find addresses matching the regex pattern
+func findAddressInfos(content, src, contentType, target string) []AddressInfo {
+	matches, contexts := findMatches(content)
+	return addressInfosFromMatches(matches, contexts, src, contentType, target)
+}
 
-	if len(body) >= maxContentSize {
-		return "", errors.New("content exceeds maximum size of 20MB")
+// Function to find the addresses in content along with the text around each of them
+func findMatches(content string) (matches, contexts []string) {
+	for _, loc := range addressPattern.FindAllStringIndex(content, -1) {
+		matches = append(matches, content[loc[0]:loc[1]])
+		contexts = append(contexts, contextSnippet(content, loc[0], loc[1]))
 	}
+	return matches, contexts
+}
 
-	return string(body), nil
+// Function to cut the text around content[start:end] with whitespace collapsed
+func contextSnippet(content string, start, end int) string {
+	from := max(0, start-contextRadius)
+	to := min(len(content), end+contextRadius)
+	// Don't cut a multi-byte character in half
+	for from > 0 && !utf8.RuneStart(content[from]) {
+		from--
+	}
+	for to < len(content) && !utf8.RuneStart(content[to]) {
+		to++
+	}
+	return strings.Join(strings.Fields(content[from:to]), " ")
 }
 
-// Function to find addresses matching the regex pattern
-func findAddressInfos(content, src, contentType, target string) []AddressInfo {
-	re := regexp.MustCompile(`0x[0-9a-fA-F]{40}`)
-	matches := re.FindAllString(content, -1)
+// Function to turn matches into AddressInfos. contexts may be shorter than
+// matches, e.g. for scripts cached before contexts were kept.
+func addressInfosFromMatches(matches, contexts []string, src, contentType, target string) []AddressInfo {
 	var addressInfos []AddressInfo
-	for _, match := range matches {
-		addressInfos = append(addressInfos, AddressInfo{
+	for i, match := range matches {
+		info := AddressInfo{
 			Address: match,
 			Src:     src,
 			Type:    contentType,
 			Targets: []string{target},
-		})
+			Count:   1,
+		}
+		if i < len(contexts) {
+			info.Context = contexts[i]
+		}
+		addressInfos = append(addressInfos, info)
 	}
 	return addressInfos
 }
 
-// Function to ensure addressInfos are unique by address, src, and type, and targets are unique
+// Function to ensure addressInfos are unique by address, src, and type, and targets are unique.
+// The result keeps the order in which each address was first seen.
 func uniqueAddressInfos(addressInfos []AddressInfo) []AddressInfo {
 	seen := make(map[string]AddressInfo)
+	var keys []string
 	for _, info := range addressInfos {
-		key := info.Address + info.Src + info.Type
+		key := info.Address + info.Name + info.Src + info.Type
 		if existing, ok := seen[key]; ok {
+			existing.Count += info.Count
 			targetMap := make(map[string]bool)
 			for _, t := range existing.Targets {
 				targetMap[t] = true
@@ -173,11 +253,12 @@ func uniqueAddressInfos(addressInfos []AddressInfo) []AddressInfo {
 			seen[key] = existing
 		} else {
 			seen[key] = info
+			keys = append(keys, key)
 		}
 	}
 	var unique []AddressInfo
-	for _, info := range seen {
-		unique = append(unique, info)
+	for _, key := range keys {
+		unique = append(unique, seen[key])
 	}
 	return unique
 }
@@ -206,136 +287,313 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+type targetEntry struct {
+	Infos  []AddressInfo
+	Report TargetReport
+}
+
+// Options tunes a single ScrapeContext call
+type Options struct {
+	// Observer, when set, receives an Event as targets and scripts are
+	// processed. Calls are never concurrent.
+	Observer func(event Event)
+	// Fresh bypasses cached targets and scripts. Fresh results still refill the cache.
+	Fresh bool
+	// Trusted are addresses the scraped sites are expected to use, results
+	// resembling them are flagged as lookalikes
+	Trusted []string
+	// KnownAddresses, when set, returns the addresses found on target by
+	// earlier scrapes. New results resembling them are flagged as lookalikes.
+	KnownAddresses func(ctx context.Context, target string) ([]string, error)
+	// Enrich lists the chains results are classified on as EOAs, contracts
+	// or ERC-20 tokens, using Enricher or enrich.Default() when it is nil
+	Enrich   []string
+	Enricher *enrich.Enricher
+	// EnrichImplementations classifies the implementation of the proxies
+	// found while enriching as well
+	EnrichImplementations bool
+	// ENS resolves the .eth names found on pages into results and looks up
+	// the primary ENS name of every result, on the ethereum chain of Enricher
+	ENS bool
+}
+
+// scrapeRun carries the per-call state shared by the helpers of ScrapeContext
+type scrapeRun struct {
+	opts     Options
+	observer *observer
+}
+
 func Scrape(targets []string) ([]AddressInfo, error) {
+	return ScrapeWithReport(targets).Results, nil
+}
+
+// ScrapeWithReport scrapes every target and returns the unique addresses
+// together with a per-target report of what was fetched, skipped or failed
+func ScrapeWithReport(targets []string) ScrapeResult {
+	return ScrapeContext(context.Background(), targets, Options{})
+}
+
+// ScrapeContext is ScrapeWithReport bound to ctx. Once ctx is cancelled or
+// its deadline passes, in-flight fetches are aborted, remaining targets are
+// reported as failed and the addresses gathered so far are returned with
+// Partial set.
+func ScrapeContext(ctx context.Context, targets []string, opts Options) ScrapeResult {
 	var allAddressInfos []AddressInfo
+	reports := make([]TargetReport, 0, len(targets))
+	run := &scrapeRun{opts: opts, observer: newObserver(opts.Observer)}
 
 	for _, target := range targets {
-		addressInfos, err := scrapeTarget(target)
-		if err != nil {
-			log.Printf("Error scraping target %s: %v", target, err)
-			continue
+		var addressInfos []AddressInfo
+		var report TargetReport
+		if err := ctx.Err(); err != nil {
+			report = TargetReport{Target: target, Status: StatusError, Scripts: []ScriptReport{}, Error: newScrapeError(err)}
+		} else {
+			run.observer.emit(Event{Type: EventTargetStarted, Target: target})
+			addressInfos, report = run.scrapeTarget(ctx, target)
 		}
+		if report.Error != nil {
+			log.Printf("Error scraping target %s: %v", target, report.Error.Message)
+		}
+		run.observer.emit(Event{Type: EventTargetFinished, Target: target, Report: &report})
+		reports = append(reports, report)
 		allAddressInfos = append(allAddressInfos, addressInfos...)
 	}
 
-	return uniqueAddressInfos(allAddressInfos), nil
+	results := uniqueAddressInfos(allAddressInfos)
+	post, cancel := postProcessContext(ctx)
+	defer cancel()
+	results = run.resolveENS(post, results)
+	run.flagLookalikes(context.WithoutCancel(ctx), results)
+	run.enrich(post, results)
+	return ScrapeResult{
+		Results: results,
+		Report:  reports,
+		Partial: ctx.Err() != nil,
+	}
 }
 
-func scrapeTarget(target string) ([]AddressInfo, error) {
-	if cachedResult, ok := targetCache.Get(target); ok {
-		return cachedResult.([]AddressInfo), nil
+// Function to derive the context ENS lookups and enrichment run in from the
+// one of the scrape. They share what is left of its deadline, at most
+// postProcessTimeout. A scrape that timed out still gets postProcessGrace,
+// one cancelled by its caller an already cancelled context.
+func postProcessContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return context.WithTimeout(context.WithoutCancel(ctx), postProcessGrace)
 	}
+	return context.WithTimeout(ctx, postProcessTimeout)
+}
 
-	content, err := fetchHTMLContent(target)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data from %s: %v", target, err)
+func (r *scrapeRun) scrapeTarget(ctx context.Context, target string) ([]AddressInfo, TargetReport) {
+	start := time.Now()
+
+	entry, origin, err := targetLoader.Load(ctx, normalizeURL(target), r.opts.Fresh, func(ctx context.Context) (targetEntry, error) {
+		return r.loadTarget(ctx, target)
+	})
+	report := entry.Report
+	if err != nil && report.Error == nil {
+		// Gave up waiting on a fetch shared with another scrape
+		report = TargetReport{Target: target, Status: StatusError, Scripts: []ScriptReport{}, Error: newScrapeError(withCause(ctx, err))}
+	}
+	report.Cached = origin == cache.Cached
+	report.Shared = origin == cache.Shared
+	report.DurationMs = time.Since(start).Milliseconds()
+	if origin != cache.Loaded {
+		r.observer.addressesFound(target, entry.Infos)
 	}
+	return entry.Infos, report
+}
 
-	addressInfos := findAddressInfos(content, target, "html", target)
-	scripts := extractScripts(content)
+// loadTarget fetches target and its scripts. A failed target is returned as
+// an entry holding the failure report along with the error.
+func (r *scrapeRun) loadTarget(ctx context.Context, target string) (targetEntry, error) {
+	start := time.Now()
+	report := TargetReport{Target: target, Status: StatusError, Scripts: []ScriptReport{}}
+	fail := func(err error) (targetEntry, error) {
+		err = withCause(ctx, err)
+		report.Error = newScrapeError(err)
+		report.HTTPCode = httpStatusOf(err)
+		report.DurationMs = time.Since(start).Milliseconds()
+		return targetEntry{Report: report}, err
+	}
 
-	scriptInfos, err := processScripts(target, scripts)
+	targetTLD, err := getTLD(target)
 	if err != nil {
-		return nil, err
+		return fail(err)
 	}
 
-	addressInfos = append(addressInfos, scriptInfos...)
-
-	targetCache.Set(target, addressInfos)
+	page, unchanged, err := r.fetchResource(ctx, target, true)
+	if err != nil {
+		return fail(fmt.Errorf("failed to fetch data from %s: %w", target, err))
+	}
+	report.HTTPCode = page.StatusCode
+	if unchanged {
+		report.HTTPCode = http.StatusNotModified
+	}
+	report.Unchanged = unchanged
+	report.Bytes = page.Bytes
 
-	return addressInfos, nil
-}
+	addressInfos := addressInfosFromMatches(page.Addresses, page.Contexts, target, "html", target)
+	r.observer.addressesFound(target, addressInfos)
+	scripts := page.Scripts
 
-func processScripts(target string, scripts []string) ([]AddressInfo, error) {
-	targetTLD, err := getTLD(target)
-	if err != nil {
-		return nil, err
+	scriptInfos, scriptReports := r.processScripts(ctx, target, scripts, targetTLD)
+	addressInfos = append(addressInfos, scriptInfos...)
+	nameInfos := nameInfosFromMatches(page.Names, page.NameContexts, target, "html", target)
+
+	report.Status = StatusOK
+	report.Addresses = len(addressInfos)
+	report.ScriptsFound = len(scripts)
+	report.Scripts = scriptReports
+	for _, scriptReport := range scriptReports {
+		switch scriptReport.Status {
+		case ScriptFetched, ScriptCached:
+			report.ScriptsFetched++
+		case ScriptSkipped:
+			report.ScriptsSkipped++
+		case ScriptError:
+			report.ScriptsFailed++
+		}
 	}
+	report.DurationMs = time.Since(start).Milliseconds()
 
+	return targetEntry{Infos: append(addressInfos, nameInfos...), Report: report}, nil
+}
+
+func (r *scrapeRun) processScripts(ctx context.Context, target string, scripts []string, targetTLD string) ([]AddressInfo, []ScriptReport) {
 	var wg sync.WaitGroup
-	scriptInfosChan := make(chan []AddressInfo, len(scripts))
+	var allScriptInfos []AddressInfo
+	scriptReports := make([]ScriptReport, len(scripts))
+	scriptInfos := make([][]AddressInfo, len(scripts))
 
-	for _, script := range scripts {
+	for i, script := range scripts {
 		wg.Add(1)
-		go func(script string) {
+		go func(i int, script string) {
 			defer wg.Done()
-			scriptInfos, err := processScript(target, script, targetTLD)
-			if err != nil {
-				log.Printf("Error processing script %s: %v", script, err)
-				return
+			infos, report := r.processScript(ctx, target, script, targetTLD)
+			if report.Error != nil {
+				log.Printf("Error processing script %s: %v", script, report.Error.Message)
 			}
-			scriptInfosChan <- scriptInfos
-		}(script)
+			scriptInfos[i] = infos
+			scriptReports[i] = report
+		}(i, script)
 	}
+	wg.Wait()
 
-	go func() {
-		wg.Wait()
-		close(scriptInfosChan)
-	}()
-
-	var allScriptInfos []AddressInfo
-	for scriptInfos := range scriptInfosChan {
-		allScriptInfos = append(allScriptInfos, scriptInfos...)
+	for _, infos := range scriptInfos {
+		allScriptInfos = append(allScriptInfos, infos...)
 	}
 
-	return allScriptInfos, nil
+	return allScriptInfos, scriptReports
 }
 
-func processScript(target, script, targetTLD string) ([]AddressInfo, error) {
+func (r *scrapeRun) processScript(ctx context.Context, target, script, targetTLD string) ([]AddressInfo, ScriptReport) {
+	report := ScriptReport{URL: script, Status: ScriptError}
+	fail := func(err error) ([]AddressInfo, ScriptReport) {
+		report.Error = newScrapeError(withCause(ctx, err))
+		report.HTTPCode = httpStatusOf(err)
+		return nil, report
+	}
+
 	fullURL, err := resolveURL(target, script)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve script URL %s: %v", script, err)
+		return fail(fmt.Errorf("%w: failed to resolve script URL %s: %v", errInvalidURL, script, err))
 	}
+	report.URL = fullURL
 
 	scriptURL, err := url.Parse(fullURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse script URL %s: %v", fullURL, err)
+		return fail(fmt.Errorf("%w: failed to parse script URL %s: %v", errInvalidURL, fullURL, err))
 	}
 
 	scriptHostname := scriptURL.Hostname()
 	if contains(blacklistHostnames, scriptHostname) {
-		return nil, nil
+		report.Status = ScriptSkipped
+		report.SkipReason = SkipBlacklisted
+		return nil, report
 	}
 
 	scriptTLD, err := getTopLevelDomain(scriptHostname)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get TLD for script %s: %v", fullURL, err)
+		return fail(fmt.Errorf("%w: failed to get TLD for script %s: %v", errInvalidURL, fullURL, err))
 	}
 
 	if scriptTLD != targetTLD {
-		return nil, nil
+		report.Status = ScriptSkipped
+		report.SkipReason = SkipThirdParty
+		return nil, report
 	}
 
-	scriptContent, err := getScriptContent(fullURL)
-	if err != nil {
-		return nil, err
+	if err := ctx.Err(); err != nil {
+		return fail(err)
 	}
 
-	return findAddressInfos(scriptContent, fullURL, "script", target), nil
-}
-
-func getScriptContent(fullURL string) (string, error) {
-	if cachedContent, ok := scriptCache.Get(fullURL); ok {
-		return cachedContent.(string), nil
+	scriptContent, origin, err := r.getScriptContent(ctx, fullURL)
+	if err != nil {
+		return fail(err)
 	}
 
-	scriptContent, err := fetchScriptContent(fullURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch script content from %s: %v", fullURL, err)
+	report.Status = ScriptFetched
+	if origin == cache.Cached {
+		report.Status = ScriptCached
 	}
-	scriptCache.Set(fullURL, scriptContent)
+	report.Shared = origin == cache.Shared
+	report.Unchanged = scriptContent.Unchanged && origin != cache.Cached
+	report.HTTPCode = scriptContent.StatusCode
+	if report.Unchanged {
+		report.HTTPCode = http.StatusNotModified
+	}
+	report.Bytes = scriptContent.Bytes
+	report.ContentHash = scriptContent.ContentHash
+
+	infos := addressInfosFromMatches(scriptContent.Addresses, scriptContent.Contexts, fullURL, "script", target)
+	report.Addresses = len(infos)
+	r.observer.emit(Event{Type: EventScriptFetched, Target: target, Script: &report})
+	r.observer.addressesFound(target, infos)
+	return infos, report
+}
 
-	return scriptContent, nil
+// scriptEntry is what is kept of a script: the addresses found in it and a
+// hash of its content rather than the body itself
+type scriptEntry struct {
+	StatusCode  int
+	Bytes       int
+	ContentHash string
+	Addresses   []string
+	// Contexts holds the text around each of Addresses
+	Contexts []string
+	// Unchanged is set when the script was revalidated with a 304 response
+	Unchanged bool
+}
+
+func (r *scrapeRun) getScriptContent(ctx context.Context, fullURL string) (*scriptEntry, cache.Origin, error) {
+	return scriptLoader.Load(ctx, normalizeURL(fullURL), r.opts.Fresh, func(ctx context.Context) (*scriptEntry, error) {
+		script, unchanged, err := r.fetchResource(ctx, fullURL, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch script content from %s: %w", fullURL, err)
+		}
+		return &scriptEntry{
+			StatusCode:  script.StatusCode,
+			Bytes:       script.Bytes,
+			ContentHash: script.ContentHash,
+			Addresses:   script.Addresses,
+			Contexts:    script.Contexts,
+			Unchanged:   unchanged,
+		}, nil
+	})
 }
 
 func getTLD(target string) (string, error) {
 	targetURL, err := url.Parse(target)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse target URL %s: %v", target, err)
+		return "", fmt.Errorf("%w: failed to parse target URL %s: %v", errInvalidURL, target, err)
 	}
 	targetHostname := targetURL.Hostname()
 	if contains(blacklistHostnames, targetHostname) {
-		return "", fmt.Errorf("target hostname %s is blacklisted", targetHostname)
+		return "", fmt.Errorf("target hostname %s: %w", targetHostname, errBlacklisted)
+	}
+	tld, err := getTopLevelDomain(targetHostname)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to get TLD for target %s: %v", errInvalidURL, target, err)
 	}
-	return getTopLevelDomain(targetHostname)
+	return tld, nil
 }
@@ -1,8 +1,15 @@
 package core
 
 import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
     "reflect"
+    "strings"
+    "sync"
     "testing"
+    "time"
 )
 
 func TestResolveURL(t *testing.T) {
@@ -46,7 +53,8 @@ func TestFindAddressInfos(t *testing.T) {
             "html",
             "https://example.com",
             []AddressInfo{
-                {"0x1234567890abcdef1234567890abcdef12345678", "https://example.com", "html", []string{"https://example.com"}},
+                {Address: "0x1234567890abcdef1234567890abcdef12345678", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1,
+                    Context: "Here is an Ethereum address: 0x1234567890abcdef1234567890abcdef12345678"},
             },
         },
         {
@@ -55,8 +63,20 @@ func TestFindAddressInfos(t *testing.T) {
             "html",
             "https://example.com",
             []AddressInfo{
-                {"0x1111111111111111111111111111111111111111", "https://example.com", "html", []string{"https://example.com"}},
-                {"0x2222222222222222222222222222222222222222", "https://example.com", "html", []string{"https://example.com"}},
+                {Address: "0x1111111111111111111111111111111111111111", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1,
+                    Context: "Multiple addresses: 0x1111111111111111111111111111111111111111 and 0x222222222222222222222222222222222"},
+                {Address: "0x2222222222222222222222222222222222222222", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1,
+                    Context: "11111111111111111111111111111111111 and 0x2222222222222222222222222222222222222222"},
+            },
+        },
+        {
+            "Line breaks\n\n  around   0x3333333333333333333333333333333333333333\n",
+            "https://example.com",
+            "html",
+            "https://example.com",
+            []AddressInfo{
+                {Address: "0x3333333333333333333333333333333333333333", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1,
+                    Context: "Line breaks around 0x3333333333333333333333333333333333333333"},
             },
         },
         {
@@ -87,22 +107,22 @@ func TestUniqueAddressInfos(t *testing.T) {
     }{
         {
             []AddressInfo{
-                {"0x1234567890abcdef1234567890abcdef12345678", "https://example.com", "html", []string{"https://example.com"}},
-                {"0x1234567890abcdef1234567890abcdef12345678", "https://example.com", "html", []string{"https://example.com/page"}},
+                {Address: "0x1234567890abcdef1234567890abcdef12345678", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
+                {Address: "0x1234567890abcdef1234567890abcdef12345678", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com/page"}, Count: 1},
             },
             []AddressInfo{
-                {"0x1234567890abcdef1234567890abcdef12345678", "https://example.com", "html", []string{"https://example.com", "https://example.com/page"}},
+                {Address: "0x1234567890abcdef1234567890abcdef12345678", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com", "https://example.com/page"}, Count: 2},
             },
         },
         {
             []AddressInfo{
-                {"0x1111111111111111111111111111111111111111", "https://example.com", "html", []string{"https://example.com"}},
-                {"0x2222222222222222222222222222222222222222", "https://example.com", "html", []string{"https://example.com"}},
-                {"0x1111111111111111111111111111111111111111", "https://example.com", "html", []string{"https://example.com/page"}},
+                {Address: "0x1111111111111111111111111111111111111111", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
+                {Address: "0x2222222222222222222222222222222222222222", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
+                {Address: "0x1111111111111111111111111111111111111111", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com/page"}, Count: 1},
             },
             []AddressInfo{
-                {"0x1111111111111111111111111111111111111111", "https://example.com", "html", []string{"https://example.com", "https://example.com/page"}},
-                {"0x2222222222222222222222222222222222222222", "https://example.com", "html", []string{"https://example.com"}},
+                {Address: "0x1111111111111111111111111111111111111111", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com", "https://example.com/page"}, Count: 2},
+                {Address: "0x2222222222222222222222222222222222222222", Src: "https://example.com", Type: "html", Targets: []string{"https://example.com"}, Count: 1},
             },
         },
     }
@@ -114,3 +134,250 @@ func TestUniqueAddressInfos(t *testing.T) {
         }
     }
 }
+
+func TestScrapeWithReport(t *testing.T) {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `<html><body>0x1111111111111111111111111111111111111111
+<script src="/app.js"></script>
+<script src="/missing.js"></script>
+<script src="https://cdn.other.com/lib.js"></script>
+</body></html>`)
+    })
+    mux.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `const router = "0x2222222222222222222222222222222222222222";`)
+    })
+    mux.HandleFunc("/missing.js", func(w http.ResponseWriter, r *http.Request) {
+        http.NotFound(w, r)
+    })
+    server := httptest.NewServer(mux)
+    defer server.Close()
+
+    result := ScrapeWithReport([]string{server.URL + "/", "http://google.com/"})
+
+    if len(result.Results) != 2 {
+        t.Errorf("Expected 2 results, got %d: %v", len(result.Results), result.Results)
+    }
+    if len(result.Report) != 2 {
+        t.Fatalf("Expected 2 target reports, got %d", len(result.Report))
+    }
+
+    report := result.Report[0]
+    if report.Status != StatusOK || report.HTTPCode != http.StatusOK {
+        t.Errorf("Expected ok target with HTTP 200, got %s with %d", report.Status, report.HTTPCode)
+    }
+    if report.ScriptsFound != 3 || report.ScriptsFetched != 1 || report.ScriptsSkipped != 1 || report.ScriptsFailed != 1 {
+        t.Errorf("Unexpected script counters: %+v", report)
+    }
+    if report.Scripts[2].SkipReason != SkipThirdParty {
+        t.Errorf("Expected third-party script to be skipped, got %+v", report.Scripts[2])
+    }
+    if missing := report.Scripts[1]; missing.Status != ScriptError || missing.HTTPCode != http.StatusNotFound || missing.Error == nil || missing.Error.Category != ErrorHTTPStatus {
+        t.Errorf("Expected missing script to fail with HTTP 404, got %+v", missing)
+    }
+
+    blacklisted := result.Report[1]
+    if blacklisted.Status != StatusError || blacklisted.Error == nil || blacklisted.Error.Category != ErrorBlacklisted {
+        t.Errorf("Expected blacklisted target error, got %+v", blacklisted)
+    }
+    if result.AllFailed() {
+        t.Error("Expected AllFailed to be false")
+    }
+}
+
+func TestScrapeContextCancellation(t *testing.T) {
+    release := make(chan struct{})
+    defer close(release)
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `0x3333333333333333333333333333333333333333 <script src="/slow.js"></script>`)
+    })
+    mux.HandleFunc("/slow.js", func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-release:
+        case <-r.Context().Done():
+        }
+    })
+    server := httptest.NewServer(mux)
+    defer server.Close()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+    defer cancel()
+
+    start := time.Now()
+    result := ScrapeContext(ctx, []string{server.URL + "/cancel", server.URL + "/never"}, Options{})
+    if elapsed := time.Since(start); elapsed > 2*time.Second {
+        t.Errorf("Expected scrape to stop at the deadline, took %v", elapsed)
+    }
+
+    if !result.Partial {
+        t.Error("Expected partial result")
+    }
+    if len(result.Results) != 1 {
+        t.Errorf("Expected the HTML address to survive cancellation, got %v", result.Results)
+    }
+    if script := result.Report[0].Scripts[0]; script.Error == nil || script.Error.Category != ErrorTimeout {
+        t.Errorf("Expected slow script to time out, got %+v", script)
+    }
+    if never := result.Report[1]; never.Error == nil || never.Error.Category != ErrorTimeout {
+        t.Errorf("Expected remaining target to be reported as timed out, got %+v", never)
+    }
+    if _, ok := targetCache.Get(server.URL + "/cancel"); ok {
+        t.Error("Expected cancelled target not to be cached")
+    }
+}
+
+func TestScrapeContextFresh(t *testing.T) {
+    hits := 0
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits++
+        fmt.Fprint(w, "0x6666666666666666666666666666666666666666")
+    }))
+    defer server.Close()
+
+    target := server.URL + "/fresh"
+    ScrapeContext(context.Background(), []string{target}, Options{})
+    cached := ScrapeContext(context.Background(), []string{target}, Options{})
+    if !cached.Report[0].Cached || hits != 1 {
+        t.Errorf("Expected second scrape to be served from cache, got cached=%v after %d fetches", cached.Report[0].Cached, hits)
+    }
+
+    fresh := ScrapeContext(context.Background(), []string{target}, Options{Fresh: true})
+    if fresh.Report[0].Cached || hits != 2 {
+        t.Errorf("Expected fresh scrape to bypass the cache, got cached=%v after %d fetches", fresh.Report[0].Cached, hits)
+    }
+}
+
+func TestScriptCacheKeepsFindingsOnly(t *testing.T) {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `<script src="/bundle.js"></script>`)
+    })
+    mux.HandleFunc("/bundle.js", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `var a = "0x7777777777777777777777777777777777777777"; var padding = "`+strings.Repeat("x", 4096)+`";`)
+    })
+    server := httptest.NewServer(mux)
+    defer server.Close()
+
+    result := ScrapeWithReport([]string{server.URL + "/findings"})
+    script := result.Report[0].Scripts[0]
+    if script.ContentHash == "" || script.Bytes < 4096 {
+        t.Errorf("Expected script report with content hash and size, got %+v", script)
+    }
+
+    entry, ok := scriptCache.Get(script.URL)
+    if !ok {
+        t.Fatal("Expected script to be cached")
+    }
+    if len(entry.Addresses) != 1 || entry.ContentHash != script.ContentHash {
+        t.Errorf("Unexpected cached script entry: %+v", entry)
+    }
+    if weight := weighScriptEntry(entry); weight >= int64(script.Bytes) {
+        t.Errorf("Expected cached entry to weigh less than the script body, got %d", weight)
+    }
+}
+
+func TestNormalizeURL(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {"HTTPS://Example.COM", "https://example.com/"},
+        {"https://example.com:443/app#top", "https://example.com/app"},
+        {"http://example.com:80/a?b=1", "http://example.com/a?b=1"},
+        {"http://example.com:8080/", "http://example.com:8080/"},
+    }
+
+    for _, test := range tests {
+        if result := normalizeURL(test.input); result != test.expected {
+            t.Errorf("normalizeURL(%q) = %q, expected %q", test.input, result, test.expected)
+        }
+    }
+}
+
+func TestConcurrentScrapesShareFetch(t *testing.T) {
+    var mutex sync.Mutex
+    hits := 0
+    release := make(chan struct{})
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mutex.Lock()
+        hits++
+        mutex.Unlock()
+        <-release
+        fmt.Fprint(w, "0x8888888888888888888888888888888888888888")
+    }))
+    defer server.Close()
+
+    results := make(chan ScrapeResult, 2)
+    for _, target := range []string{server.URL + "/shared", server.URL + "/shared#again"} {
+        go func(target string) {
+            results <- ScrapeContext(context.Background(), []string{target}, Options{Fresh: true})
+        }(target)
+    }
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+
+    shared := 0
+    for i := 0; i < 2; i++ {
+        result := <-results
+        if len(result.Results) != 1 {
+            t.Errorf("Expected 1 address, got %+v", result.Results)
+        }
+        if result.Report[0].Shared {
+            shared++
+        }
+    }
+    if hits != 1 || shared != 1 {
+        t.Errorf("Expected one fetch shared by both scrapes, got %d fetches and %d shared", hits, shared)
+    }
+}
+
+func TestConditionalRevalidation(t *testing.T) {
+    var mutex sync.Mutex
+    var conditional []string
+    mux := http.NewServeMux()
+    mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+        mutex.Lock()
+        conditional = append(conditional, r.Header.Get("If-None-Match"))
+        mutex.Unlock()
+        if r.Header.Get("If-None-Match") == `"page-v1"` {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        w.Header().Set("ETag", `"page-v1"`)
+        fmt.Fprint(w, `0x9999999999999999999999999999999999999999 <script src="/app.js"></script>`)
+    })
+    mux.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+        modified := "Mon, 02 Jan 2006 15:04:05 GMT"
+        if r.Header.Get("If-Modified-Since") == modified {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        w.Header().Set("Last-Modified", modified)
+        fmt.Fprint(w, `"0xaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaAaA"`)
+    })
+    server := httptest.NewServer(mux)
+    defer server.Close()
+
+    target := server.URL + "/page"
+    first := ScrapeContext(context.Background(), []string{target}, Options{Fresh: true})
+    second := ScrapeContext(context.Background(), []string{target}, Options{Fresh: true})
+
+    if first.Report[0].Unchanged || first.Report[0].Scripts[0].Unchanged {
+        t.Errorf("Expected first scrape to download everything, got %+v", first.Report[0])
+    }
+    report := second.Report[0]
+    if !report.Unchanged || report.HTTPCode != http.StatusNotModified {
+        t.Errorf("Expected page to come back unchanged, got %+v", report)
+    }
+    if script := report.Scripts[0]; !script.Unchanged || script.HTTPCode != http.StatusNotModified || script.ContentHash != first.Report[0].Scripts[0].ContentHash {
+        t.Errorf("Expected script to come back unchanged with its previous hash, got %+v", script)
+    }
+    if !reflect.DeepEqual(first.Results, second.Results) || len(second.Results) != 2 {
+        t.Errorf("Expected unchanged resources to keep their findings, got %v and %v", first.Results, second.Results)
+    }
+    if len(conditional) != 2 || conditional[0] != "" || conditional[1] != `"page-v1"` {
+        t.Errorf("Expected the second request to be conditional, got %q", conditional)
+    }
+}
@@ -0,0 +1,286 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownChain = errors.New("unknown chain")
+
+// Chain is an EVM network addresses can be classified on
+type Chain struct {
+	Name string
+	ID   int64
+	// RPCURLs are public JSON-RPC endpoints needing no API key, overridden by
+	// RPC_URLS_<NAME>
+	RPCURLs []string
+	// Multicall3 is the address of the Multicall3 contract, empty when the
+	// chain has none
+	Multicall3 string
+}
+
+// Chains are the networks supported by default, named like the frontend's Chain enum
+var Chains = map[string]Chain{
+	"ethereum": {Name: "ethereum", ID: 1, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/eth",
+		"https://eth.drpc.org",
+		"https://eth.merkle.io",
+		"https://rpc.payload.de",
+		"https://eth.meowrpc.com",
+		"https://eth.nownodes.io",
+		"https://eth.llamarpc.com",
+		"https://rpc.ankr.com/eth",
+		"https://rpc.mevblocker.io",
+		"https://rpc.flashbots.net",
+		"https://rpc.graffiti.farm",
+		"https://rpc.builder0x69.io",
+		"https://uk.rpc.blxrbdn.com",
+		"https://cloudflare-eth.com",
+		"https://rpc.eth.gateway.fm",
+		"https://eth.rpc.blxrbdn.com",
+		"https://eth-pokt.nodies.app",
+		"https://core.gashawk.io/rpc",
+		"https://eth.nodeconnect.org",
+		"https://api.securerpc.com/v1",
+		"https://rpc.notadegen.com/eth",
+		"https://rpc.flashbots.net/fast",
+		"https://rpc.mevblocker.io/fast",
+		"https://api.mycryptoapi.com/eth",
+		"https://virginia.rpc.blxrbdn.com",
+		"https://mainnet.eth.cloud.ava.do",
+		"https://singapore.rpc.blxrbdn.com",
+		"https://rpc.blocknative.com/boost",
+		"https://main-light.eth.linkpool.io",
+		"https://rpc.lokibuilder.xyz/wallet",
+	}},
+	"bsc": {Name: "bsc", ID: 56, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://bscrpc.com",
+		"https://1rpc.io/bnb",
+		"https://bsc.drpc.org",
+		"https://rpc-bsc.48.club",
+		"https://bsc.meowrpc.com",
+		"https://rpc.ankr.com/bsc",
+		"https://bsc-pokt.nodies.app",
+		"https://binance.nodereal.io",
+		"https://bsc.rpc.blxrbdn.com",
+		"https://binance.llamarpc.com",
+		"https://koge-rpc-bsc.48.club",
+		"https://bsc-rpc.publicnode.com",
+		"https://bsc-dataseed6.dict.life",
+		"https://bsc-dataseed1.defibit.io",
+		"https://bsc-dataseed2.defibit.io",
+		"https://bsc-dataseed3.defibit.io",
+		"https://bsc-dataseed4.defibit.io",
+		"https://bsc-dataseed.bnbchain.org",
+		"https://bsc-dataseed1.ninicoin.io",
+		"https://bsc-dataseed2.ninicoin.io",
+		"https://bsc-dataseed3.ninicoin.io",
+		"https://bsc-dataseed4.ninicoin.io",
+		"https://bsc-dataseed1.bnbchain.org",
+		"https://bsc-dataseed2.bnbchain.org",
+		"https://bsc-dataseed3.bnbchain.org",
+		"https://bsc-dataseed4.bnbchain.org",
+		"https://bnb.api.onfinality.io/public",
+		"https://bsc-mainnet.gateway.tatum.io",
+	}},
+	"polygon": {Name: "polygon", ID: 137, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/matic",
+		"https://polygon-rpc.com",
+		"https://polygon.drpc.org",
+		"https://polygon.meowrpc.com",
+		"https://polygon.llamarpc.com",
+		"https://rpc.ankr.com/polygon",
+		"https://polygon.rpc.blxrbdn.com",
+		"https://polygon-pokt.nodies.app",
+		"https://rpc-mainnet.matic.network",
+		"https://rpc-mainnet.maticvigil.com",
+		"https://polygon.gateway.tenderly.co",
+		"https://polygon-bor-rpc.publicnode.com",
+		"https://rpc-mainnet.matic.quiknode.pro",
+		"https://polygon-mainnet.gateway.tatum.io",
+		"https://polygon.api.onfinality.io/public",
+		"https://matic-mainnet.chainstacklabs.com",
+		"https://polygon-mainnet.public.blastapi.io",
+		"https://gateway.tenderly.co/public/polygon",
+		"https://polygon.rpc.subquery.network/public",
+		"https://matic-mainnet-full-rpc.bwarelabs.com",
+		"https://polygon-mainnet.g.alchemy.com/v2/demo",
+		"https://polygon.blockpi.network/v1/rpc/public",
+		"https://api.zan.top/node/v1/polygon/mainnet/public",
+		"https://public.stackup.sh/api/v1/node/polygon-mainnet",
+		"https://endpoints.omniatech.io/v1/matic/mainnet/public",
+	}},
+	"arbitrum": {Name: "arbitrum", ID: 42161, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/arb",
+		"https://arbitrum.drpc.org",
+		"https://arb-pokt.nodies.app",
+		"https://arbitrum.meowrpc.com",
+		"https://arb1.arbitrum.io/rpc",
+		"https://arbitrum.llamarpc.com",
+		"https://rpc.ankr.com/arbitrum",
+		"https://arbitrum-one.publicnode.com",
+		"https://arb-mainnet-public.unifra.io",
+		"https://rpc.arb1.arbitrum.gateway.fm",
+		"https://arbitrum-one-rpc.publicnode.com",
+		"https://arbitrum-one.public.blastapi.io",
+		"https://arb-mainnet.g.alchemy.com/v2/demo",
+		"https://api.zan.top/node/v1/arb/one/public",
+		"https://arbitrum.rpc.subquery.network/public",
+		"https://arbitrum.blockpi.network/v1/rpc/public",
+		"https://public.stackup.sh/api/v1/node/arbitrum-one",
+		"https://api.stateless.solutions/arbitrum-one/v1/demo",
+		"https://endpoints.omniatech.io/v1/arbitrum/one/public",
+	}},
+	"optimism": {Name: "optimism", ID: 10, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/op",
+		"https://optimism.drpc.org",
+		"https://op-pokt.nodies.app",
+		"https://mainnet.optimism.io",
+		"https://optimism.meowrpc.com",
+		"https://optimism.llamarpc.com",
+		"https://rpc.ankr.com/optimism",
+		"https://rpc.optimism.gateway.fm",
+		"https://optimism-rpc.publicnode.com",
+		"https://optimism.gateway.tenderly.co",
+		"https://optimism.api.onfinality.io/public",
+		"https://opt-mainnet.g.alchemy.com/v2/demo",
+		"https://optimism-mainnet.gateway.tatum.io",
+		"https://optimism-mainnet.public.blastapi.io",
+		"https://gateway.tenderly.co/public/optimism",
+		"https://optimism.rpc.subquery.network/public",
+		"https://optimism.blockpi.network/v1/rpc/public",
+		"https://api.zan.top/node/v1/opt/mainnet/public",
+		"https://api.stateless.solutions/optimism/v1/demo",
+		"https://endpoints.omniatech.io/v1/op/mainnet/public",
+		"https://public.stackup.sh/api/v1/node/optimism-mainnet",
+	}},
+	"base": {Name: "base", ID: 8453, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/base",
+		"https://base.drpc.org",
+		"https://mainnet.base.org",
+		"https://base.meowrpc.com",
+		"https://base.llamarpc.com",
+		"https://base-pokt.nodies.app",
+		"https://rpc.notadegen.com/base",
+		"https://base-rpc.publicnode.com",
+		"https://base.gateway.tenderly.co",
+		"https://base-mainnet.gateway.tatum.io",
+		"https://base.api.onfinality.io/public",
+		"https://gateway.tenderly.co/public/base",
+		"https://base-mainnet.public.blastapi.io",
+		"https://base.rpc.subquery.network/public",
+		"https://base-mainnet.diamondswap.org/rpc",
+		"https://developer-access-mainnet.base.org",
+		"https://base.blockpi.network/v1/rpc/public",
+		"https://public.stackup.sh/api/v1/node/base-mainnet",
+		"https://endpoints.omniatech.io/v1/base/mainnet/public",
+	}},
+	"avalanche": {Name: "avalanche", ID: 43114, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/avax/c",
+		"https://avax.meowrpc.com",
+		"https://avalanche.drpc.org",
+		"https://rpc.ankr.com/avalanche",
+		"https://avalanche.public-rpc.com",
+		"https://api.avax.network/ext/bc/C/rpc",
+		"https://avax-x-mainnet.gateway.tatum.io",
+		"https://avax-pokt.nodies.app/ext/bc/C/rpc",
+		"https://avalanche-c-chain-rpc.publicnode.com",
+		"https://avalanche.blockpi.network/v1/rpc/public",
+		"https://ava-mainnet.public.blastapi.io/ext/bc/C/rpc",
+		"https://endpoints.omniatech.io/v1/avax/mainnet/public",
+		"https://avalanche.api.onfinality.io/public/ext/bc/C/rpc",
+		"https://public.stackup.sh/api/v1/node/avalanche-mainnet",
+		"https://api.zan.top/node/v1/avax/mainnet/public/ext/bc/C/rpc",
+	}},
+	"fantom": {Name: "fantom", ID: 250, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/ftm",
+		"https://rpc.ftm.tools",
+		"https://fantom.drpc.org",
+		"https://rpc.fantom.network",
+		"https://rpc2.fantom.network",
+		"https://rpc3.fantom.network",
+		"https://rpc.ankr.com/fantom",
+		"https://rpcapi.fantom.network",
+		"https://rpc.fantom.gateway.fm",
+		"https://fantom-pokt.nodies.app",
+		"https://fantom-rpc.publicnode.com",
+		"https://fantom.api.onfinality.io/public",
+		"https://fantom-mainnet.gateway.tatum.io",
+		"https://fantom-mainnet.public.blastapi.io",
+		"https://fantom.blockpi.network/v1/rpc/public",
+		"https://endpoints.omniatech.io/v1/fantom/mainnet/public",
+	}},
+	"mantle": {Name: "mantle", ID: 5000, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://rpc.mantle.xyz",
+		"https://1rpc.io/mantle",
+		"https://mantle.drpc.org",
+		"https://rpc.ankr.com/mantle",
+		"https://mantle-rpc.publicnode.com",
+		"https://mantle-mainnet.public.blastapi.io",
+	}},
+	"zksync": {Name: "zksync", ID: 324, Multicall3: "0xf9cda624fbc7e059355ce98a31693d299facd963", RPCURLs: []string{
+		"https://zksync.drpc.org",
+		"https://zksync.meowrpc.com",
+		"https://1rpc.io/zksync2-era",
+		"https://mainnet.era.zksync.io",
+		"https://zksync-era.blockpi.network/v1/rpc/public",
+		"https://endpoints.omniatech.io/v1/zksync-era/mainnet/public",
+	}},
+	"linea": {Name: "linea", ID: 59144, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://1rpc.io/linea",
+		"https://linea.drpc.org",
+		"https://rpc.linea.build",
+		"https://linea.decubate.com",
+		"https://linea.blockpi.network/v1/rpc/public",
+	}},
+	"blast": {Name: "blast", ID: 81457, Multicall3: Multicall3Address, RPCURLs: []string{
+		"https://rpc.blast.io",
+		"https://blast.drpc.org",
+		"https://blast.din.dev/rpc",
+		"https://blast.gasswap.org",
+		"https://rpc.ankr.com/blast",
+		"https://rpc.envelop.is/blast",
+		"https://blast-rpc.publicnode.com",
+		"https://blastl2-mainnet.public.blastapi.io",
+		"https://blast.blockpi.network/v1/rpc/public",
+	}},
+}
+
+// ChainNames lists the supported chains in alphabetical order
+func ChainNames() []string {
+	names := make([]string, 0, len(Chains))
+	for name := range Chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateChains checks that every chain is supported, errors wrap ErrUnknownChain
+func ValidateChains(chains []string) error {
+	for _, chain := range chains {
+		if _, ok := Chains[chain]; !ok {
+			return fmt.Errorf("%w %q, expected one of %s", ErrUnknownChain, chain, strings.Join(ChainNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Function to get the RPC URLs of a chain, RPC_URLS_<NAME> (comma-separated)
+// replacing the defaults when set
+func rpcURLsFromEnv(chain Chain) []string {
+	value := os.Getenv("RPC_URLS_" + strings.ToUpper(chain.Name))
+	if value == "" {
+		return chain.RPCURLs
+	}
+	var urls []string
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,196 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rpcTimeout = 10 * time.Second
+	// maxResponseSize bounds a JSON-RPC response body, batches included
+	maxResponseSize = 32 * 1024 * 1024
+)
+
+// ErrBatchRejected is returned when an endpoint refuses a batch as a whole,
+// which usually means it is larger than the endpoint accepts
+var ErrBatchRejected = errors.New("batch rejected")
+
+// Caller makes JSON-RPC calls, decoding the result into result
+type Caller interface {
+	Call(ctx context.Context, method string, params []interface{}, result interface{}) error
+}
+
+// BatchElem is one call of a batch. Error is set when the node returned an
+// error for this call only.
+type BatchElem struct {
+	Method string
+	Params []interface{}
+	Result interface{}
+	Error  error
+}
+
+// BatchCaller makes several JSON-RPC calls in one request. The returned error
+// is set when the batch as a whole failed, in which case Error of the
+// elements is not meaningful.
+type BatchCaller interface {
+	BatchCall(ctx context.Context, batch []BatchElem) error
+}
+
+// RPCError is an error object returned by a JSON-RPC endpoint
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// HTTPError is a non-2xx response from a JSON-RPC endpoint
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// Client calls a single JSON-RPC endpoint over HTTP
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+	nextID     atomic.Int64
+}
+
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTPClient: &http.Client{Timeout: rpcTimeout}}
+}
+
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	request := c.newRequest(method, params)
+	body, err := c.post(ctx, request)
+	if err != nil {
+		return err
+	}
+	var response rpcResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("decoding %s response: %w", method, err)
+	}
+	return response.decode(result)
+}
+
+// BatchCall sends batch as a single JSON-RPC batch request. Endpoints that
+// refuse the batch, with 413 or 400, a single error object or missing
+// responses, fail with an error wrapping ErrBatchRejected.
+func (c *Client) BatchCall(ctx context.Context, batch []BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	requests := make([]rpcRequest, len(batch))
+	index := make(map[int64]int, len(batch))
+	for i, elem := range batch {
+		requests[i] = c.newRequest(elem.Method, elem.Params)
+		index[requests[i].ID] = i
+	}
+	body, err := c.post(ctx, requests)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusRequestEntityTooLarge || (httpErr.StatusCode == http.StatusBadRequest && len(batch) > 1)) {
+		return fmt.Errorf("%w: %w", ErrBatchRejected, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var response rpcResponse
+		if err := json.Unmarshal(trimmed, &response); err == nil && response.Error != nil {
+			return fmt.Errorf("%w: %w", ErrBatchRejected, response.Error)
+		}
+		return fmt.Errorf("%w: expected an array of responses", ErrBatchRejected)
+	}
+	var responses []rpcResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("decoding batch response: %w", err)
+	}
+	answered := make([]bool, len(batch))
+	for _, response := range responses {
+		i, ok := index[response.ID]
+		if !ok || answered[i] {
+			continue
+		}
+		answered[i] = true
+		batch[i].Error = response.decode(batch[i].Result)
+	}
+	missing := 0
+	for _, ok := range answered {
+		if !ok {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%w: %d of %d responses missing", ErrBatchRejected, missing, len(batch))
+	}
+	return nil
+}
+
+func (c *Client) newRequest(method string, params []interface{}) rpcRequest {
+	if params == nil {
+		params = []interface{}{}
+	}
+	return rpcRequest{JSONRPC: "2.0", ID: c.nextID.Add(1), Method: method, Params: params}
+}
+
+// Function to POST a request or batch and read the response body
+func (c *Client) post(ctx context.Context, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPError{StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// decode returns the error of the response or decodes its result into result
+func (r *rpcResponse) decode(result interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
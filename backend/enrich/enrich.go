@@ -0,0 +1,562 @@
+package enrich
+
+import (
+	"backend/cache"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	TypeEOA      = "eoa"
+	TypeContract = "contract"
+	TypeERC20    = "erc20"
+
+	maxClassifications = 10000
+	classificationTTL  = time.Hour
+	// multicallSize is the number of calls aggregated in one Multicall3 call,
+	// bounded by the gas limit nodes apply to eth_call
+	multicallSize = 250
+	// defaultProbeInterval is how often endpoint pools are health checked, see RPC_PROBE_INTERVAL
+	defaultProbeInterval = time.Minute
+)
+
+var (
+	errInvalidAddress = errors.New("invalid address")
+	addressPattern    = regexp.MustCompile(`^0x[0-9a-f]{40}$`)
+)
+
+// Classification is what an address is on one chain. Error is set instead of
+// Type when the chain could not be queried.
+type Classification struct {
+	Chain string `json:"chain"`
+	// Type is eoa, contract or the most specific of Standards
+	Type string `json:"type,omitempty"`
+	// Standards are those the contract implements among erc20, erc721,
+	// erc1155, erc4626, safe and erc4337, each with its metadata below
+	Standards  []string    `json:"standards,omitempty"`
+	Token      *Token      `json:"token,omitempty"`
+	Collection *Collection `json:"collection,omitempty"`
+	Vault      *Vault      `json:"vault,omitempty"`
+	Safe       *Safe       `json:"safe,omitempty"`
+	Account    *Account    `json:"account,omitempty"`
+	// Proxy is set for contracts delegating to an implementation, whose
+	// standards are those reported above since calls reach it
+	Proxy *Proxy `json:"proxy,omitempty"`
+	// Fingerprint describes contracts from the functions in their bytecode
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// ClassifyOptions tunes a classification
+type ClassifyOptions struct {
+	// Implementations classifies the implementation of proxies as well
+	Implementations bool
+}
+
+// Enricher classifies addresses on the chains it has a Caller for.
+// Classifications are cached, failures are not.
+type Enricher struct {
+	callers map[string]Caller
+	// newCaller, when set, creates the Caller of a chain on first use
+	newCaller func(chain string) (Caller, bool)
+	cache     *cache.Memory[string, Classification]
+	mutex     sync.Mutex
+	// multicalls remembers whether Multicall3 is deployed on each chain
+	multicalls map[string]bool
+	// names caches ENS lookups, see ResolveNames and LookupNames
+	names *cache.Memory[string, string]
+	// signatures is the database contracts are fingerprinted with
+	signatures *Signatures
+}
+
+// New creates an Enricher calling each chain through callers, keyed by chain name
+func New(callers map[string]Caller) *Enricher {
+	c := cache.NewMemory[string, Classification](maxClassifications, classificationTTL)
+	c.StartJanitor(time.Minute)
+	names := cache.NewMemory[string, string](maxClassifications, classificationTTL)
+	names.StartJanitor(time.Minute)
+	return &Enricher{callers: callers, cache: c, multicalls: make(map[string]bool), names: names, signatures: NewSignatures()}
+}
+
+// NewFromEnv creates an Enricher for every supported chain, calling each
+// through a pool of its RPC URLs (see rpcURLsFromEnv) that is probed every
+// RPC_PROBE_INTERVAL (default 1m). Pools are created, and start being
+// probed, the first time their chain is used. RPC_RATE_LIMIT is the number of calls per
+// second allowed to each endpoint (default 10). Contracts are fingerprinted
+// with the signatures of SIGNATURES_FILE on top of the built-in ones.
+func NewFromEnv() *Enricher {
+	opts := DefaultPoolOptions
+	if value := os.Getenv("RPC_RATE_LIMIT"); value != "" {
+		if limit, err := strconv.ParseFloat(value, 64); err == nil && limit > 0 {
+			opts.RateLimit = limit
+			opts.Burst = max(1, int(limit))
+		} else {
+			log.Printf("Invalid RPC_RATE_LIMIT %q, using %g", value, opts.RateLimit)
+		}
+	}
+	interval := defaultProbeInterval
+	if value := os.Getenv("RPC_PROBE_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			interval = parsed
+		} else {
+			log.Printf("Invalid RPC_PROBE_INTERVAL %q, using %s", value, interval)
+		}
+	}
+
+	enricher := New(map[string]Caller{})
+	enricher.newCaller = func(name string) (Caller, bool) {
+		chain, ok := Chains[name]
+		if !ok {
+			return nil, false
+		}
+		urls := rpcURLsFromEnv(chain)
+		if len(urls) == 0 {
+			return nil, false
+		}
+		pool := NewPool(name, urls, opts)
+		pool.StartProbing(context.Background(), interval)
+		return pool, true
+	}
+	if path := os.Getenv("SIGNATURES_FILE"); path != "" {
+		if signatures, err := LoadSignatures(path); err == nil {
+			enricher.UseSignatures(signatures)
+		} else {
+			log.Printf("Error loading SIGNATURES_FILE, using the built-in signatures: %v", err)
+		}
+	}
+	return enricher
+}
+
+// UseSignatures sets the database contracts are fingerprinted with.
+// Classifications cached until then keep their fingerprint.
+func (e *Enricher) UseSignatures(signatures *Signatures) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.signatures = signatures
+}
+
+// Function to get the Caller of chain, creating it on first use
+func (e *Enricher) caller(chain string) (Caller, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if caller, ok := e.callers[chain]; ok {
+		return caller, true
+	}
+	if e.newCaller == nil {
+		return nil, false
+	}
+	caller, ok := e.newCaller(chain)
+	if ok {
+		e.callers[chain] = caller
+	}
+	return caller, ok
+}
+
+// PoolStates returns the state of the endpoint pool of every chain used so
+// far, for chains called through a Pool
+func (e *Enricher) PoolStates() []PoolState {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	states := []PoolState{}
+	for _, chain := range ChainNames() {
+		if pool, ok := e.callers[chain].(*Pool); ok {
+			states = append(states, pool.State())
+		}
+	}
+	return states
+}
+
+// Pool returns the endpoint pool of chain, if it is called through one,
+// creating it on first use
+func (e *Enricher) Pool(chain string) (*Pool, bool) {
+	caller, _ := e.caller(chain)
+	pool, ok := caller.(*Pool)
+	return pool, ok
+}
+
+var (
+	defaultEnricher *Enricher
+	defaultOnce     sync.Once
+)
+
+// Default returns the Enricher shared by scrapes that don't bring their own,
+// created from the environment on first use
+func Default() *Enricher {
+	defaultOnce.Do(func() {
+		defaultEnricher = NewFromEnv()
+	})
+	return defaultEnricher
+}
+
+// Classify tells whether address is an EOA, a contract or an ERC-20 token on chain
+func (e *Enricher) Classify(ctx context.Context, chain, address string, opts ClassifyOptions) (Classification, error) {
+	if _, ok := e.caller(chain); !ok {
+		return Classification{}, fmt.Errorf("%w %q", ErrUnknownChain, chain)
+	}
+	address = strings.ToLower(address)
+	result := e.classify(ctx, chain, []string{address}, opts)[address]
+	return result.classification, result.err
+}
+
+// ClassifyAll classifies every address on every chain, the chains in
+// parallel. The result maps lowercase addresses to chains to
+// classifications, failed classifications carry their error.
+func (e *Enricher) ClassifyAll(ctx context.Context, chains, addresses []string, opts ClassifyOptions) map[string]map[string]*Classification {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		address = strings.ToLower(address)
+		if !seen[address] {
+			seen[address] = true
+			unique = append(unique, address)
+		}
+	}
+
+	results := make(map[string]map[string]*Classification)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, chain := range chains {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var outcomes map[string]outcome
+			if _, ok := e.caller(chain); ok {
+				outcomes = e.classify(ctx, chain, unique, opts)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, address := range unique {
+				result, ok := outcomes[address]
+				if !ok {
+					result.err = fmt.Errorf("%w %q", ErrUnknownChain, chain)
+				}
+				classification := result.classification
+				if result.err != nil {
+					classification = Classification{Chain: chain, Error: result.err.Error()}
+				}
+				if results[address] == nil {
+					results[address] = make(map[string]*Classification)
+				}
+				results[address][chain] = &classification
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// outcome is the classification of an address or why it failed
+type outcome struct {
+	classification Classification
+	err            error
+}
+
+// Function to classify lowercase addresses on chain, then the implementations
+// of the proxies among them when opts asks for it
+func (e *Enricher) classify(ctx context.Context, chain string, addresses []string, opts ClassifyOptions) map[string]outcome {
+	outcomes := e.classifyChain(ctx, chain, addresses)
+	if !opts.Implementations {
+		return outcomes
+	}
+	var implementations []string
+	for _, result := range outcomes {
+		if proxy := result.classification.Proxy; proxy != nil && proxy.Implementation != "" && !slices.Contains(implementations, proxy.Implementation) {
+			implementations = append(implementations, proxy.Implementation)
+		}
+	}
+	if len(implementations) == 0 {
+		return outcomes
+	}
+	classified := e.classifyChain(ctx, chain, implementations)
+	for address, result := range outcomes {
+		if result.classification.Proxy == nil {
+			continue
+		}
+		implementation, ok := classified[result.classification.Proxy.Implementation]
+		if !ok {
+			continue
+		}
+		// Cached classifications share their Proxy, which is left untouched
+		proxy := *result.classification.Proxy
+		proxy.Classification = &implementation.classification
+		if implementation.err != nil {
+			proxy.Classification = &Classification{Chain: chain, Error: implementation.err.Error()}
+		}
+		result.classification.Proxy = &proxy
+		outcomes[address] = result
+	}
+	return outcomes
+}
+
+// Function to classify lowercase addresses on chain with as few requests as
+// possible: a batch of eth_getCode, then the probe calls of every contract at
+// once and a batch reading their proxy slots. Only successful classifications
+// are cached.
+func (e *Enricher) classifyChain(ctx context.Context, chain string, addresses []string) map[string]outcome {
+	caller, _ := e.caller(chain)
+	outcomes := make(map[string]outcome, len(addresses))
+	var pending []string
+	for _, address := range addresses {
+		if classification, ok := e.cache.Get(chain + ":" + address); ok {
+			outcomes[address] = outcome{classification: classification}
+		} else if !addressPattern.MatchString(address) {
+			outcomes[address] = outcome{err: fmt.Errorf("%w %q", errInvalidAddress, address)}
+		} else {
+			pending = append(pending, address)
+		}
+	}
+	if len(pending) == 0 {
+		return outcomes
+	}
+
+	codes := make([]string, len(pending))
+	batch := make([]BatchElem, len(pending))
+	for i, address := range pending {
+		batch[i] = BatchElem{Method: "eth_getCode", Params: []interface{}{address, "latest"}, Result: &codes[i]}
+	}
+	err := callBatches(ctx, caller, batch)
+	var contracts []string
+	codeOf := make(map[string]string)
+	for i, address := range pending {
+		switch {
+		case err != nil:
+			outcomes[address] = outcome{err: fmt.Errorf("eth_getCode: %w", err)}
+		case batch[i].Error != nil:
+			outcomes[address] = outcome{err: fmt.Errorf("eth_getCode: %w", batch[i].Error)}
+		case isEOACode(codes[i]):
+			outcomes[address] = outcome{classification: Classification{Chain: chain, Type: TypeEOA}}
+		default:
+			contracts = append(contracts, address)
+			codeOf[address] = codes[i]
+		}
+	}
+
+	e.mutex.Lock()
+	signatures := e.signatures
+	e.mutex.Unlock()
+	outputs, errs := e.probeCalls(ctx, chain, caller, contracts)
+	proxies, proxyErrs := resolveProxies(ctx, caller, codeOf)
+	for _, address := range contracts {
+		err := errs[address]
+		if err == nil {
+			err = proxyErrs[address]
+		}
+		if err != nil {
+			outcomes[address] = outcome{err: err}
+			continue
+		}
+		classification := Classification{Chain: chain, Proxy: proxies[address], Fingerprint: fingerprint(codeOf[address], signatures)}
+		describe(&classification, outputs[address])
+		outcomes[address] = outcome{classification: classification}
+	}
+
+	for _, address := range pending {
+		if result := outcomes[address]; result.err == nil {
+			e.cache.Set(chain+":"+address, result.classification)
+		}
+	}
+	return outcomes
+}
+
+// Function to make the probe calls of every contract, through Multicall3 when
+// the chain has it and with a batch of eth_call for the rest
+func (e *Enricher) probeCalls(ctx context.Context, chain string, caller Caller, contracts []string) (map[string]*probeOutputs, map[string]error) {
+	outputs := make(map[string]*probeOutputs)
+	errs := make(map[string]error)
+	if len(contracts) == 0 {
+		return outputs, errs
+	}
+	remaining := contracts
+	if multicall := e.multicall(ctx, chain, caller); multicall != "" {
+		remaining = multicallProbeCalls(ctx, caller, multicall, contracts, outputs)
+	}
+
+	n := len(probeCalldata)
+	results := make([]string, len(remaining)*n)
+	batch := make([]BatchElem, len(remaining)*n)
+	for i, contract := range remaining {
+		for j, data := range probeCalldata {
+			batch[i*n+j] = BatchElem{Method: "eth_call", Params: []interface{}{map[string]string{"to": contract, "data": data}, "latest"}, Result: &results[i*n+j]}
+		}
+	}
+	err := callBatches(ctx, caller, batch)
+	for i, contract := range remaining {
+		output := &probeOutputs{}
+		for j := range probeCalldata {
+			elem := batch[i*n+j]
+			switch {
+			case err != nil:
+				errs[contract] = fmt.Errorf("eth_call: %w", err)
+			case isReverted(elem.Error):
+			case elem.Error != nil:
+				errs[contract] = fmt.Errorf("eth_call: %w", elem.Error)
+			default:
+				output[j], _ = hex.DecodeString(strings.TrimPrefix(results[i*n+j], "0x"))
+			}
+		}
+		outputs[contract] = output
+	}
+	return outputs, errs
+}
+
+// Function to make the probe calls of contracts through the Multicall3
+// contract at multicall, in aggregates of at most multicallSize calls sent in
+// one batch. Returns the contracts whose aggregate failed, for them to be
+// called one by one.
+func multicallProbeCalls(ctx context.Context, caller Caller, multicall string, contracts []string, outputs map[string]*probeOutputs) []string {
+	n := len(probeCalldata)
+	perAggregate := max(1, multicallSize/n)
+	var groups [][]string
+	for start := 0; start < len(contracts); start += perAggregate {
+		groups = append(groups, contracts[start:min(start+perAggregate, len(contracts))])
+	}
+
+	results := make([]string, len(groups))
+	batch := make([]BatchElem, len(groups))
+	for i, group := range groups {
+		calls := make([]call3, 0, len(group)*n)
+		for _, contract := range group {
+			for _, calldata := range probeCalldata {
+				data, _ := hex.DecodeString(strings.TrimPrefix(calldata, "0x"))
+				calls = append(calls, call3{target: contract, data: data})
+			}
+		}
+		data, err := encodeAggregate3(calls)
+		if err != nil {
+			return contracts
+		}
+		batch[i] = BatchElem{Method: "eth_call", Params: []interface{}{map[string]string{"to": multicall, "data": data}, "latest"}, Result: &results[i]}
+	}
+	if err := callBatches(ctx, caller, batch); err != nil {
+		return contracts
+	}
+
+	var failed []string
+	for i, group := range groups {
+		output, err := hex.DecodeString(strings.TrimPrefix(results[i], "0x"))
+		var decoded []result3
+		if err == nil && batch[i].Error == nil {
+			decoded, err = decodeAggregate3(output, len(group)*n)
+		}
+		if err != nil || batch[i].Error != nil {
+			// A call running out of gas fails the whole aggregate
+			failed = append(failed, group...)
+			continue
+		}
+		for j, contract := range group {
+			outputs[contract] = &probeOutputs{}
+			for k := range probeCalldata {
+				if result := decoded[j*n+k]; result.success {
+					outputs[contract][k] = result.data
+				}
+			}
+		}
+	}
+	return failed
+}
+
+// Function to get the Multicall3 address of chain, empty when the chain has
+// none or it is not deployed there. Whether it is deployed is checked once.
+func (e *Enricher) multicall(ctx context.Context, chain string, caller Caller) string {
+	address := Chains[chain].Multicall3
+	if address == "" {
+		return ""
+	}
+	e.mutex.Lock()
+	deployed, ok := e.multicalls[chain]
+	e.mutex.Unlock()
+	if !ok {
+		var code string
+		if err := caller.Call(ctx, "eth_getCode", []interface{}{address, "latest"}, &code); err != nil {
+			return ""
+		}
+		deployed = !isEOACode(code)
+		e.mutex.Lock()
+		e.multicalls[chain] = deployed
+		e.mutex.Unlock()
+	}
+	if !deployed {
+		return ""
+	}
+	return address
+}
+
+// callBatches sends batch through caller in batches of at most
+// DefaultPoolOptions.BatchSize calls. Pools size their batches themselves.
+func callBatches(ctx context.Context, caller Caller, batch []BatchElem) error {
+	if pool, ok := caller.(*Pool); ok {
+		return pool.BatchCall(ctx, batch)
+	}
+	for start := 0; start < len(batch); start += DefaultPoolOptions.BatchSize {
+		if err := callBatch(ctx, caller, batch[start:min(start+DefaultPoolOptions.BatchSize, len(batch))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEOACode reports whether code belongs to an externally owned account: no
+// code at all, or an EIP-7702 delegation designator (0xef0100 || address)
+func isEOACode(code string) bool {
+	code = strings.ToLower(strings.TrimPrefix(code, "0x"))
+	return code == "" || code == "0" || (len(code) == 46 && strings.HasPrefix(code, "ef0100"))
+}
+
+// isReverted tells a call the contract rejected from a failure to reach the
+// node. Nodes report reverts as JSON-RPC errors, with code 3 (geth) or
+// -32000/-32015 and a message mentioning the revert.
+func isReverted(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	message := strings.ToLower(rpcErr.Message)
+	return rpcErr.Code == 3 || strings.Contains(message, "revert") || strings.Contains(message, "execution")
+}
+
+// decodeUint decodes a single ABI-encoded uint256
+func decodeUint(output []byte) (*big.Int, bool) {
+	if len(output) < 32 {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(output[:32]), true
+}
+
+// decodeString decodes an ABI-encoded string, or a bytes32 as returned by
+// early tokens such as MKR, trimming trailing zero bytes
+func decodeString(output []byte) (string, bool) {
+	var raw []byte
+	switch {
+	case len(output) >= 64:
+		offset, ok := decodeUint(output)
+		if !ok || !offset.IsUint64() || offset.Uint64() > uint64(len(output)-32) {
+			return "", false
+		}
+		start := offset.Uint64()
+		length, _ := decodeUint(output[start:])
+		if !length.IsUint64() || length.Uint64() > uint64(len(output))-start-32 {
+			return "", false
+		}
+		raw = output[start+32 : start+32+length.Uint64()]
+	case len(output) == 32:
+		raw = []byte(strings.TrimRight(string(output), "\x00"))
+	default:
+		return "", false
+	}
+	if !utf8.Valid(raw) {
+		return "", false
+	}
+	return strings.TrimSpace(string(raw)), true
+}
@@ -0,0 +1,358 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	eoaAddress      = "0x1111111111111111111111111111111111111111"
+	contractAddress = "0x2222222222222222222222222222222222222222"
+	tokenAddress    = "0x3333333333333333333333333333333333333333"
+	// bytes32Token returns its symbol and name as bytes32, like MKR
+	bytes32Token = "0x4444444444444444444444444444444444444444"
+)
+
+// node is a JSON-RPC stand-in serving eth_getCode, eth_getStorageAt and
+// eth_call from maps, alone or in batches
+type node struct {
+	code map[string]string
+	// storage maps address and slot to the stored word, missing entries are zero
+	storage map[[2]string]string
+	// calls maps address and calldata to the returned hex data, missing
+	// entries revert
+	calls map[[2]string]string
+	// maxBatch, when set, is the largest batch accepted, larger ones are
+	// rejected with 413
+	maxBatch int
+	mutex    sync.Mutex
+	// requests counts the calls by method, batches counts batch requests
+	requests map[string]int
+	batches  int
+}
+
+type nodeRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func newNode() *node {
+	return &node{code: make(map[string]string), storage: make(map[[2]string]string), calls: make(map[[2]string]string), requests: make(map[string]int)}
+}
+
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		var requests []nodeRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n.maxBatch > 0 && len(requests) > n.maxBatch {
+			http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		n.mutex.Lock()
+		n.batches++
+		n.mutex.Unlock()
+		responses := make([]map[string]interface{}, len(requests))
+		for i, request := range requests {
+			responses[i] = n.answer(request)
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	var request nodeRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(n.answer(request))
+}
+
+func (n *node) answer(request nodeRequest) map[string]interface{} {
+	n.mutex.Lock()
+	n.requests[request.Method]++
+	n.mutex.Unlock()
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch request.Method {
+	case "eth_getCode":
+		var address string
+		json.Unmarshal(request.Params[0], &address)
+		code, ok := n.code[address]
+		if !ok {
+			code = "0x"
+		}
+		response["result"] = code
+	case "eth_getStorageAt":
+		var address, slot string
+		json.Unmarshal(request.Params[0], &address)
+		json.Unmarshal(request.Params[1], &slot)
+		value, ok := n.storage[[2]string{address, slot}]
+		if !ok {
+			value = "0x" + strings.Repeat("0", 64)
+		}
+		response["result"] = value
+	case "eth_call":
+		var call struct{ To, Data string }
+		json.Unmarshal(request.Params[0], &call)
+		if call.To == Multicall3Address && n.code[Multicall3Address] != "" {
+			response["result"] = n.aggregate3(call.Data)
+		} else if output, ok := n.calls[[2]string{call.To, call.Data}]; ok {
+			response["result"] = output
+		} else {
+			response["error"] = map[string]interface{}{"code": 3, "message": "execution reverted"}
+		}
+	default:
+		response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+	return response
+}
+
+// aggregate3 answers a Multicall3 aggregate3 call from the calls of the node
+func (n *node) aggregate3(calldata string) string {
+	input, _ := hex.DecodeString(strings.TrimPrefix(calldata, "0x"+selectorAggregate3))
+	base, _ := readOffset(input, 0)
+	length, _ := readOffset(input, base)
+	var head, tail []byte
+	offset := 32 * length
+	for i := 0; i < length; i++ {
+		tupleOffset, _ := readOffset(input, base+32+32*i)
+		tuple := base + 32 + tupleOffset
+		target := "0x" + hex.EncodeToString(input[tuple+12:tuple+32])
+		dataOffset, _ := readOffset(input, tuple+64)
+		size, _ := readOffset(input, tuple+dataOffset)
+		data := "0x" + hex.EncodeToString(input[tuple+dataOffset+32:tuple+dataOffset+32+size])
+
+		output, ok := n.calls[[2]string{target, data}]
+		returned, _ := hex.DecodeString(strings.TrimPrefix(output, "0x"))
+		success := uint64(0)
+		if ok {
+			success = 1
+		}
+		head = append(head, word(uint64(offset))...)
+		result := append(word(success), word(64)...)
+		result = append(append(result, word(uint64(len(returned)))...), rightPad(returned)...)
+		tail = append(tail, result...)
+		offset += len(result)
+	}
+	output := append(word(32), word(uint64(length))...)
+	return "0x" + hex.EncodeToString(append(append(output, head...), tail...))
+}
+
+func (n *node) count(method string) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.requests[method]
+}
+
+func (n *node) batchCount() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.batches
+}
+
+func encodeUint(value int64) string {
+	return fmt.Sprintf("0x%064x", big.NewInt(value))
+}
+
+func encodeString(value string) string {
+	data := fmt.Sprintf("%064x%064x%s", 32, len(value), hex.EncodeToString([]byte(value)))
+	if padding := len(data) % 64; padding != 0 {
+		data += strings.Repeat("0", 64-padding)
+	}
+	return "0x" + data
+}
+
+func encodeBytes32(value string) string {
+	return "0x" + hex.EncodeToString([]byte(value)) + strings.Repeat("0", 64-2*len(value))
+}
+
+// Function to start a stand-in node with an EOA, a plain contract and two tokens
+func newTestNode(t *testing.T) (*node, *httptest.Server) {
+	t.Helper()
+	n := newNode()
+	n.code[contractAddress] = "0x6080604052"
+	n.code[tokenAddress] = "0x6080604052"
+	n.code[bytes32Token] = "0x6080604052"
+	n.calls[[2]string{tokenAddress, probeCalldata[callDecimals]}] = encodeUint(6)
+	n.calls[[2]string{tokenAddress, probeCalldata[callTotalSupply]}] = encodeUint(1000000)
+	n.calls[[2]string{tokenAddress, probeCalldata[callBalanceOf]}] = encodeUint(0)
+	n.calls[[2]string{tokenAddress, probeCalldata[callSymbol]}] = encodeString("USDC")
+	n.calls[[2]string{tokenAddress, probeCalldata[callName]}] = encodeString("USD Coin")
+	n.calls[[2]string{bytes32Token, probeCalldata[callDecimals]}] = encodeUint(18)
+	n.calls[[2]string{bytes32Token, probeCalldata[callTotalSupply]}] = encodeUint(1)
+	n.calls[[2]string{bytes32Token, probeCalldata[callBalanceOf]}] = encodeUint(0)
+	n.calls[[2]string{bytes32Token, probeCalldata[callSymbol]}] = encodeBytes32("MKR")
+	n.calls[[2]string{bytes32Token, probeCalldata[callName]}] = encodeBytes32("Maker")
+	server := httptest.NewServer(n)
+	t.Cleanup(server.Close)
+	return n, server
+}
+
+func TestClassify(t *testing.T) {
+	n, server := newTestNode(t)
+	enricher := New(map[string]Caller{"ethereum": NewClient(server.URL)})
+
+	tests := []struct {
+		address string
+		want    Classification
+	}{
+		{eoaAddress, Classification{Chain: "ethereum", Type: TypeEOA}},
+		{contractAddress, Classification{Chain: "ethereum", Type: TypeContract}},
+		{tokenAddress, Classification{Chain: "ethereum", Type: TypeERC20, Token: &Token{Symbol: "USDC", Name: "USD Coin", Decimals: 6}}},
+		{bytes32Token, Classification{Chain: "ethereum", Type: TypeERC20, Token: &Token{Symbol: "MKR", Name: "Maker", Decimals: 18}}},
+	}
+	for _, test := range tests {
+		got, err := enricher.Classify(context.Background(), "ethereum", "0x"+strings.ToUpper(test.address[2:]), ClassifyOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error classifying %s: %v", test.address, err)
+		}
+		if got.Type != test.want.Type || (got.Token == nil) != (test.want.Token == nil) || (got.Token != nil && *got.Token != *test.want.Token) {
+			t.Errorf("Classify(%s) = %+v (token %+v), expected %+v (token %+v)", test.address, got, got.Token, test.want, test.want.Token)
+		}
+	}
+
+	// Classifications are cached
+	calls := n.count("eth_getCode")
+	if _, err := enricher.Classify(context.Background(), "ethereum", tokenAddress, ClassifyOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n.count("eth_getCode") != calls {
+		t.Error("Expected the classification to come from the cache")
+	}
+
+	if _, err := enricher.Classify(context.Background(), "polygon", tokenAddress, ClassifyOptions{}); err == nil {
+		t.Error("Expected an error for a chain without a caller")
+	}
+}
+
+func TestClassifyAll(t *testing.T) {
+	_, ethereum := newTestNode(t)
+	polygon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer polygon.Close()
+	enricher := New(map[string]Caller{"ethereum": NewClient(ethereum.URL), "polygon": NewClient(polygon.URL)})
+
+	results := enricher.ClassifyAll(context.Background(), []string{"ethereum", "polygon"}, []string{eoaAddress, tokenAddress, "0x" + strings.ToUpper(tokenAddress[2:])}, ClassifyOptions{})
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 addresses, got %+v", results)
+	}
+	if got := results[tokenAddress]["ethereum"]; got == nil || got.Type != TypeERC20 {
+		t.Errorf("Expected the token to be an ERC-20 on ethereum, got %+v", got)
+	}
+	if got := results[eoaAddress]["polygon"]; got == nil || got.Type != "" || !strings.Contains(got.Error, "503") {
+		t.Errorf("Expected polygon to fail with its status code, got %+v", got)
+	}
+}
+
+func TestClassifyAllBatchesCalls(t *testing.T) {
+	n, server := newTestNode(t)
+	n.code[Multicall3Address] = "0x6080604052"
+	enricher := New(map[string]Caller{"ethereum": NewPool("ethereum", []string{server.URL}, PoolOptions{})})
+
+	addresses := []string{tokenAddress, bytes32Token, contractAddress}
+	for i := 0; i < 40; i++ {
+		addresses = append(addresses, fmt.Sprintf("0x%040x", i+1))
+	}
+	results := enricher.ClassifyAll(context.Background(), []string{"ethereum"}, addresses, ClassifyOptions{})
+	if len(results) != len(addresses) {
+		t.Fatalf("Expected %d addresses, got %d", len(addresses), len(results))
+	}
+	if got := results[bytes32Token]["ethereum"]; got.Type != TypeERC20 || got.Token.Symbol != "MKR" {
+		t.Errorf("Expected MKR to be read through Multicall3, got %+v", got)
+	}
+	if got := results[contractAddress]["ethereum"]; got.Type != TypeContract {
+		t.Errorf("Expected a plain contract, got %+v", got)
+	}
+	// One batch of eth_getCode, a single aggregate of every token call and a
+	// batch reading the proxy slots
+	if batches, calls := n.batchCount(), n.count("eth_call"); batches != 3 || calls != 1 {
+		t.Errorf("Expected 3 batches and 1 eth_call, got %d and %d", batches, calls)
+	}
+}
+
+func TestPoolShrinksRejectedBatches(t *testing.T) {
+	n, server := newTestNode(t)
+	n.maxBatch = 8
+	pool := NewPool("ethereum", []string{server.URL}, PoolOptions{BatchSize: 32})
+
+	codes := make([]string, 40)
+	batch := make([]BatchElem, len(codes))
+	for i := range batch {
+		address := fmt.Sprintf("0x%040x", i+1)
+		if i == 0 {
+			address = contractAddress
+		}
+		batch[i] = BatchElem{Method: "eth_getCode", Params: []interface{}{address, "latest"}, Result: &codes[i]}
+	}
+	if err := pool.BatchCall(context.Background(), batch); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if codes[0] != "0x6080604052" || codes[39] != "0x" {
+		t.Errorf("Expected every call to be answered, got %v", codes)
+	}
+	// 32 and 16 are rejected, 8 is accepted
+	state := pool.State().Endpoints[0]
+	if state.BatchSize != 8 || n.batchCount() != 5 || state.ConsecutiveFailures != 0 {
+		t.Errorf("Expected 5 batches of at most 8, got %d batches and %+v", n.batchCount(), state)
+	}
+}
+
+func TestIsEOACode(t *testing.T) {
+	tests := map[string]bool{
+		"0x":                                  true,
+		"0x0":                                 true,
+		"0x6080":                              false,
+		"0xef0100" + strings.Repeat("ab", 20): true,
+		"0xef0100":                            false,
+	}
+	for code, want := range tests {
+		if got := isEOACode(code); got != want {
+			t.Errorf("isEOACode(%s) = %v, expected %v", code, got, want)
+		}
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+		ok     bool
+	}{
+		{encodeString("Wrapped Ether"), "Wrapped Ether", true},
+		{encodeBytes32("MKR"), "MKR", true},
+		{"0x1234", "", false},
+		// Offset pointing past the end of the output
+		{fmt.Sprintf("0x%064x%064x", 4096, 3), "", false},
+	}
+	for _, test := range tests {
+		output, _ := hex.DecodeString(strings.TrimPrefix(test.output, "0x"))
+		got, ok := decodeString(output)
+		if got != test.want || ok != test.ok {
+			t.Errorf("decodeString(%s) = %q, %v, expected %q, %v", test.output, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestValidateChains(t *testing.T) {
+	if err := ValidateChains([]string{"ethereum", "polygon"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := ValidateChains([]string{"ethereum", "solana"}); err == nil {
+		t.Error("Expected an error for an unsupported chain")
+	}
+}
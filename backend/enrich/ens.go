@@ -0,0 +1,249 @@
+package enrich
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// ENSRegistry is the ENS registry on Ethereum mainnet
+	ENSRegistry = "0x00000000000c2e074ec69a0dfb2997ba6c7d2e1e"
+	// ensChain is the chain ENS names are resolved on
+	ensChain = "ethereum"
+	// maxNameLength bounds the names looked up
+	maxNameLength = 255
+)
+
+var (
+	selectorResolver = selector("resolver(bytes32)")
+	selectorName     = selector("name(bytes32)")
+	selectorAddr     = selector("addr(bytes32)")
+
+	// namePattern matches the ASCII .eth names resolved, which need no
+	// normalization beyond lowercasing
+	namePattern = regexp.MustCompile(`^([a-z0-9_-]+\.)+eth$`)
+)
+
+// Namehash returns the ENS node of name, as defined by EIP-137
+func Namehash(name string) [32]byte {
+	var node [32]byte
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := sha3.NewLegacyKeccak256()
+		label.Write([]byte(labels[i]))
+		hash := sha3.NewLegacyKeccak256()
+		hash.Write(node[:])
+		hash.Write(label.Sum(nil))
+		copy(node[:], hash.Sum(nil))
+	}
+	return node
+}
+
+// NormalizeName lowercases an ASCII .eth name, false when it is not one or
+// its second-level label is shorter than the 3 characters .eth names have
+func NormalizeName(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return "", false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels[len(labels)-2]) < 3 {
+		return "", false
+	}
+	return name, true
+}
+
+// ResolveNames resolves ENS names to the lowercase address their resolver
+// returns for addr(), keyed by normalized name. Names that are invalid, have
+// no resolver or resolve to nothing are left out. Answers are cached,
+// including the absence of one.
+func (e *Enricher) ResolveNames(ctx context.Context, names []string) (map[string]string, error) {
+	caller, ok := e.caller(ensChain)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownChain, ensChain)
+	}
+	resolved := make(map[string]string)
+	var pending []string
+	for _, name := range names {
+		name, ok := NormalizeName(name)
+		if !ok || slices.Contains(pending, name) {
+			continue
+		}
+		if address, ok := e.names.Get("resolve:" + name); ok {
+			if address != "" {
+				resolved[name] = address
+			}
+			continue
+		}
+		pending = append(pending, name)
+	}
+
+	addresses, failed, err := forwardResolve(ctx, caller, pending)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range pending {
+		if failed[i] {
+			continue
+		}
+		e.names.Set("resolve:"+name, addresses[i])
+		if addresses[i] != "" {
+			resolved[name] = addresses[i]
+		}
+	}
+	return resolved, nil
+}
+
+// LookupNames returns the primary ENS name of addresses, keyed by lowercase
+// address. The name of the reverse record only counts when it resolves back
+// to the address, as anyone can claim any name in their reverse record.
+// Addresses without a verified name are left out. Answers are cached,
+// including the absence of one.
+func (e *Enricher) LookupNames(ctx context.Context, addresses []string) (map[string]string, error) {
+	caller, ok := e.caller(ensChain)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownChain, ensChain)
+	}
+	names := make(map[string]string)
+	var pending []string
+	for _, address := range addresses {
+		address = strings.ToLower(address)
+		if !addressPattern.MatchString(address) || slices.Contains(pending, address) {
+			continue
+		}
+		if name, ok := e.names.Get("reverse:" + address); ok {
+			if name != "" {
+				names[address] = name
+			}
+			continue
+		}
+		pending = append(pending, address)
+	}
+
+	nodes := make([][32]byte, len(pending))
+	for i, address := range pending {
+		nodes[i] = Namehash(address[2:] + ".addr.reverse")
+	}
+	outputs, failed, err := callResolvers(ctx, caller, nodes, selectorName)
+	if err != nil {
+		return nil, err
+	}
+	// The claimed names are checked with a forward resolution of them all
+	claimed := make([]string, len(pending))
+	index := make(map[string]int)
+	var forward []string
+	for i, output := range outputs {
+		claimed[i], _ = decodeString(output)
+		if _, ok := index[claimed[i]]; claimed[i] != "" && !ok {
+			index[claimed[i]] = len(forward)
+			forward = append(forward, claimed[i])
+		}
+	}
+	resolved, forwardFailed, err := forwardResolve(ctx, caller, forward)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, address := range pending {
+		if failed[i] {
+			continue
+		}
+		name := ""
+		if claimed[i] != "" {
+			j := index[claimed[i]]
+			if forwardFailed[j] {
+				continue
+			}
+			if resolved[j] == address {
+				name = claimed[i]
+			}
+		}
+		e.names.Set("reverse:"+address, name)
+		if name != "" {
+			names[address] = name
+		}
+	}
+	return names, nil
+}
+
+// Function to resolve names to the address returned by their resolver, empty
+// when there is none. failed is set for the names whose calls failed.
+func forwardResolve(ctx context.Context, caller Caller, names []string) (addresses []string, failed []bool, err error) {
+	nodes := make([][32]byte, len(names))
+	for i, name := range names {
+		nodes[i] = Namehash(name)
+	}
+	outputs, failed, err := callResolvers(ctx, caller, nodes, selectorAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	addresses = make([]string, len(names))
+	for i, output := range outputs {
+		if address, ok := decodeAddress(output); ok && address != "0x0000000000000000000000000000000000000000" {
+			addresses[i] = address
+		}
+	}
+	return addresses, failed, nil
+}
+
+// Function to call a function taking the node of each of nodes on its
+// resolver: a batch asking the registry for the resolvers, then a batch
+// calling them. Outputs are nil for nodes without a resolver or whose
+// resolver reverted, failed is set for the calls that failed otherwise.
+func callResolvers(ctx context.Context, caller Caller, nodes [][32]byte, function string) (outputs [][]byte, failed []bool, err error) {
+	outputs = make([][]byte, len(nodes))
+	failed = make([]bool, len(nodes))
+	if len(nodes) == 0 {
+		return outputs, failed, nil
+	}
+	results := make([]string, len(nodes))
+	batch := make([]BatchElem, len(nodes))
+	for i, node := range nodes {
+		data := selectorResolver + hex.EncodeToString(node[:])
+		batch[i] = BatchElem{Method: "eth_call", Params: []interface{}{map[string]string{"to": ENSRegistry, "data": data}, "latest"}, Result: &results[i]}
+	}
+	if err := callBatches(ctx, caller, batch); err != nil {
+		return nil, nil, fmt.Errorf("eth_call: %w", err)
+	}
+
+	// calls maps the calls to resolvers to their node
+	var calls []int
+	var resolverBatch []BatchElem
+	for i := range nodes {
+		if batch[i].Error != nil {
+			failed[i] = !isReverted(batch[i].Error)
+			continue
+		}
+		output, _ := hex.DecodeString(strings.TrimPrefix(results[i], "0x"))
+		resolver, ok := decodeAddress(output)
+		if !ok || resolver == "0x0000000000000000000000000000000000000000" {
+			continue
+		}
+		data := function + hex.EncodeToString(nodes[i][:])
+		calls = append(calls, i)
+		resolverBatch = append(resolverBatch, BatchElem{Method: "eth_call", Params: []interface{}{map[string]string{"to": resolver, "data": data}, "latest"}, Result: &results[i]})
+	}
+	if len(resolverBatch) == 0 {
+		return outputs, failed, nil
+	}
+	if err := callBatches(ctx, caller, resolverBatch); err != nil {
+		return nil, nil, fmt.Errorf("eth_call: %w", err)
+	}
+	for j, i := range calls {
+		if err := resolverBatch[j].Error; err != nil {
+			failed[i] = !isReverted(err)
+			continue
+		}
+		outputs[i], _ = hex.DecodeString(strings.TrimPrefix(results[i], "0x"))
+	}
+	return outputs, failed, nil
+}
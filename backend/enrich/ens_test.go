@@ -0,0 +1,113 @@
+package enrich
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+)
+
+const (
+	ensWallet   = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	ensImpostor = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	ensResolver = "0xcccccccccccccccccccccccccccccccccccccccc"
+)
+
+func nodeHex(name string) string {
+	node := Namehash(name)
+	return hex.EncodeToString(node[:])
+}
+
+func TestNamehash(t *testing.T) {
+	tests := map[string]string{
+		"":        "0000000000000000000000000000000000000000000000000000000000000000",
+		"eth":     "93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae",
+		"foo.eth": "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f",
+	}
+	for name, want := range tests {
+		if got := nodeHex(name); got != want {
+			t.Errorf("Namehash(%q) = %s, expected %s", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"Vitalik.ETH":           "vitalik.eth",
+		"treasury.protocol.eth": "treasury.protocol.eth",
+		"ab.eth":                "",
+		"ab.cde.eth":            "ab.cde.eth",
+		"eth":                   "",
+		"foo.com":               "",
+		"foo..eth":              "",
+		"föo.eth":               "",
+	}
+	for name, want := range tests {
+		got, ok := NormalizeName(name)
+		if got != want || ok != (want != "") {
+			t.Errorf("NormalizeName(%q) = %q, %v, expected %q", name, got, ok, want)
+		}
+	}
+}
+
+// Function to start a stand-in node where alice.eth resolves to ensWallet,
+// which claims it in its reverse record as does ensImpostor
+func newENSNode(t *testing.T) (*node, *Enricher) {
+	n, server := newTestNode(t)
+	for _, name := range []string{"alice.eth", ensWallet[2:] + ".addr.reverse", ensImpostor[2:] + ".addr.reverse"} {
+		n.calls[[2]string{ENSRegistry, selectorResolver + nodeHex(name)}] = "0x000000000000000000000000" + ensResolver[2:]
+	}
+	n.calls[[2]string{ensResolver, selectorAddr + nodeHex("alice.eth")}] = "0x000000000000000000000000" + ensWallet[2:]
+	n.calls[[2]string{ensResolver, selectorName + nodeHex(ensWallet[2:]+".addr.reverse")}] = encodeString("alice.eth")
+	n.calls[[2]string{ensResolver, selectorName + nodeHex(ensImpostor[2:]+".addr.reverse")}] = encodeString("alice.eth")
+	return n, New(map[string]Caller{"ethereum": NewClient(server.URL)})
+}
+
+func TestResolveNames(t *testing.T) {
+	n, enricher := newENSNode(t)
+
+	resolved, err := enricher.ResolveNames(context.Background(), []string{"Alice.eth", "bob.eth", "ab.eth"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resolved) != 1 || resolved["alice.eth"] != ensWallet {
+		t.Errorf("Expected only alice.eth to resolve, got %v", resolved)
+	}
+
+	// Both the name and the absence of one are cached
+	calls := n.count("eth_call")
+	if resolved, err := enricher.ResolveNames(context.Background(), []string{"alice.eth", "bob.eth"}); err != nil || len(resolved) != 1 {
+		t.Fatalf("Unexpected resolution: %v, %v", resolved, err)
+	}
+	if n.count("eth_call") != calls {
+		t.Error("Expected the resolutions to come from the cache")
+	}
+}
+
+func TestLookupNames(t *testing.T) {
+	n, enricher := newENSNode(t)
+
+	names, err := enricher.LookupNames(context.Background(), []string{"0x" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", ensImpostor, eoaAddress})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The impostor claims alice.eth, which doesn't resolve to it
+	if len(names) != 1 || names[ensWallet] != "alice.eth" {
+		t.Errorf("Expected only the wallet to have a name, got %v", names)
+	}
+	// A batch of resolver() and one of name(), then the same for alice.eth
+	if batches := n.batchCount(); batches != 4 {
+		t.Errorf("Expected 4 batches, got %d", batches)
+	}
+
+	calls := n.count("eth_call")
+	if names, err := enricher.LookupNames(context.Background(), []string{ensWallet, ensImpostor, eoaAddress}); err != nil || len(names) != 1 {
+		t.Fatalf("Unexpected lookup: %v, %v", names, err)
+	}
+	if n.count("eth_call") != calls {
+		t.Error("Expected the names to come from the cache")
+	}
+
+	if _, err := New(nil).LookupNames(context.Background(), []string{ensWallet}); err == nil {
+		t.Error("Expected an error without an ethereum caller")
+	}
+}
@@ -0,0 +1,177 @@
+package enrich
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+const (
+	opEQ     = 0x14
+	opPUSH1  = 0x60
+	opPUSH4  = 0x63
+	opPUSH32 = 0x7f
+	// dispatchWindow is the number of opcodes after a PUSH4 an EQ is looked
+	// for: PUSH4 EQ, or PUSH4 DUP2 EQ as emitted by the IR pipeline
+	dispatchWindow = 2
+)
+
+// template is a well-known contract, recognised when its every function is
+// in the bytecode of a contract
+type template struct {
+	name      string
+	functions []string
+	selectors []string
+}
+
+func newTemplate(name string, functions ...string) template {
+	t := template{name: name, functions: functions}
+	for _, function := range functions {
+		t.selectors = append(t.selectors, strings.TrimPrefix(selector(function), "0x"))
+	}
+	return t
+}
+
+var erc20Functions = []string{
+	"totalSupply()",
+	"balanceOf(address)",
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"allowance(address,address)",
+}
+
+// templates are ordered from the most to the least specific, the first one a
+// contract matches being its Interface
+var templates = []template{
+	newTemplate("uniswap-v2-pair", append([]string{
+		"name()", "symbol()", "decimals()",
+		"DOMAIN_SEPARATOR()", "PERMIT_TYPEHASH()", "nonces(address)",
+		"permit(address,address,uint256,uint256,uint8,bytes32,bytes32)",
+		"MINIMUM_LIQUIDITY()", "factory()", "token0()", "token1()",
+		"getReserves()", "price0CumulativeLast()", "price1CumulativeLast()", "kLast()",
+		"mint(address)", "burn(address)", "swap(uint256,uint256,address,bytes)",
+		"skim(address)", "sync()", "initialize(address,address)",
+	}, erc20Functions...)...),
+	newTemplate("openzeppelin-erc20", append([]string{
+		"name()", "symbol()", "decimals()",
+		// Dropped in OpenZeppelin 5, but a mark of the earlier versions
+		"increaseAllowance(address,uint256)", "decreaseAllowance(address,uint256)",
+	}, erc20Functions...)...),
+	newTemplate("erc721",
+		"balanceOf(address)", "ownerOf(uint256)",
+		"safeTransferFrom(address,address,uint256)",
+		"safeTransferFrom(address,address,uint256,bytes)",
+		"transferFrom(address,address,uint256)",
+		"approve(address,uint256)", "setApprovalForAll(address,bool)",
+		"getApproved(uint256)", "isApprovedForAll(address,address)",
+		"supportsInterface(bytes4)",
+	),
+	newTemplate("uniswap-v2-factory",
+		"feeTo()", "feeToSetter()", "getPair(address,address)",
+		"allPairs(uint256)", "allPairsLength()", "createPair(address,address)",
+		"setFeeTo(address)", "setFeeToSetter(address)",
+	),
+	newTemplate("erc20", erc20Functions...),
+}
+
+// Fingerprint describes a contract from the function selectors in its
+// bytecode
+type Fingerprint struct {
+	// Interface is the most specific template the contract matches
+	Interface string `json:"interface,omitempty"`
+	// Templates are all the templates the contract matches
+	Templates []string `json:"templates,omitempty"`
+	// Functions are the most likely signatures of the selectors found in the
+	// signature database, Unknown the selectors that are not
+	Functions []string `json:"functions,omitempty"`
+	Unknown   []string `json:"unknown,omitempty"`
+}
+
+// fingerprint matches the selectors of code against signatures and the
+// templates, nil when code dispatches no function
+func fingerprint(code string, signatures *Signatures) *Fingerprint {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(code), "0x"))
+	if err != nil {
+		return nil
+	}
+	selectors := extractSelectors(data)
+	if len(selectors) == 0 {
+		return nil
+	}
+	fp := &Fingerprint{}
+	for _, selector := range selectors {
+		if known := signatures.Lookup(selector); len(known) > 0 {
+			fp.Functions = append(fp.Functions, known[0])
+		} else {
+			fp.Unknown = append(fp.Unknown, "0x"+selector)
+		}
+	}
+	for _, template := range templates {
+		matches := true
+		for _, selector := range template.selectors {
+			if !slices.Contains(selectors, selector) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			fp.Templates = append(fp.Templates, template.name)
+		}
+	}
+	if len(fp.Templates) > 0 {
+		fp.Interface = fp.Templates[0]
+	}
+	return fp
+}
+
+// extractSelectors returns the values of the PUSH4 compared with EQ in code,
+// which is how Solidity dispatches calls to functions, in order of
+// appearance. The metadata Solidity appends to the code is skipped.
+func extractSelectors(code []byte) []string {
+	code = trimMetadata(code)
+	var selectors []string
+	for i := 0; i < len(code); i++ {
+		op := code[i]
+		if op < opPUSH1 || op > opPUSH32 {
+			continue
+		}
+		size := int(op-opPUSH1) + 1
+		if op == opPUSH4 && i+size < len(code) && comparedAt(code, i+size+1) {
+			selector := hex.EncodeToString(code[i+1 : i+1+size])
+			if !slices.Contains(selectors, selector) {
+				selectors = append(selectors, selector)
+			}
+		}
+		i += size
+	}
+	return selectors
+}
+
+// comparedAt tells whether one of the dispatchWindow opcodes from position is an EQ
+func comparedAt(code []byte, position int) bool {
+	for i := position; i < min(len(code), position+dispatchWindow); i++ {
+		if code[i] == opEQ {
+			return true
+		}
+		if code[i] >= opPUSH1 && code[i] <= opPUSH32 {
+			return false
+		}
+	}
+	return false
+}
+
+// trimMetadata drops the CBOR-encoded metadata Solidity appends to runtime
+// code, whose length is given by the last two bytes
+func trimMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - length
+	// The metadata is a CBOR map of one to three entries
+	if length == 0 || start < 0 || code[start] < 0xa1 || code[start] > 0xa3 {
+		return code
+	}
+	return code[:start]
+}
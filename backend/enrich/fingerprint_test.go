@@ -0,0 +1,134 @@
+package enrich
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Function to assemble the runtime code of a contract dispatching functions
+// like Solidity does, with a custom error and metadata around them
+func dispatcher(functions ...string) string {
+	code := "0x6080604052"
+	for _, function := range functions {
+		// DUP1 PUSH4 selector EQ PUSH2 destination JUMPI
+		code += "8063" + strings.TrimPrefix(selector(function), "0x") + "14610100" + "57"
+	}
+	// PUSH4 of the custom error Unauthorized() PUSH1 0xe0 SHL
+	code += "63" + strings.TrimPrefix(selector("Unauthorized()"), "0x") + "60e01b"
+	// Metadata holding what looks like a comparison of a PUSH4
+	metadata := "a2" + "63aabbccdd14" + "64736f6c6343"
+	return code + "fe" + metadata + "000d"
+}
+
+var pairFunctions = append([]string{
+	"name()", "symbol()", "decimals()", "DOMAIN_SEPARATOR()", "PERMIT_TYPEHASH()", "nonces(address)",
+	"permit(address,address,uint256,uint256,uint8,bytes32,bytes32)", "MINIMUM_LIQUIDITY()", "factory()",
+	"token0()", "token1()", "getReserves()", "price0CumulativeLast()", "price1CumulativeLast()", "kLast()",
+	"mint(address)", "burn(address)", "swap(uint256,uint256,address,bytes)", "skim(address)", "sync()",
+	"initialize(address,address)",
+}, erc20Functions...)
+
+func TestExtractSelectors(t *testing.T) {
+	code := dispatcher("transfer(address,uint256)", "balanceOf(address)", "transfer(address,uint256)")
+	data := mustDecodeHex(strings.TrimPrefix(code, "0x"))
+	got := extractSelectors(data)
+	if want := []string{"a9059cbb", "70a08231"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	// PUSH4 DUP2 EQ, as the IR pipeline dispatches
+	if got := extractSelectors(mustDecodeHex("63a9059cbb8114")); !slices.Equal(got, []string{"a9059cbb"}) {
+		t.Errorf("Expected the selector compared after a DUP2, got %v", got)
+	}
+	// Data pushed by larger PUSHes is not read as code
+	if got := extractSelectors(mustDecodeHex("6563a9059cbb14")); len(got) != 0 {
+		t.Errorf("Expected no selector in PUSH6 data, got %v", got)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	signatures := NewSignatures()
+	signatures.Add("owner()")
+
+	tests := []struct {
+		name      string
+		code      string
+		iface     string
+		templates []string
+	}{
+		{"pair", dispatcher(pairFunctions...), "uniswap-v2-pair", []string{"uniswap-v2-pair", "erc20"}},
+		{"openzeppelin", dispatcher(append([]string{"name()", "symbol()", "decimals()", "increaseAllowance(address,uint256)", "decreaseAllowance(address,uint256)", "owner()"}, erc20Functions...)...), "openzeppelin-erc20", []string{"openzeppelin-erc20", "erc20"}},
+		{"token", dispatcher(append([]string{"mint(address,uint256)"}, erc20Functions...)...), "erc20", []string{"erc20"}},
+		{"other", dispatcher("owner()", "doSomething(uint256)"), "", nil},
+	}
+	for _, test := range tests {
+		fp := fingerprint(test.code, signatures)
+		if fp == nil || fp.Interface != test.iface || !slices.Equal(fp.Templates, test.templates) {
+			t.Errorf("%s: expected %s and %v, got %+v", test.name, test.iface, test.templates, fp)
+		}
+	}
+
+	fp := fingerprint(dispatcher("owner()", "doSomething(uint256)"), signatures)
+	if !slices.Equal(fp.Functions, []string{"owner()"}) || !slices.Equal(fp.Unknown, []string{selector("doSomething(uint256)")}) {
+		t.Errorf("Expected owner() and an unknown selector, got %+v", fp)
+	}
+	if fp := fingerprint("0x6080604052", signatures); fp != nil {
+		t.Errorf("Expected no fingerprint without functions, got %+v", fp)
+	}
+}
+
+func TestLoadSignatures(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	owner := strings.TrimPrefix(selector("owner()"), "0x")
+	pause := strings.TrimPrefix(selector("pause()"), "0x")
+
+	tests := map[string]string{
+		"signatures.txt": "# Ownable\nowner()\n0x" + pause + " pause()\n\n" + "deadbeef,foo(uint256,address)\n",
+		"map.json":       `{"0x` + owner + `": "owner()", "` + pause + `": ["pause()"], "0xdeadbeef": "foo(uint256,address)"}`,
+		"4byte.json":     `{"count": 3, "results": [{"hex_signature": "0x` + owner + `", "text_signature": "owner()"}, {"hex_signature": "0x` + pause + `", "text_signature": "pause()"}, {"hex_signature": "0xdeadbeef", "text_signature": "foo(uint256,address)"}]}`,
+		"list.json":      `[{"hex_signature": "0x` + owner + `", "text_signature": "owner()"}, {"hex_signature": "0x` + pause + `", "text_signature": "pause()"}, {"hex_signature": "0xdeadbeef", "text_signature": "foo(uint256,address)"}]`,
+	}
+	for name, content := range tests {
+		signatures, err := LoadSignatures(write(name, content))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if signatures.Lookup(owner)[0] != "owner()" || signatures.Lookup("0x" + pause)[0] != "pause()" || signatures.Lookup("0xDEADBEEF")[0] != "foo(uint256,address)" {
+			t.Errorf("%s: expected the signatures to be loaded", name)
+		}
+		// The template functions come built in
+		if signatures.Lookup("a9059cbb")[0] != "transfer(address,uint256)" {
+			t.Errorf("%s: expected the built-in signatures", name)
+		}
+	}
+
+	for _, content := range []string{"0x1234 owner()\n", "not a signature\n", `{"0xdeadbeef": 1}`} {
+		if _, err := LoadSignatures(write("invalid", content)); err == nil {
+			t.Errorf("Expected %q to be rejected", content)
+		}
+	}
+}
+
+func TestClassifyFingerprints(t *testing.T) {
+	n, server := newTestNode(t)
+	n.code[contractAddress] = dispatcher(pairFunctions...)
+	enricher := New(map[string]Caller{"ethereum": NewClient(server.URL)})
+
+	got, err := enricher.Classify(context.Background(), "ethereum", contractAddress, ClassifyOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Fingerprint == nil || got.Fingerprint.Interface != "uniswap-v2-pair" || len(got.Fingerprint.Functions) != len(pairFunctions) {
+		t.Errorf("Expected a Uniswap V2 pair, got %+v", got.Fingerprint)
+	}
+}
@@ -0,0 +1,117 @@
+package enrich
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// Multicall3Address is where Multicall3 is deployed on most chains
+	Multicall3Address = "0xca11bde05977b3631167028862be2a173976ca11"
+	// selectorAggregate3 is aggregate3((address,bool,bytes)[])
+	selectorAggregate3 = "82ad56cb"
+)
+
+var errMalformedOutput = errors.New("malformed multicall output")
+
+// call3 is a call aggregated through Multicall3, allowed to fail on its own
+type call3 struct {
+	target string
+	data   []byte
+}
+
+// result3 is the outcome of a call3
+type result3 struct {
+	success bool
+	data    []byte
+}
+
+// encodeAggregate3 encodes the calldata of aggregate3(calls), every call
+// being allowed to fail
+func encodeAggregate3(calls []call3) (string, error) {
+	var head, tail []byte
+	offset := 32 * len(calls)
+	for _, call := range calls {
+		target, err := hex.DecodeString(strings.TrimPrefix(call.target, "0x"))
+		if err != nil || len(target) != 20 {
+			return "", fmt.Errorf("invalid address %q", call.target)
+		}
+		head = append(head, word(uint64(offset))...)
+		tuple := append(leftPad(target), word(1)...)
+		tuple = append(tuple, word(96)...)
+		tuple = append(tuple, word(uint64(len(call.data)))...)
+		tuple = append(tuple, rightPad(call.data)...)
+		tail = append(tail, tuple...)
+		offset += len(tuple)
+	}
+	data := append(word(32), word(uint64(len(calls)))...)
+	data = append(append(data, head...), tail...)
+	return "0x" + selectorAggregate3 + hex.EncodeToString(data), nil
+}
+
+// decodeAggregate3 decodes the (bool,bytes)[] returned by aggregate3, which
+// must hold n results
+func decodeAggregate3(output []byte, n int) ([]result3, error) {
+	base, ok := readOffset(output, 0)
+	if !ok {
+		return nil, errMalformedOutput
+	}
+	length, ok := readOffset(output, base)
+	if !ok || length != n {
+		return nil, errMalformedOutput
+	}
+	heads := base + 32
+	results := make([]result3, n)
+	for i := range results {
+		offset, ok := readOffset(output, heads+32*i)
+		if !ok {
+			return nil, errMalformedOutput
+		}
+		tuple := heads + offset
+		success, ok := readOffset(output, tuple)
+		if !ok {
+			return nil, errMalformedOutput
+		}
+		dataOffset, ok := readOffset(output, tuple+32)
+		if !ok {
+			return nil, errMalformedOutput
+		}
+		size, ok := readOffset(output, tuple+dataOffset)
+		start := tuple + dataOffset + 32
+		if !ok || start+size > len(output) {
+			return nil, errMalformedOutput
+		}
+		results[i] = result3{success: success == 1, data: output[start : start+size]}
+	}
+	return results, nil
+}
+
+// readOffset reads the word at position as an offset or length into output
+func readOffset(output []byte, position int) (int, bool) {
+	if position < 0 || position+32 > len(output) {
+		return 0, false
+	}
+	value := new(big.Int).SetBytes(output[position : position+32])
+	if !value.IsInt64() || value.Int64() > int64(len(output)) {
+		return 0, false
+	}
+	return int(value.Int64()), true
+}
+
+func word(value uint64) []byte {
+	return new(big.Int).SetUint64(value).FillBytes(make([]byte, 32))
+}
+
+func leftPad(data []byte) []byte {
+	return append(make([]byte, 32-len(data)), data...)
+}
+
+func rightPad(data []byte) []byte {
+	if len(data)%32 == 0 {
+		return data
+	}
+	return append(append([]byte(nil), data...), make([]byte, 32-len(data)%32)...)
+}
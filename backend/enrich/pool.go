@@ -0,0 +1,465 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	EndpointHealthy   = "healthy"
+	EndpointUnhealthy = "unhealthy"
+	// EndpointUnknown endpoints have not been probed yet
+	EndpointUnknown = "unknown"
+)
+
+const (
+	// unhealthyAfter is the number of consecutive failed calls that takes an
+	// endpoint out of rotation until a probe succeeds again
+	unhealthyAfter = 3
+	// maxBlockLag is how many blocks an endpoint may be behind the highest
+	// block of its pool and still be healthy
+	maxBlockLag  = 20
+	probeTimeout = 5 * time.Second
+	// unknownLatency is assumed for endpoints without a measurement, so
+	// measured fast endpoints are preferred over them
+	unknownLatency = time.Second
+	// minLatency keeps a single very fast endpoint from taking every call
+	minLatency = 10 * time.Millisecond
+	// latencySmoothing is the weight of a new latency sample in the moving average
+	latencySmoothing = 0.3
+)
+
+var ErrNoEndpoints = errors.New("no rpc endpoints")
+
+// PoolOptions tunes a Pool, zero fields take the defaults
+type PoolOptions struct {
+	// RateLimit is the number of calls per second allowed to each endpoint,
+	// Burst how many of them may be made at once
+	RateLimit float64
+	Burst     int
+	// Attempts is how many endpoints a call is tried on before failing
+	Attempts int
+	// BatchSize is the largest batch sent to an endpoint at first. It is
+	// halved for an endpoint every time the endpoint rejects a batch.
+	BatchSize int
+}
+
+var DefaultPoolOptions = PoolOptions{RateLimit: 10, Burst: 10, Attempts: 3, BatchSize: 100}
+
+// EndpointState describes an endpoint of a pool
+type EndpointState struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	// LatencyMS is the moving average of the response time of the endpoint
+	LatencyMS   float64 `json:"latency_ms,omitempty"`
+	BlockNumber uint64  `json:"block_number,omitempty"`
+	// ConsecutiveFailures counts the failed calls and probes since the last success
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastProbedAt        *time.Time `json:"last_probed_at,omitempty"`
+	Calls               int64      `json:"calls"`
+	Failures            int64      `json:"failures"`
+	// RateLimited counts the calls that waited for the rate limit of the endpoint
+	RateLimited int64 `json:"rate_limited"`
+	// BatchSize is the largest batch currently sent to the endpoint
+	BatchSize int `json:"batch_size"`
+}
+
+// PoolState describes the endpoints of the pool of a chain
+type PoolState struct {
+	Chain     string          `json:"chain"`
+	Healthy   int             `json:"healthy"`
+	Endpoints []EndpointState `json:"endpoints"`
+}
+
+type endpoint struct {
+	caller  Caller
+	limiter *rate.Limiter
+	state   EndpointState
+	latency time.Duration
+}
+
+// Pool spreads the calls of a chain over several endpoints. Faster endpoints
+// are picked more often, endpoints failing their health probes or several
+// calls in a row are skipped, and a failed call is retried on another
+// endpoint. Pool implements Caller.
+type Pool struct {
+	chain     string
+	opts      PoolOptions
+	mutex     sync.Mutex
+	endpoints []*endpoint
+	now       func() time.Time
+}
+
+// NewPool creates a pool calling urls over HTTP, duplicate URLs are dropped
+func NewPool(chain string, urls []string, opts PoolOptions) *Pool {
+	callers := make(map[string]Caller)
+	for _, url := range urls {
+		callers[url] = NewClient(url)
+	}
+	return newPool(chain, urls, callers, opts)
+}
+
+func newPool(chain string, urls []string, callers map[string]Caller, opts PoolOptions) *Pool {
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = DefaultPoolOptions.RateLimit
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = max(1, int(opts.RateLimit))
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = DefaultPoolOptions.Attempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultPoolOptions.BatchSize
+	}
+	p := &Pool{chain: chain, opts: opts, now: time.Now}
+	seen := make(map[string]bool)
+	for _, url := range urls {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		p.endpoints = append(p.endpoints, &endpoint{
+			caller:  callers[url],
+			limiter: rate.NewLimiter(rate.Limit(opts.RateLimit), opts.Burst),
+			state:   EndpointState{URL: url, Status: EndpointUnknown, BatchSize: opts.BatchSize},
+		})
+	}
+	return p
+}
+
+// Call makes a JSON-RPC call on one endpoint of the pool, trying up to
+// Attempts different endpoints while the call fails for reasons other than
+// the answer of the node, such as a revert
+func (p *Pool) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	tried := make(map[*endpoint]bool)
+	var lastErr error
+	for attempt := 0; attempt < p.opts.Attempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e := p.pick(tried)
+		if e == nil {
+			break
+		}
+		tried[e] = true
+		if err := p.wait(ctx, e); err != nil {
+			return err
+		}
+
+		startedAt := p.now()
+		err := e.caller.Call(ctx, method, params, result)
+		if ctx.Err() != nil {
+			// Not the fault of the endpoint
+			return err
+		}
+		p.record(e, p.now().Sub(startedAt), err)
+		if err == nil || !retryable(ctx, err) {
+			return err
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		return fmt.Errorf("%w for %s", ErrNoEndpoints, p.chain)
+	}
+	return fmt.Errorf("%d %s endpoints failed, last error: %w", len(tried), p.chain, lastErr)
+}
+
+// BatchCall sends batch in as few requests as the endpoints accept. Each
+// request counts once against the rate limit of its endpoint and is retried
+// on other endpoints like a single call. When an endpoint rejects a batch,
+// its batch size is halved and the batch is sent again in smaller parts.
+func (p *Pool) BatchCall(ctx context.Context, batch []BatchElem) error {
+	for len(batch) > 0 {
+		sent, err := p.batchChunk(ctx, batch)
+		if err != nil {
+			return err
+		}
+		batch = batch[sent:]
+	}
+	return nil
+}
+
+// Function to send the start of batch to one endpoint, as much of it as the
+// endpoint accepts, returning how many elements were sent
+func (p *Pool) batchChunk(ctx context.Context, batch []BatchElem) (int, error) {
+	tried := make(map[*endpoint]bool)
+	var lastErr error
+	for len(tried) < p.opts.Attempts {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		e := p.pick(tried)
+		if e == nil {
+			break
+		}
+		if err := p.wait(ctx, e); err != nil {
+			return 0, err
+		}
+		p.mutex.Lock()
+		size := min(e.state.BatchSize, len(batch))
+		p.mutex.Unlock()
+
+		startedAt := p.now()
+		err := callBatch(ctx, e.caller, batch[:size])
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		if errors.Is(err, ErrBatchRejected) && size > 1 {
+			// Not a failure of the endpoint, try again with smaller batches
+			p.mutex.Lock()
+			e.state.BatchSize = min(e.state.BatchSize, size/2)
+			p.mutex.Unlock()
+			continue
+		}
+		tried[e] = true
+		p.record(e, p.now().Sub(startedAt), err)
+		if err == nil {
+			return size, nil
+		}
+		if !retryable(ctx, err) {
+			return 0, err
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		return 0, fmt.Errorf("%w for %s", ErrNoEndpoints, p.chain)
+	}
+	return 0, fmt.Errorf("%d %s endpoints failed, last error: %w", len(tried), p.chain, lastErr)
+}
+
+// callBatch sends batch through caller, one call after another if it
+// doesn't support batches
+func callBatch(ctx context.Context, caller Caller, batch []BatchElem) error {
+	if batcher, ok := caller.(BatchCaller); ok {
+		return batcher.BatchCall(ctx, batch)
+	}
+	for i := range batch {
+		err := caller.Call(ctx, batch[i].Method, batch[i].Params, batch[i].Result)
+		var rpcErr *RPCError
+		if err != nil && !errors.As(err, &rpcErr) {
+			return err
+		}
+		batch[i].Error = err
+	}
+	return nil
+}
+
+// retryable reports whether a failed call may succeed on another endpoint.
+// Errors returned by the node for the call itself, such as reverts, would be
+// returned by every endpoint, except for rate limit errors.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		message := strings.ToLower(rpcErr.Message)
+		return rpcErr.Code == -32005 || strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests")
+	}
+	return true
+}
+
+// Function to pick an endpoint not tried yet, at random with a probability
+// inversely proportional to its latency. Endpoints with rate limit tokens to
+// spare are preferred, and healthy or unprobed endpoints are preferred over
+// unhealthy ones, which are only used when there is nothing else.
+func (p *Pool) pick(tried map[*endpoint]bool) *endpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var usable, available []*endpoint
+	for _, e := range p.endpoints {
+		if tried[e] || e.state.Status == EndpointUnhealthy {
+			continue
+		}
+		usable = append(usable, e)
+		if e.limiter.Tokens() >= 1 {
+			available = append(available, e)
+		}
+	}
+	if len(usable) == 0 {
+		for _, e := range p.endpoints {
+			if !tried[e] {
+				usable = append(usable, e)
+			}
+		}
+	}
+	if len(available) > 0 {
+		usable = available
+	}
+	if len(usable) == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(usable))
+	total := 0.0
+	for i, e := range usable {
+		latency := e.latency
+		if latency == 0 {
+			latency = unknownLatency
+		}
+		weights[i] = 1 / max(latency, minLatency).Seconds()
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return usable[i]
+		}
+		r -= weight
+	}
+	return usable[len(usable)-1]
+}
+
+// Function to wait for the rate limit of an endpoint
+func (p *Pool) wait(ctx context.Context, e *endpoint) error {
+	if e.limiter.Allow() {
+		return nil
+	}
+	p.mutex.Lock()
+	e.state.RateLimited++
+	p.mutex.Unlock()
+	return e.limiter.Wait(ctx)
+}
+
+// Function to record the outcome of a call on an endpoint
+func (p *Pool) record(e *endpoint, latency time.Duration, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	e.state.Calls++
+	if err != nil && retryable(context.Background(), err) {
+		e.state.Failures++
+		e.state.ConsecutiveFailures++
+		e.state.LastError = err.Error()
+		if e.state.ConsecutiveFailures >= unhealthyAfter {
+			e.state.Status = EndpointUnhealthy
+		}
+		return
+	}
+	// A node answering with an error is still responsive
+	e.state.ConsecutiveFailures = 0
+	e.observe(latency)
+}
+
+// observe adds a latency sample to the moving average of the endpoint
+func (e *endpoint) observe(latency time.Duration) {
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(e.latency))
+	}
+	e.state.LatencyMS = float64(e.latency.Microseconds()) / 1000
+}
+
+// Probe calls eth_blockNumber on every endpoint at once and marks each
+// healthy or unhealthy. Endpoints lagging more than maxBlockLag blocks behind
+// the others are unhealthy.
+func (p *Pool) Probe(ctx context.Context) {
+	type probe struct {
+		block   uint64
+		latency time.Duration
+		err     error
+	}
+	probes := make([]probe, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			startedAt := p.now()
+			var block string
+			err := e.caller.Call(ctx, "eth_blockNumber", nil, &block)
+			probes[i].latency = p.now().Sub(startedAt)
+			if err == nil {
+				probes[i].block, err = strconv.ParseUint(strings.TrimPrefix(block, "0x"), 16, 64)
+			}
+			probes[i].err = err
+		}()
+	}
+	wg.Wait()
+
+	var highest uint64
+	for _, probe := range probes {
+		if probe.err == nil {
+			highest = max(highest, probe.block)
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	for i, e := range p.endpoints {
+		probe := probes[i]
+		e.state.LastProbedAt = &now
+		switch {
+		case probe.err != nil:
+			e.state.Status = EndpointUnhealthy
+			e.state.ConsecutiveFailures++
+			e.state.LastError = probe.err.Error()
+		case probe.block+maxBlockLag < highest:
+			e.state.Status = EndpointUnhealthy
+			e.state.BlockNumber = probe.block
+			e.state.LastError = fmt.Sprintf("block %d is more than %d blocks behind %d", probe.block, maxBlockLag, highest)
+			e.observe(probe.latency)
+		default:
+			e.state.Status = EndpointHealthy
+			e.state.BlockNumber = probe.block
+			e.state.ConsecutiveFailures = 0
+			e.observe(probe.latency)
+		}
+	}
+}
+
+// StartProbing probes the pool now and then every interval until ctx is done
+func (p *Pool) StartProbing(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.Probe(ctx)
+			if state := p.State(); state.Healthy == 0 {
+				log.Printf("No healthy rpc endpoint for %s", p.chain)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// State returns the state of every endpoint, fastest healthy endpoints first
+func (p *Pool) State() PoolState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	state := PoolState{Chain: p.chain, Endpoints: make([]EndpointState, 0, len(p.endpoints))}
+	for _, e := range p.endpoints {
+		if e.state.Status == EndpointHealthy {
+			state.Healthy++
+		}
+		state.Endpoints = append(state.Endpoints, e.state)
+	}
+	rank := map[string]int{EndpointHealthy: 0, EndpointUnknown: 1, EndpointUnhealthy: 2}
+	sort.SliceStable(state.Endpoints, func(i, j int) bool {
+		a, b := state.Endpoints[i], state.Endpoints[j]
+		if rank[a.Status] != rank[b.Status] {
+			return rank[a.Status] < rank[b.Status]
+		}
+		return a.LatencyMS < b.LatencyMS
+	})
+	return state
+}
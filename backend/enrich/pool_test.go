@@ -0,0 +1,155 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCaller answers every call with call, counting them
+type fakeCaller struct {
+	calls atomic.Int64
+	call  func(method string, result interface{}) error
+}
+
+func (f *fakeCaller) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	f.calls.Add(1)
+	return f.call(method, result)
+}
+
+func answering(value string) *fakeCaller {
+	return &fakeCaller{call: func(method string, result interface{}) error {
+		*result.(*string) = value
+		return nil
+	}}
+}
+
+func failing(err error) *fakeCaller {
+	return &fakeCaller{call: func(string, interface{}) error { return err }}
+}
+
+func TestPoolRetriesOnAnotherEndpoint(t *testing.T) {
+	down := failing(&HTTPError{StatusCode: 503})
+	up := answering("0x1")
+	pool := newPool("ethereum", []string{"down", "up"}, map[string]Caller{"down": down, "up": up}, PoolOptions{RateLimit: 1000})
+	// Every call takes 100ms, so both endpoints are picked as often until one is skipped
+	clock := time.Now()
+	pool.now = func() time.Time {
+		clock = clock.Add(50 * time.Millisecond)
+		return clock
+	}
+	for _, e := range pool.endpoints {
+		e.latency = 100 * time.Millisecond
+	}
+
+	for i := 0; i < 50; i++ {
+		var result string
+		if err := pool.Call(context.Background(), "eth_chainId", nil, &result); err != nil || result != "0x1" {
+			t.Fatalf("Call %d = %q, %v, expected the answer of the healthy endpoint", i, result, err)
+		}
+	}
+	// The failing endpoint is skipped once it failed several calls in a row
+	if calls := down.calls.Load(); calls != unhealthyAfter {
+		t.Errorf("Expected %d calls to the failing endpoint, got %d", unhealthyAfter, calls)
+	}
+	state := pool.State()
+	if state.Endpoints[0].URL != "up" || state.Endpoints[1].Status != EndpointUnhealthy || state.Endpoints[1].Failures != unhealthyAfter {
+		t.Errorf("Unexpected pool state: %+v", state)
+	}
+}
+
+func TestPoolDoesNotRetryRPCErrors(t *testing.T) {
+	reverted := failing(&RPCError{Code: 3, Message: "execution reverted"})
+	pool := newPool("ethereum", []string{"a", "b"}, map[string]Caller{"a": reverted, "b": reverted}, PoolOptions{})
+
+	var rpcErr *RPCError
+	if err := pool.Call(context.Background(), "eth_call", nil, nil); !errors.As(err, &rpcErr) {
+		t.Fatalf("Expected the revert to be returned, got %v", err)
+	}
+	if calls := reverted.calls.Load(); calls != 1 {
+		t.Errorf("Expected a single call, got %d", calls)
+	}
+	if state := pool.State(); state.Endpoints[0].ConsecutiveFailures != 0 || state.Endpoints[1].ConsecutiveFailures != 0 {
+		t.Errorf("Expected a revert not to count as a failure, got %+v", state)
+	}
+}
+
+func TestPoolProbe(t *testing.T) {
+	pool := newPool("ethereum", []string{"synced", "lagging", "down"}, map[string]Caller{
+		"synced":  answering("0x64"),
+		"lagging": answering("0x32"),
+		"down":    failing(errors.New("connection refused")),
+	}, PoolOptions{})
+	pool.Probe(context.Background())
+
+	state := pool.State()
+	if state.Healthy != 1 || state.Endpoints[0].URL != "synced" || state.Endpoints[0].BlockNumber != 100 || state.Endpoints[0].LastProbedAt == nil {
+		t.Fatalf("Expected only the synced endpoint to be healthy, got %+v", state)
+	}
+	for _, endpoint := range state.Endpoints[1:] {
+		if endpoint.Status != EndpointUnhealthy || endpoint.LastError == "" {
+			t.Errorf("Expected %s to be unhealthy with an error, got %+v", endpoint.URL, endpoint)
+		}
+	}
+}
+
+func TestPoolPrefersFastEndpoints(t *testing.T) {
+	pool := newPool("ethereum", []string{"fast", "slow"}, map[string]Caller{"fast": answering("0x1"), "slow": answering("0x1")}, PoolOptions{})
+	pool.endpoints[0].latency = 50 * time.Millisecond
+	pool.endpoints[1].latency = 500 * time.Millisecond
+
+	picks := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		picks[pool.pick(nil).state.URL]++
+	}
+	// Expected about 10 to 1
+	if picks["fast"] < 800 || picks["slow"] == 0 {
+		t.Errorf("Expected the fast endpoint to be picked most of the time, got %v", picks)
+	}
+}
+
+func TestPoolRateLimit(t *testing.T) {
+	caller := answering("0x1")
+	pool := newPool("ethereum", []string{"only"}, map[string]Caller{"only": caller}, PoolOptions{RateLimit: 20, Burst: 1})
+
+	startedAt := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := pool.Call(context.Background(), "eth_chainId", nil, new(string)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(startedAt); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the calls to be spread over at least 100ms, took %s", elapsed)
+	}
+	if state := pool.State(); state.Endpoints[0].RateLimited != 2 || state.Endpoints[0].Calls != 3 {
+		t.Errorf("Expected 2 of 3 calls to be rate limited, got %+v", state.Endpoints[0])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pool.Call(ctx, "eth_chainId", nil, new(string)); err == nil {
+		t.Error("Expected a cancelled call to fail")
+	}
+}
+
+func TestNewFromEnvCreatesPoolsOnFirstUse(t *testing.T) {
+	_, server := newTestNode(t)
+	t.Setenv("RPC_URLS_ETHEREUM", server.URL)
+	t.Setenv("RPC_PROBE_INTERVAL", "1h")
+	enricher := NewFromEnv()
+
+	if states := enricher.PoolStates(); len(states) != 0 {
+		t.Errorf("Expected no pool before a chain is used, got %+v", states)
+	}
+	if _, err := enricher.Classify(context.Background(), "ethereum", eoaAddress, ClassifyOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if states := enricher.PoolStates(); len(states) != 1 || states[0].Chain != "ethereum" {
+		t.Errorf("Expected only the pool of ethereum, got %+v", states)
+	}
+	if _, ok := enricher.Pool("nowhere"); ok {
+		t.Error("Expected no pool for an unknown chain")
+	}
+}
@@ -0,0 +1,203 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Kinds of proxies
+const (
+	ProxyEIP1967 = "eip1967"
+	ProxyEIP1822 = "eip1822"
+	ProxyBeacon  = "beacon"
+	ProxyEIP1167 = "eip1167"
+)
+
+// Storage slots proxies keep their implementation, beacon and admin in. The
+// EIP-1967 ones are keccak256 of their name minus one, the EIP-1822 one is
+// keccak256("PROXIABLE").
+const (
+	slotImplementation = "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+	slotBeacon         = "0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"
+	slotAdmin          = "0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"
+	slotProxiable      = "0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7"
+)
+
+// selectorImplementation is implementation(), which beacons answer
+var selectorImplementation = selector("implementation()")
+
+// proxySlots are read from every contract, in this order
+var proxySlots = [...]string{slotImplementation, slotBeacon, slotAdmin, slotProxiable}
+
+// minimalProxies are the runtime code of EIP-1167 minimal proxies around the
+// PUSHn of their implementation, up to the PUSH1 of the return jump. The
+// second one is the PUSH0 variant of EIP-7511. Vanity addresses with leading
+// zero bytes are pushed with fewer bytes.
+var minimalProxies = [][2][]byte{
+	{mustDecodeHex("363d3d373d3d3d363d"), mustDecodeHex("5af43d82803e903d91")},
+	{mustDecodeHex("365f5f375f5f365f"), mustDecodeHex("5af43d5f5f3e5f3d91")},
+}
+
+// minimalProxyEnd is the end of minimal proxies, after the PUSH1 of the jump
+var minimalProxyEnd = mustDecodeHex("57fd5bf3")
+
+// Proxy is a contract delegating its calls to an implementation, whose
+// code and functions are those of the logic rather than of the proxy
+type Proxy struct {
+	Kind string `json:"kind"`
+	// Implementation is empty when the beacon of a beacon proxy doesn't
+	// answer implementation()
+	Implementation string `json:"implementation,omitempty"`
+	Beacon         string `json:"beacon,omitempty"`
+	Admin          string `json:"admin,omitempty"`
+	// Classification of the implementation, when asked for
+	Classification *Classification `json:"classification,omitempty"`
+}
+
+func mustDecodeHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// parseMinimalProxy returns the implementation of an EIP-1167 minimal proxy
+// from its runtime code
+func parseMinimalProxy(code string) (string, bool) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(code), "0x"))
+	if err != nil {
+		return "", false
+	}
+	for _, parts := range minimalProxies {
+		prefix, middle := parts[0], parts[1]
+		if !bytes.HasPrefix(data, prefix) || len(data) <= len(prefix) {
+			continue
+		}
+		// PUSH1 (0x60) to PUSH20 (0x73)
+		push := data[len(prefix)]
+		if push < 0x60 || push > 0x73 {
+			continue
+		}
+		size := int(push - 0x5f)
+		rest := data[len(prefix)+1:]
+		if len(rest) != size+len(middle)+2+len(minimalProxyEnd) {
+			continue
+		}
+		if !bytes.HasPrefix(rest[size:], middle) || rest[size+len(middle)] != 0x60 || !bytes.HasSuffix(rest, minimalProxyEnd) {
+			continue
+		}
+		return "0x" + hex.EncodeToString(leftPad(rest[:size])[12:]), true
+	}
+	return "", false
+}
+
+// slotAddress reads an address out of a storage slot, false when the slot is
+// empty or holds something else
+func slotAddress(value string) (string, bool) {
+	slot, ok := new(big.Int).SetString(strings.TrimPrefix(value, "0x"), 16)
+	if !ok || slot.Sign() == 0 || slot.BitLen() > 160 {
+		return "", false
+	}
+	return fmt.Sprintf("0x%040x", slot), true
+}
+
+// Function to find the proxies among contracts, given their code. Minimal
+// proxies are recognised from their code, the others from a batch reading
+// the standard slots of every contract, and a batch of implementation() calls
+// to the beacons found. Contracts that are not proxies are left out.
+func resolveProxies(ctx context.Context, caller Caller, codes map[string]string) (map[string]*Proxy, map[string]error) {
+	proxies := make(map[string]*Proxy)
+	errs := make(map[string]error)
+	var contracts []string
+	for contract, code := range codes {
+		if implementation, ok := parseMinimalProxy(code); ok {
+			proxies[contract] = &Proxy{Kind: ProxyEIP1167, Implementation: implementation}
+		} else {
+			contracts = append(contracts, contract)
+		}
+	}
+	if len(contracts) == 0 {
+		return proxies, errs
+	}
+
+	n := len(proxySlots)
+	values := make([]string, len(contracts)*n)
+	batch := make([]BatchElem, len(contracts)*n)
+	for i, contract := range contracts {
+		for j, slot := range proxySlots {
+			batch[i*n+j] = BatchElem{Method: "eth_getStorageAt", Params: []interface{}{contract, slot, "latest"}, Result: &values[i*n+j]}
+		}
+	}
+	err := callBatches(ctx, caller, batch)
+	// beacons maps the beacons found to the contracts using them
+	beacons := make(map[string][]string)
+	for i, contract := range contracts {
+		var addresses [len(proxySlots)]string
+		for j := range proxySlots {
+			elem := batch[i*n+j]
+			switch {
+			case err != nil:
+				errs[contract] = fmt.Errorf("eth_getStorageAt: %w", err)
+			case elem.Error != nil:
+				errs[contract] = fmt.Errorf("eth_getStorageAt: %w", elem.Error)
+			default:
+				addresses[j], _ = slotAddress(values[i*n+j])
+			}
+		}
+		if errs[contract] != nil {
+			continue
+		}
+
+		implementation, beacon, admin, proxiable := addresses[0], addresses[1], addresses[2], addresses[3]
+		var proxy *Proxy
+		switch {
+		case beacon != "":
+			proxy = &Proxy{Kind: ProxyBeacon, Beacon: beacon}
+			beacons[beacon] = append(beacons[beacon], contract)
+		case implementation != "":
+			proxy = &Proxy{Kind: ProxyEIP1967, Implementation: implementation}
+		case proxiable != "":
+			proxy = &Proxy{Kind: ProxyEIP1822, Implementation: proxiable}
+		default:
+			continue
+		}
+		proxy.Admin = admin
+		proxies[contract] = proxy
+	}
+	if len(beacons) == 0 {
+		return proxies, errs
+	}
+
+	// The implementation of a beacon proxy is the one of its beacon
+	var addresses []string
+	for beacon := range beacons {
+		addresses = append(addresses, beacon)
+	}
+	results := make([]string, len(addresses))
+	batch = make([]BatchElem, len(addresses))
+	for i, beacon := range addresses {
+		batch[i] = BatchElem{Method: "eth_call", Params: []interface{}{map[string]string{"to": beacon, "data": selectorImplementation}, "latest"}, Result: &results[i]}
+	}
+	err = callBatches(ctx, caller, batch)
+	for i, beacon := range addresses {
+		callErr := err
+		if callErr == nil && !isReverted(batch[i].Error) {
+			callErr = batch[i].Error
+		}
+		output, _ := hex.DecodeString(strings.TrimPrefix(results[i], "0x"))
+		implementation, _ := decodeAddress(output)
+		for _, contract := range beacons[beacon] {
+			if callErr != nil {
+				errs[contract] = fmt.Errorf("eth_call: %w", callErr)
+			} else if batch[i].Error == nil {
+				proxies[contract].Implementation = implementation
+			}
+		}
+	}
+	return proxies, errs
+}
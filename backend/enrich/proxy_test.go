@@ -0,0 +1,113 @@
+package enrich
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	transparentProxy = "0x5555555555555555555555555555555555555555"
+	beaconProxy      = "0x6666666666666666666666666666666666666666"
+	beacon           = "0x7777777777777777777777777777777777777777"
+	clone            = "0x8888888888888888888888888888888888888888"
+	proxyAdmin       = "0x9999999999999999999999999999999999999999"
+)
+
+func keccak(data string) *big.Int {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(data))
+	return new(big.Int).SetBytes(hash.Sum(nil))
+}
+
+func TestProxySlots(t *testing.T) {
+	one := big.NewInt(1)
+	tests := map[string]*big.Int{
+		slotImplementation: new(big.Int).Sub(keccak("eip1967.proxy.implementation"), one),
+		slotBeacon:         new(big.Int).Sub(keccak("eip1967.proxy.beacon"), one),
+		slotAdmin:          new(big.Int).Sub(keccak("eip1967.proxy.admin"), one),
+		slotProxiable:      keccak("PROXIABLE"),
+	}
+	for slot, want := range tests {
+		if got := "0x" + hex.EncodeToString(want.FillBytes(make([]byte, 32))); got != slot {
+			t.Errorf("Expected slot %s, got %s", got, slot)
+		}
+	}
+}
+
+func TestParseMinimalProxy(t *testing.T) {
+	tests := []struct {
+		code, implementation string
+	}{
+		{"0x363d3d373d3d3d363d73" + tokenAddress[2:] + "5af43d82803e903d91602b57fd5bf3", tokenAddress},
+		{"0x363D3D373D3D3D363D73" + strings.ToUpper(tokenAddress[2:]) + "5AF43D82803E903D91602B57FD5BF3", tokenAddress},
+		// EIP-7511, with PUSH0
+		{"0x365f5f375f5f365f73" + tokenAddress[2:] + "5af43d5f5f3e5f3d91602a57fd5bf3", tokenAddress},
+		// A vanity address pushed with PUSH17
+		{"0x363d3d373d3d3d363d70" + strings.Repeat("ab", 17) + "5af43d82803e903d91602857fd5bf3", "0x000000" + strings.Repeat("ab", 17)},
+		{"0x363d3d373d3d3d363d73" + tokenAddress[2:] + "5af43d82803e903d91602b57fd5bf300", ""},
+		{"0x363d3d373d3d3d363d73" + tokenAddress[4:] + "5af43d82803e903d91602b57fd5bf3", ""},
+		{"0x6080604052", ""},
+		{"0x", ""},
+	}
+	for _, test := range tests {
+		implementation, ok := parseMinimalProxy(test.code)
+		if implementation != test.implementation || ok != (test.implementation != "") {
+			t.Errorf("parseMinimalProxy(%s) = %q, %v, expected %q", test.code, implementation, ok, test.implementation)
+		}
+	}
+}
+
+func TestClassifyProxies(t *testing.T) {
+	n, server := newTestNode(t)
+	// A transparent proxy of the token, with its admin
+	n.code[transparentProxy] = "0x6080604052"
+	n.storage[[2]string{transparentProxy, slotImplementation}] = "0x000000000000000000000000" + tokenAddress[2:]
+	n.storage[[2]string{transparentProxy, slotAdmin}] = "0x000000000000000000000000" + proxyAdmin[2:]
+	// A beacon proxy whose beacon points at the plain contract
+	n.code[beaconProxy] = "0x6080604052"
+	n.code[beacon] = "0x6080604052"
+	n.storage[[2]string{beaconProxy, slotBeacon}] = "0x000000000000000000000000" + beacon[2:]
+	n.calls[[2]string{beacon, selectorImplementation}] = "0x000000000000000000000000" + contractAddress[2:]
+	// A clone of the MKR-like token
+	n.code[clone] = "0x363d3d373d3d3d363d73" + bytes32Token[2:] + "5af43d82803e903d91602b57fd5bf3"
+	enricher := New(map[string]Caller{"ethereum": NewClient(server.URL)})
+
+	addresses := []string{transparentProxy, beaconProxy, clone, contractAddress}
+	results := enricher.ClassifyAll(context.Background(), []string{"ethereum"}, addresses, ClassifyOptions{})
+	tests := map[string]Proxy{
+		transparentProxy: {Kind: ProxyEIP1967, Implementation: tokenAddress, Admin: proxyAdmin},
+		beaconProxy:      {Kind: ProxyBeacon, Implementation: contractAddress, Beacon: beacon},
+		clone:            {Kind: ProxyEIP1167, Implementation: bytes32Token},
+	}
+	for address, want := range tests {
+		got := results[address]["ethereum"]
+		if got.Error != "" || got.Proxy == nil || *got.Proxy != want {
+			t.Errorf("Expected %s to be a %+v proxy, got %+v (proxy %+v)", address, want, got, got.Proxy)
+		}
+	}
+	if got := results[contractAddress]["ethereum"]; got.Proxy != nil {
+		t.Errorf("Expected a plain contract not to be a proxy, got %+v", got.Proxy)
+	}
+
+	// Implementations are classified when asked for, without touching the
+	// cached classifications of the proxies
+	results = enricher.ClassifyAll(context.Background(), []string{"ethereum"}, addresses, ClassifyOptions{Implementations: true})
+	if got := results[transparentProxy]["ethereum"].Proxy.Classification; got == nil || got.Type != TypeERC20 || got.Token.Symbol != "USDC" {
+		t.Errorf("Expected the implementation to be the token, got %+v", got)
+	}
+	if got := results[clone]["ethereum"].Proxy.Classification; got == nil || got.Type != TypeERC20 || got.Token.Symbol != "MKR" {
+		t.Errorf("Expected the implementation to be the token, got %+v", got)
+	}
+	if got := results[beaconProxy]["ethereum"].Proxy.Classification; got == nil || got.Type != TypeContract {
+		t.Errorf("Expected the implementation to be a plain contract, got %+v", got)
+	}
+	cached, _ := enricher.Classify(context.Background(), "ethereum", transparentProxy, ClassifyOptions{})
+	if cached.Proxy.Classification != nil {
+		t.Errorf("Expected the cached proxy to be left without its implementation, got %+v", cached.Proxy)
+	}
+}
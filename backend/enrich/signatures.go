@@ -0,0 +1,154 @@
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	selectorPattern  = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{8}$`)
+	signaturePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*\(.*\)$`)
+)
+
+// Signatures maps function selectors to the text signatures known for them,
+// like the 4byte directory. A selector can have several signatures, the
+// first one added being the most likely.
+type Signatures struct {
+	bySelector map[string][]string
+}
+
+// NewSignatures returns a database holding the functions of the templates
+func NewSignatures() *Signatures {
+	s := &Signatures{bySelector: make(map[string][]string)}
+	for _, template := range templates {
+		for _, signature := range template.functions {
+			s.Add(signature)
+		}
+	}
+	return s
+}
+
+// Add adds a text signature, e.g. transfer(address,uint256)
+func (s *Signatures) Add(signature string) {
+	s.add(strings.TrimPrefix(selector(signature), "0x"), signature)
+}
+
+func (s *Signatures) add(selector, signature string) {
+	selector = strings.ToLower(strings.TrimPrefix(selector, "0x"))
+	for _, known := range s.bySelector[selector] {
+		if known == signature {
+			return
+		}
+	}
+	s.bySelector[selector] = append(s.bySelector[selector], signature)
+}
+
+// Lookup returns the signatures of a selector, written with or without 0x
+func (s *Signatures) Lookup(selector string) []string {
+	return s.bySelector[strings.ToLower(strings.TrimPrefix(selector, "0x"))]
+}
+
+// Len returns the number of selectors known
+func (s *Signatures) Len() int {
+	return len(s.bySelector)
+}
+
+// signatureEntry is an entry of the 4byte directory API
+type signatureEntry struct {
+	HexSignature  string `json:"hex_signature"`
+	TextSignature string `json:"text_signature"`
+}
+
+// LoadSignatures reads a signature database on top of the functions of the
+// templates. JSON files hold either an object mapping selectors to a
+// signature or a list of them, or 4byte directory entries, as a list or the
+// results of an API page. Text files hold one signature per line, optionally
+// preceded by its selector and a space, tab, comma or colon; blank lines and
+// lines starting with # are skipped.
+func LoadSignatures(path string) (*Signatures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSignatures()
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		if err := s.loadJSON(trimmed); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return s, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		selector, signature := "", text
+		if i := strings.IndexAny(text, " \t,:"); i > 0 && selectorPattern.MatchString(text[:i]) {
+			selector, signature = text[:i], strings.TrimSpace(text[i+1:])
+		}
+		if !signaturePattern.MatchString(signature) {
+			return nil, fmt.Errorf("%s:%d: invalid signature %q", path, line, signature)
+		}
+		if selector == "" {
+			s.Add(signature)
+		} else {
+			s.add(selector, signature)
+		}
+	}
+	return s, scanner.Err()
+}
+
+// Function to load the JSON formats of LoadSignatures
+func (s *Signatures) loadJSON(data []byte) error {
+	var page struct {
+		Results []signatureEntry `json:"results"`
+	}
+	var entries []signatureEntry
+	var bySelector map[string]json.RawMessage
+	switch {
+	case data[0] == '[':
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+	case json.Unmarshal(data, &page) == nil && page.Results != nil:
+		entries = page.Results
+	default:
+		if err := json.Unmarshal(data, &bySelector); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if !selectorPattern.MatchString(entry.HexSignature) || !signaturePattern.MatchString(entry.TextSignature) {
+			return fmt.Errorf("invalid entry %+v", entry)
+		}
+		s.add(entry.HexSignature, entry.TextSignature)
+	}
+	for selector, raw := range bySelector {
+		var signatures []string
+		if err := json.Unmarshal(raw, &signatures); err != nil {
+			var signature string
+			if err := json.Unmarshal(raw, &signature); err != nil {
+				return fmt.Errorf("selector %s: expected a signature or a list of them", selector)
+			}
+			signatures = []string{signature}
+		}
+		if !selectorPattern.MatchString(selector) {
+			return fmt.Errorf("invalid selector %q", selector)
+		}
+		for _, signature := range signatures {
+			if !signaturePattern.MatchString(signature) {
+				return fmt.Errorf("selector %s: invalid signature %q", selector, signature)
+			}
+			s.add(selector, signature)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package enrich
+
+import (
+	"encoding/hex"
+	"math/big"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	TypeERC721  = "erc721"
+	TypeERC1155 = "erc1155"
+	TypeERC4626 = "erc4626"
+	TypeSafe    = "safe"
+	TypeERC4337 = "erc4337"
+
+	// ERC-165 interface IDs
+	interfaceERC165  = "01ffc9a7"
+	interfaceInvalid = "ffffffff"
+	interfaceERC721  = "80ac58cd"
+	interfaceERC1155 = "d9b67a26"
+)
+
+// typePrecedence orders the standards from the most to the least specific,
+// the first one an address implements being its Type
+var typePrecedence = []string{TypeSafe, TypeERC4337, TypeERC4626, TypeERC1155, TypeERC721, TypeERC20}
+
+// EntryPoints are the ERC-4337 EntryPoint deployments by version, the same on every chain
+var EntryPoints = map[string]string{
+	"0x5ff137d4b0fdcd49dca30c7cf57e578a026d2789": "v0.6",
+	"0x0000000071727de22e5e9d8baf0edac6f37da032": "v0.7",
+	"0x4337084d9e255ff0702461cf8895ce9e3b5ff108": "v0.8",
+}
+
+// Indexes of the calls made to every contract in probeCalldata
+const (
+	callDecimals = iota
+	callTotalSupply
+	callBalanceOf
+	callSymbol
+	callName
+	callSupportsERC165
+	callSupportsInvalid
+	callSupportsERC721
+	callSupportsERC1155
+	callAsset
+	callTotalAssets
+	callThreshold
+	callOwners
+	callVersion
+	callEntryPoint
+)
+
+// probeCalldata are the calls telling standards apart: the ERC-20 functions,
+// with balanceOf asked for the zero address, ERC-165 supportsInterface
+// checks, ERC-4626 asset() and totalAssets(), the Safe getters and the
+// entryPoint() of ERC-4337 accounts
+var probeCalldata = [...]string{
+	callDecimals:        selector("decimals()"),
+	callTotalSupply:     selector("totalSupply()"),
+	callBalanceOf:       selector("balanceOf(address)") + strings.Repeat("0", 64),
+	callSymbol:          selector("symbol()"),
+	callName:            selector("name()"),
+	callSupportsERC165:  supportsInterface(interfaceERC165),
+	callSupportsInvalid: supportsInterface(interfaceInvalid),
+	callSupportsERC721:  supportsInterface(interfaceERC721),
+	callSupportsERC1155: supportsInterface(interfaceERC1155),
+	callAsset:           selector("asset()"),
+	callTotalAssets:     selector("totalAssets()"),
+	callThreshold:       selector("getThreshold()"),
+	callOwners:          selector("getOwners()"),
+	callVersion:         selector("VERSION()"),
+	callEntryPoint:      selector("entryPoint()"),
+}
+
+// probeOutputs holds the output of each of probeCalldata for a contract, nil
+// for calls that reverted
+type probeOutputs [len(probeCalldata)][]byte
+
+// Token is the metadata of an ERC-20 token. Symbol and Name are optional in
+// the standard and left empty when the token doesn't implement them.
+type Token struct {
+	Symbol   string `json:"symbol,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals"`
+}
+
+// Collection is the name and symbol of an ERC-721 or ERC-1155 contract, when
+// it implements the optional metadata functions
+type Collection struct {
+	Name   string `json:"name,omitempty"`
+	Symbol string `json:"symbol,omitempty"`
+}
+
+// Vault is an ERC-4626 vault, whose shares are an ERC-20 token
+type Vault struct {
+	// Asset is the ERC-20 token deposited into the vault
+	Asset       string `json:"asset"`
+	TotalAssets string `json:"total_assets"`
+}
+
+// Safe is a Safe (formerly Gnosis Safe) multisig
+type Safe struct {
+	Version   string   `json:"version,omitempty"`
+	Threshold uint64   `json:"threshold"`
+	Owners    []string `json:"owners"`
+}
+
+// Account is an ERC-4337 smart account
+type Account struct {
+	EntryPoint string `json:"entry_point"`
+	// EntryPointVersion is empty for EntryPoints other than the canonical ones
+	EntryPointVersion string `json:"entry_point_version,omitempty"`
+}
+
+// selector returns the calldata of a function without arguments
+func selector(signature string) string {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(signature))
+	return "0x" + hex.EncodeToString(hash.Sum(nil)[:4])
+}
+
+func supportsInterface(id string) string {
+	return selector("supportsInterface(bytes4)") + id + strings.Repeat("0", 56)
+}
+
+// Function to fill in the standards a contract implements, with their
+// metadata, from the outputs of its probe calls. Contracts implementing none
+// are left a plain contract.
+func describe(classification *Classification, outputs *probeOutputs) {
+	classification.Type = TypeContract
+	if outputs == nil {
+		return
+	}
+	var standards []string
+
+	// ERC-165 requires supportsInterface to answer false for 0xffffffff, so
+	// contracts answering true to anything are not taken at their word
+	erc165 := decodeBool(outputs[callSupportsERC165]) == 1 && decodeBool(outputs[callSupportsInvalid]) == 0
+	if erc165 && decodeBool(outputs[callSupportsERC721]) == 1 {
+		standards = append(standards, TypeERC721)
+	}
+	if erc165 && decodeBool(outputs[callSupportsERC1155]) == 1 {
+		standards = append(standards, TypeERC1155)
+	}
+	if len(standards) > 0 {
+		name, _ := decodeString(outputs[callName])
+		symbol, _ := decodeString(outputs[callSymbol])
+		if name != "" || symbol != "" {
+			classification.Collection = &Collection{Name: name, Symbol: symbol}
+		}
+	} else if token := erc20Token(outputs); token != nil {
+		standards = append(standards, TypeERC20)
+		classification.Token = token
+		if vault := erc4626Vault(outputs); vault != nil {
+			standards = append(standards, TypeERC4626)
+			classification.Vault = vault
+		}
+	}
+	if safe := safeMultisig(outputs); safe != nil {
+		standards = append(standards, TypeSafe)
+		classification.Safe = safe
+	}
+	if entryPoint, ok := decodeAddress(outputs[callEntryPoint]); ok && EntryPoints[entryPoint] != "" {
+		standards = append(standards, TypeERC4337)
+		classification.Account = &Account{EntryPoint: entryPoint, EntryPointVersion: EntryPoints[entryPoint]}
+	}
+
+	for _, standard := range typePrecedence {
+		if slices.Contains(standards, standard) {
+			classification.Type = standard
+			break
+		}
+	}
+	classification.Standards = standards
+}
+
+// Function to read the ERC-20 metadata of a contract. A contract is taken for
+// a token when decimals(), totalSupply() and balanceOf() all return a
+// well-formed value, a nil token means it is not one.
+func erc20Token(outputs *probeOutputs) *Token {
+	decimals, ok := decodeUint(outputs[callDecimals])
+	if !ok || !decimals.IsUint64() || decimals.Uint64() > 255 {
+		return nil
+	}
+	if _, ok := decodeUint(outputs[callTotalSupply]); !ok {
+		return nil
+	}
+	if _, ok := decodeUint(outputs[callBalanceOf]); !ok {
+		return nil
+	}
+	token := &Token{Decimals: uint8(decimals.Uint64())}
+	token.Symbol, _ = decodeString(outputs[callSymbol])
+	token.Name, _ = decodeString(outputs[callName])
+	return token
+}
+
+// Function to read the ERC-4626 metadata of an ERC-20 token, nil when it is
+// not a vault
+func erc4626Vault(outputs *probeOutputs) *Vault {
+	asset, ok := decodeAddress(outputs[callAsset])
+	if !ok || asset == "0x0000000000000000000000000000000000000000" {
+		return nil
+	}
+	totalAssets, ok := decodeUint(outputs[callTotalAssets])
+	if !ok {
+		return nil
+	}
+	return &Vault{Asset: asset, TotalAssets: totalAssets.String()}
+}
+
+// Function to read the owners and threshold of a Safe, nil when the contract
+// is not one. A Safe has at least one owner and a threshold between one and
+// the number of owners.
+func safeMultisig(outputs *probeOutputs) *Safe {
+	threshold, ok := decodeUint(outputs[callThreshold])
+	if !ok || !threshold.IsUint64() || threshold.Uint64() == 0 {
+		return nil
+	}
+	owners, ok := decodeAddresses(outputs[callOwners])
+	if !ok || threshold.Uint64() > uint64(len(owners)) {
+		return nil
+	}
+	version, _ := decodeString(outputs[callVersion])
+	return &Safe{Version: version, Threshold: threshold.Uint64(), Owners: owners}
+}
+
+// decodeBool decodes an ABI-encoded bool as 0 or 1, or -1 when output is not one
+func decodeBool(output []byte) int {
+	value, ok := decodeUint(output)
+	if !ok || !value.IsInt64() || value.Int64() > 1 {
+		return -1
+	}
+	return int(value.Int64())
+}
+
+// decodeAddress decodes an ABI-encoded address into lowercase hex
+func decodeAddress(output []byte) (string, bool) {
+	if len(output) < 32 || new(big.Int).SetBytes(output[:12]).Sign() != 0 {
+		return "", false
+	}
+	return "0x" + hex.EncodeToString(output[12:32]), true
+}
+
+// decodeAddresses decodes an ABI-encoded address[]
+func decodeAddresses(output []byte) ([]string, bool) {
+	offset, ok := readOffset(output, 0)
+	if !ok {
+		return nil, false
+	}
+	length, ok := readOffset(output, offset)
+	if !ok || offset+32+32*length > len(output) {
+		return nil, false
+	}
+	addresses := make([]string, length)
+	for i := range addresses {
+		start := offset + 32 + 32*i
+		if addresses[i], ok = decodeAddress(output[start : start+32]); !ok {
+			return nil, false
+		}
+	}
+	return addresses, true
+}
@@ -0,0 +1,111 @@
+package enrich
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	tests := map[string]string{
+		"decimals()":                "0x313ce567",
+		"balanceOf(address)":        "0x70a08231",
+		"supportsInterface(bytes4)": "0x01ffc9a7",
+		"getThreshold()":            "0xe75235b8",
+		"entryPoint()":              "0xb0d691fe",
+	}
+	for signature, want := range tests {
+		if got := selector(signature); got != want {
+			t.Errorf("selector(%s) = %s, expected %s", signature, got, want)
+		}
+	}
+	if got := probeCalldata[callSupportsERC721]; got != "0x01ffc9a780ac58cd"+strings.Repeat("0", 56) {
+		t.Errorf("Unexpected supportsInterface calldata %s", got)
+	}
+}
+
+func output(hexData string) []byte {
+	data, _ := hex.DecodeString(strings.TrimPrefix(hexData, "0x"))
+	return data
+}
+
+func addressOutput(address string) []byte {
+	return output(fmt.Sprintf("%064s", strings.TrimPrefix(address, "0x")))
+}
+
+func TestDescribe(t *testing.T) {
+	const asset = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	erc20 := func(outputs *probeOutputs) {
+		outputs[callDecimals] = output(encodeUint(18))
+		outputs[callTotalSupply] = output(encodeUint(1000))
+		outputs[callBalanceOf] = output(encodeUint(0))
+		outputs[callSymbol] = output(encodeString("TKN"))
+		outputs[callName] = output(encodeString("Token"))
+	}
+	erc165 := func(outputs *probeOutputs, interfaces ...int) {
+		outputs[callSupportsERC165] = output(encodeUint(1))
+		outputs[callSupportsInvalid] = output(encodeUint(0))
+		for _, i := range interfaces {
+			outputs[i] = output(encodeUint(1))
+		}
+	}
+
+	tests := []struct {
+		name      string
+		setup     func(outputs *probeOutputs)
+		wantType  string
+		standards []string
+		check     func(c Classification) bool
+	}{
+		{"plain contract", func(*probeOutputs) {}, TypeContract, nil, func(c Classification) bool { return c.Token == nil }},
+		{"erc20", erc20, TypeERC20, []string{TypeERC20}, func(c Classification) bool { return c.Token.Symbol == "TKN" && c.Token.Decimals == 18 }},
+		{"erc721", func(o *probeOutputs) {
+			erc165(o, callSupportsERC721)
+			o[callName] = output(encodeString("Punks"))
+			o[callSymbol] = output(encodeString("PUNK"))
+			o[callTotalSupply] = output(encodeUint(10000))
+		}, TypeERC721, []string{TypeERC721}, func(c Classification) bool {
+			return c.Token == nil && c.Collection != nil && c.Collection.Symbol == "PUNK"
+		}},
+		{"erc1155", func(o *probeOutputs) { erc165(o, callSupportsERC1155) }, TypeERC1155, []string{TypeERC1155}, func(c Classification) bool { return c.Collection == nil }},
+		{"erc4626", func(o *probeOutputs) {
+			erc20(o)
+			o[callAsset] = addressOutput(asset)
+			o[callTotalAssets] = output(encodeUint(5000))
+		}, TypeERC4626, []string{TypeERC20, TypeERC4626}, func(c Classification) bool {
+			return c.Token != nil && c.Vault.Asset == asset && c.Vault.TotalAssets == "5000"
+		}},
+		{"safe", func(o *probeOutputs) {
+			o[callThreshold] = output(encodeUint(2))
+			o[callOwners] = output(fmt.Sprintf("%064x%064x%064x%064x", 32, 2, 1, 2))
+			o[callVersion] = output(encodeString("1.3.0"))
+		}, TypeSafe, []string{TypeSafe}, func(c Classification) bool {
+			return c.Safe.Threshold == 2 && len(c.Safe.Owners) == 2 && c.Safe.Owners[1] == "0x0000000000000000000000000000000000000002" && c.Safe.Version == "1.3.0"
+		}},
+		{"safe with a threshold above its owners", func(o *probeOutputs) {
+			o[callThreshold] = output(encodeUint(3))
+			o[callOwners] = output(fmt.Sprintf("%064x%064x%064x", 32, 1, 1))
+		}, TypeContract, nil, func(c Classification) bool { return c.Safe == nil }},
+		{"erc4337", func(o *probeOutputs) {
+			o[callEntryPoint] = addressOutput("0x0000000071727de22e5e9d8baf0edac6f37da032")
+		}, TypeERC4337, []string{TypeERC4337}, func(c Classification) bool { return c.Account.EntryPointVersion == "v0.7" }},
+		{"unknown entry point", func(o *probeOutputs) {
+			o[callEntryPoint] = addressOutput(asset)
+		}, TypeContract, nil, func(c Classification) bool { return c.Account == nil }},
+		// Answering true to every interface, 0xffffffff included, proves nothing
+		{"erc165 liar", func(o *probeOutputs) {
+			erc165(o, callSupportsERC721, callSupportsERC1155, callSupportsInvalid)
+		}, TypeContract, nil, func(c Classification) bool { return true }},
+	}
+	for _, test := range tests {
+		outputs := &probeOutputs{}
+		test.setup(outputs)
+		classification := Classification{Chain: "ethereum"}
+		describe(&classification, outputs)
+		if classification.Type != test.wantType || !slices.Equal(classification.Standards, test.standards) || !test.check(classification) {
+			t.Errorf("%s: got %+v", test.name, classification)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package history
+
+import (
+	"backend/core"
+	"context"
+)
+
+// AddressReport is everything history knows about one address
+type AddressReport struct {
+	// Address is the EIP-55 checksummed form
+	Address    string      `json:"address"`
+	Sightings  []Sighting  `json:"sightings"`
+	References []Reference `json:"references"`
+}
+
+// LookupAddress lists the sites and sources that referenced address, which
+// may be given in any case but must carry a valid checksum if mixed-case.
+// core.ErrInvalidAddress, core.ErrInvalidChecksum and ErrInvalidLimit are
+// the caller's fault.
+func LookupAddress(ctx context.Context, store Store, address string, limit int) (*AddressReport, error) {
+	normalized, err := core.NormalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 0 || limit > maxLimit {
+		return nil, ErrInvalidLimit
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	sightings, err := store.Sightings(ctx, Filter{Address: normalized, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	references, err := store.References(ctx, normalized, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &AddressReport{Address: core.ChecksumAddress(normalized), Sightings: sightings, References: references}, nil
+}
@@ -0,0 +1,248 @@
+package history
+
+import (
+	"backend/core"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SourceAPI    = "api"
+	SourceJob    = "job"
+	SourceStream = "stream"
+	SourceCLI    = "cli"
+	SourceWatch  = "watch"
+
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+var (
+	ErrNotFound     = errors.New("run not found")
+	ErrInvalidLimit = fmt.Errorf("limit must be between 0 and %d", maxLimit)
+)
+
+// Run is one call to core.ScrapeContext with what it fetched and found
+type Run struct {
+	ID         int64       `json:"id"`
+	Source     string      `json:"source"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Partial    bool        `json:"partial"`
+	Targets    []TargetRun `json:"targets,omitempty"`
+	Findings   []Finding   `json:"findings,omitempty"`
+}
+
+// TargetRun is the outcome of one target of a run
+type TargetRun struct {
+	RunID         int64     `json:"run_id"`
+	Target        string    `json:"target"`
+	Status        string    `json:"status"`
+	Cached        bool      `json:"cached"`
+	HTTPCode      int       `json:"http_code,omitempty"`
+	Addresses     int       `json:"addresses"`
+	ErrorCategory string    `json:"error_category,omitempty"`
+	ErrorMessage  string    `json:"error_message,omitempty"`
+	FetchedAt     time.Time `json:"fetched_at"`
+	// FailedScripts are the scripts of the target that could not be fetched,
+	// whose addresses are unknown for the run
+	FailedScripts []string `json:"failed_scripts,omitempty"`
+}
+
+// Finding is an address found in one source of a target during a run
+type Finding struct {
+	RunID int64 `json:"run_id"`
+	// Address is lowercased, Variant is how it was written in the source
+	Address string    `json:"address"`
+	Variant string    `json:"variant"`
+	Target  string    `json:"target"`
+	Src     string    `json:"src"`
+	Type    string    `json:"type"`
+	Count   int       `json:"count"`
+	SeenAt  time.Time `json:"seen_at"`
+	// Context is the text around the address in Src
+	Context string `json:"context,omitempty"`
+	// Severity and Lookalikes are set when the address resembled a trusted
+	// or previously seen one
+	Severity   string           `json:"severity,omitempty"`
+	Lookalikes []core.Lookalike `json:"lookalikes,omitempty"`
+}
+
+// Sighting summarizes every run in which an address was found on a target
+type Sighting struct {
+	Target    string    `json:"target"`
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// SeenCount is the number of runs that found the address on the target
+	SeenCount int `json:"seen_count"`
+}
+
+// Reference is one source in which an address was found, over every run
+type Reference struct {
+	Address string `json:"address"`
+	// Variant and Context are taken from the latest run that found the address in Src
+	Variant   string    `json:"variant"`
+	Target    string    `json:"target"`
+	Src       string    `json:"src"`
+	Type      string    `json:"type"`
+	Context   string    `json:"context,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	SeenCount int       `json:"seen_count"`
+}
+
+// Filter narrows history queries down by target, address and time range.
+// Zero fields don't filter.
+type Filter struct {
+	Target  string    `form:"target"`
+	Address string    `form:"address"`
+	From    time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To      time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit   int       `form:"limit"`
+}
+
+// Validate checks the filter and fills in the default limit
+func (f *Filter) Validate() error {
+	if f.Limit < 0 || f.Limit > maxLimit {
+		return ErrInvalidLimit
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultLimit
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		return errors.New("to must not be before from")
+	}
+	f.Address = strings.ToLower(f.Address)
+	return nil
+}
+
+// Store persists scrape runs. Every implementation must be safe for
+// concurrent use.
+type Store interface {
+	// SaveRun stores run with its targets and findings, updates the
+	// sightings of its addresses and returns the ID of the run
+	SaveRun(ctx context.Context, run *Run) (int64, error)
+	// GetRun returns a run with its targets and findings
+	GetRun(ctx context.Context, id int64) (*Run, error)
+	// Runs lists runs, newest first, without their findings. Filtering by
+	// target keeps only that target of each run.
+	Runs(ctx context.Context, filter Filter) ([]Run, error)
+	// Findings lists findings, newest first
+	Findings(ctx context.Context, filter Filter) ([]Finding, error)
+	// Sightings lists addresses per target, most recently seen first. The
+	// time range selects sightings overlapping it.
+	Sightings(ctx context.Context, filter Filter) ([]Sighting, error)
+	// References lists every source an address was found in, most recently
+	// seen first. The address must be lowercase.
+	References(ctx context.Context, address string, limit int) ([]Reference, error)
+
+	// CreateWatchlist stores a validated watchlist and returns its ID, or
+	// ErrTooManyWatchlists if its owner already has MaxWatchlistsPerOwner
+	CreateWatchlist(ctx context.Context, watchlist *Watchlist) (int64, error)
+	// GetWatchlist returns ErrWatchlistNotFound for an unknown ID
+	GetWatchlist(ctx context.Context, id int64) (*Watchlist, error)
+	// Watchlists lists every watchlist, oldest first
+	Watchlists(ctx context.Context) ([]Watchlist, error)
+	// DeleteWatchlist removes a watchlist along with its diffs, the runs are kept
+	DeleteWatchlist(ctx context.Context, id int64) error
+	// SaveDiff stores diff and makes its run the last run of the watchlist
+	SaveDiff(ctx context.Context, diff *Diff) (int64, error)
+	// Diffs lists the diffs of a watchlist, newest first
+	Diffs(ctx context.Context, watchlistID int64, filter DiffFilter) ([]Diff, error)
+
+	// CreateWebhook stores a validated webhook and returns its ID
+	CreateWebhook(ctx context.Context, webhook *Webhook) (int64, error)
+	// GetWebhook returns ErrWebhookNotFound for an unknown ID
+	GetWebhook(ctx context.Context, id int64) (*Webhook, error)
+	// Webhooks lists every webhook with its secret, oldest first
+	Webhooks(ctx context.Context) ([]Webhook, error)
+	// DeleteWebhook removes a webhook along with its deliveries
+	DeleteWebhook(ctx context.Context, id int64) error
+	// SaveDelivery inserts a delivery without an ID and updates it otherwise
+	SaveDelivery(ctx context.Context, delivery *Delivery) error
+	// Deliveries lists the deliveries of a webhook, newest first
+	Deliveries(ctx context.Context, webhookID int64, limit int) ([]Delivery, error)
+
+	Close() error
+}
+
+// NewRun converts the result of a scrape into a run to be saved
+func NewRun(source string, startedAt, finishedAt time.Time, result core.ScrapeResult) *Run {
+	run := &Run{Source: source, StartedAt: startedAt, FinishedAt: finishedAt, Partial: result.Partial}
+	for _, report := range result.Report {
+		target := TargetRun{
+			Target:    report.Target,
+			Status:    report.Status,
+			Cached:    report.Cached,
+			HTTPCode:  report.HTTPCode,
+			Addresses: report.Addresses,
+			FetchedAt: finishedAt,
+		}
+		if report.Error != nil {
+			target.ErrorCategory = string(report.Error.Category)
+			target.ErrorMessage = report.Error.Message
+		}
+		for _, script := range report.Scripts {
+			if script.Status == core.ScriptError {
+				target.FailedScripts = append(target.FailedScripts, script.URL)
+			}
+		}
+		run.Targets = append(run.Targets, target)
+	}
+	for _, info := range result.Results {
+		for _, target := range info.Targets {
+			run.Findings = append(run.Findings, Finding{
+				Address:    strings.ToLower(info.Address),
+				Variant:    info.Address,
+				Target:     target,
+				Src:        info.Src,
+				Type:       info.Type,
+				Count:      info.Count,
+				SeenAt:     finishedAt,
+				Context:    info.Context,
+				Severity:   info.Severity,
+				Lookalikes: info.Lookalikes,
+			})
+		}
+	}
+	return run
+}
+
+// KnownAddresses returns a function listing the addresses store has seen on
+// a target, for core.Options.KnownAddresses
+func KnownAddresses(store Store) func(ctx context.Context, target string) ([]string, error) {
+	return func(ctx context.Context, target string) ([]string, error) {
+		sightings, err := store.Sightings(ctx, Filter{Target: target, Limit: maxLimit})
+		if err != nil {
+			return nil, err
+		}
+		addresses := make([]string, len(sightings))
+		for i, sighting := range sightings {
+			addresses[i] = sighting.Address
+		}
+		return addresses, nil
+	}
+}
+
+// OpenFromEnv opens the store selected by HISTORY_BACKEND:
+//   - "sqlite" (default): a SQLite file at HISTORY_PATH (default scraper-history.db)
+//   - "none": history is not kept, a nil Store is returned
+func OpenFromEnv() (Store, error) {
+	switch backend := os.Getenv("HISTORY_BACKEND"); backend {
+	case "", "sqlite":
+		path := os.Getenv("HISTORY_PATH")
+		if path == "" {
+			path = "scraper-history.db"
+		}
+		return OpenSQLite(path)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown HISTORY_BACKEND %q, expected sqlite or none", backend)
+	}
+}
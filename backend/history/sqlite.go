@@ -0,0 +1,746 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	source      TEXT    NOT NULL,
+	started_at  INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL,
+	partial     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS targets (
+	run_id         INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+	target         TEXT    NOT NULL,
+	status         TEXT    NOT NULL,
+	cached         INTEGER NOT NULL,
+	http_code      INTEGER NOT NULL,
+	addresses      INTEGER NOT NULL,
+	error_category TEXT    NOT NULL,
+	error_message  TEXT    NOT NULL,
+	fetched_at     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS targets_target ON targets (target, fetched_at);
+CREATE INDEX IF NOT EXISTS targets_run ON targets (run_id);
+CREATE TABLE IF NOT EXISTS findings (
+	run_id  INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+	address TEXT    NOT NULL,
+	variant TEXT    NOT NULL,
+	target  TEXT    NOT NULL,
+	src     TEXT    NOT NULL,
+	type    TEXT    NOT NULL,
+	count   INTEGER NOT NULL,
+	seen_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS findings_address ON findings (address, seen_at);
+CREATE INDEX IF NOT EXISTS findings_target ON findings (target, seen_at);
+CREATE INDEX IF NOT EXISTS findings_run ON findings (run_id);
+CREATE TABLE IF NOT EXISTS sightings (
+	target     TEXT    NOT NULL,
+	address    TEXT    NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL,
+	seen_count INTEGER NOT NULL,
+	PRIMARY KEY (target, address)
+);
+CREATE INDEX IF NOT EXISTS sightings_address ON sightings (address);
+`
+
+// migrations bring a database created by an earlier version up to date. The
+// number of migrations applied is kept in user_version.
+var migrations = []string{
+	`ALTER TABLE findings ADD COLUMN context TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE watchlists (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		name             TEXT    NOT NULL,
+		targets          TEXT    NOT NULL,
+		interval_seconds INTEGER NOT NULL,
+		created_at       INTEGER NOT NULL,
+		last_run_id      INTEGER NOT NULL DEFAULT 0,
+		last_run_at      INTEGER
+	);
+	CREATE TABLE watch_diffs (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		watchlist_id    INTEGER NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+		run_id          INTEGER NOT NULL,
+		previous_run_id INTEGER NOT NULL,
+		created_at      INTEGER NOT NULL,
+		changed         INTEGER NOT NULL,
+		changes         TEXT    NOT NULL
+	);
+	CREATE INDEX watch_diffs_watchlist ON watch_diffs (watchlist_id, created_at);`,
+	`CREATE TABLE webhooks (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		url               TEXT    NOT NULL,
+		secret            TEXT    NOT NULL,
+		events            TEXT    NOT NULL,
+		watchlist_id      INTEGER NOT NULL,
+		failure_threshold INTEGER NOT NULL,
+		created_at        INTEGER NOT NULL
+	);
+	CREATE TABLE webhook_deliveries (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id  INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event       TEXT    NOT NULL,
+		payload     TEXT    NOT NULL,
+		status      TEXT    NOT NULL,
+		attempts    INTEGER NOT NULL,
+		status_code INTEGER NOT NULL,
+		error       TEXT    NOT NULL,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);
+	CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);`,
+	`ALTER TABLE findings ADD COLUMN severity TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN lookalikes TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE watchlists ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE targets ADD COLUMN failed_scripts TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLite stores history in a single SQLite file. Timestamps are kept as Unix
+// milliseconds.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the history database at path
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, queue writes here rather than retrying on SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history schema in %s: %w", path, err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate history schema in %s: %w", path, err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) SaveRun(ctx context.Context, run *Run) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO runs (source, started_at, finished_at, partial) VALUES (?, ?, ?, ?)`,
+		run.Source, run.StartedAt.UnixMilli(), run.FinishedAt.UnixMilli(), run.Partial)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range run.Targets {
+		target := &run.Targets[i]
+		target.RunID = id
+		var failedScripts []byte
+		if len(target.FailedScripts) > 0 {
+			if failedScripts, err = json.Marshal(target.FailedScripts); err != nil {
+				return 0, err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO targets (run_id, target, status, cached, http_code, addresses, error_category, error_message, fetched_at, failed_scripts)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, target.Target, target.Status, target.Cached, target.HTTPCode, target.Addresses, target.ErrorCategory, target.ErrorMessage, target.FetchedAt.UnixMilli(), string(failedScripts))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// An address is sighted once per run and target, whatever the number of sources
+	sighted := make(map[[2]string]time.Time)
+	for i := range run.Findings {
+		finding := &run.Findings[i]
+		finding.RunID = id
+		var lookalikes []byte
+		if len(finding.Lookalikes) > 0 {
+			if lookalikes, err = json.Marshal(finding.Lookalikes); err != nil {
+				return 0, err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO findings (run_id, address, variant, target, src, type, count, seen_at, context, severity, lookalikes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, finding.Address, finding.Variant, finding.Target, finding.Src, finding.Type, finding.Count, finding.SeenAt.UnixMilli(), finding.Context,
+			finding.Severity, string(lookalikes))
+		if err != nil {
+			return 0, err
+		}
+		sighted[[2]string{finding.Target, finding.Address}] = finding.SeenAt
+	}
+	for key, seenAt := range sighted {
+		_, err := tx.ExecContext(ctx, `INSERT INTO sightings (target, address, first_seen, last_seen, seen_count) VALUES (?, ?, ?, ?, 1)
+			ON CONFLICT (target, address) DO UPDATE SET
+				first_seen = min(first_seen, excluded.first_seen),
+				last_seen = max(last_seen, excluded.last_seen),
+				seen_count = seen_count + 1`,
+			key[0], key[1], seenAt.UnixMilli(), seenAt.UnixMilli())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	run.ID = id
+	return id, nil
+}
+
+func (s *SQLite) GetRun(ctx context.Context, id int64) (*Run, error) {
+	run := &Run{ID: id}
+	var startedAt, finishedAt int64
+	err := s.db.QueryRowContext(ctx, `SELECT source, started_at, finished_at, partial FROM runs WHERE id = ?`, id).
+		Scan(&run.Source, &startedAt, &finishedAt, &run.Partial)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	run.StartedAt, run.FinishedAt = time.UnixMilli(startedAt), time.UnixMilli(finishedAt)
+
+	run.Targets, err = s.queryTargets(ctx, `WHERE run_id = ? ORDER BY rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	run.Findings, err = s.queryFindings(ctx, `WHERE run_id = ? ORDER BY rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *SQLite) Runs(ctx context.Context, filter Filter) ([]Run, error) {
+	var where conditions
+	if filter.Target != "" {
+		where.add("EXISTS (SELECT 1 FROM targets WHERE targets.run_id = runs.id AND targets.target = ?)", filter.Target)
+	}
+	if filter.Address != "" {
+		where.add("EXISTS (SELECT 1 FROM findings WHERE findings.run_id = runs.id AND findings.address = ?)", filter.Address)
+	}
+	if !filter.From.IsZero() {
+		where.add("started_at >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		where.add("started_at <= ?", filter.To.UnixMilli())
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, source, started_at, finished_at, partial FROM runs`+where.String()+
+		` ORDER BY id DESC LIMIT ?`, append(where.args, filter.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	runs := []Run{}
+	for rows.Next() {
+		var run Run
+		var startedAt, finishedAt int64
+		if err := rows.Scan(&run.ID, &run.Source, &startedAt, &finishedAt, &run.Partial); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		run.StartedAt, run.FinishedAt = time.UnixMilli(startedAt), time.UnixMilli(finishedAt)
+		runs = append(runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// With a single connection the targets can only be read once the runs are
+	for i := range runs {
+		if filter.Target != "" {
+			runs[i].Targets, err = s.queryTargets(ctx, `WHERE run_id = ? AND target = ? ORDER BY rowid`, runs[i].ID, filter.Target)
+		} else {
+			runs[i].Targets, err = s.queryTargets(ctx, `WHERE run_id = ? ORDER BY rowid`, runs[i].ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (s *SQLite) Findings(ctx context.Context, filter Filter) ([]Finding, error) {
+	var where conditions
+	if filter.Target != "" {
+		where.add("target = ?", filter.Target)
+	}
+	if filter.Address != "" {
+		where.add("address = ?", filter.Address)
+	}
+	if !filter.From.IsZero() {
+		where.add("seen_at >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		where.add("seen_at <= ?", filter.To.UnixMilli())
+	}
+	return s.queryFindings(ctx, where.String()+` ORDER BY seen_at DESC, rowid DESC LIMIT ?`, append(where.args, filter.Limit)...)
+}
+
+func (s *SQLite) Sightings(ctx context.Context, filter Filter) ([]Sighting, error) {
+	var where conditions
+	if filter.Target != "" {
+		where.add("target = ?", filter.Target)
+	}
+	if filter.Address != "" {
+		where.add("address = ?", filter.Address)
+	}
+	if !filter.From.IsZero() {
+		where.add("last_seen >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		where.add("first_seen <= ?", filter.To.UnixMilli())
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT target, address, first_seen, last_seen, seen_count FROM sightings`+where.String()+
+		` ORDER BY last_seen DESC, target, address LIMIT ?`, append(where.args, filter.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sightings := []Sighting{}
+	for rows.Next() {
+		var sighting Sighting
+		var firstSeen, lastSeen int64
+		if err := rows.Scan(&sighting.Target, &sighting.Address, &firstSeen, &lastSeen, &sighting.SeenCount); err != nil {
+			return nil, err
+		}
+		sighting.FirstSeen, sighting.LastSeen = time.UnixMilli(firstSeen), time.UnixMilli(lastSeen)
+		sightings = append(sightings, sighting)
+	}
+	return sightings, rows.Err()
+}
+
+func (s *SQLite) References(ctx context.Context, address string, limit int) ([]Reference, error) {
+	// With max() SQLite takes the bare variant and context columns from the latest finding of each group
+	rows, err := s.db.QueryContext(ctx, `SELECT address, target, src, type, variant, context, min(seen_at), max(seen_at), count(DISTINCT run_id)
+		FROM findings WHERE address = ?
+		GROUP BY target, src, type
+		ORDER BY max(seen_at) DESC, target, src LIMIT ?`, address, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	references := []Reference{}
+	for rows.Next() {
+		var reference Reference
+		var firstSeen, lastSeen int64
+		err := rows.Scan(&reference.Address, &reference.Target, &reference.Src, &reference.Type, &reference.Variant, &reference.Context,
+			&firstSeen, &lastSeen, &reference.SeenCount)
+		if err != nil {
+			return nil, err
+		}
+		reference.FirstSeen, reference.LastSeen = time.UnixMilli(firstSeen), time.UnixMilli(lastSeen)
+		references = append(references, reference)
+	}
+	return references, rows.Err()
+}
+
+func (s *SQLite) queryTargets(ctx context.Context, clause string, args ...interface{}) ([]TargetRun, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT run_id, target, status, cached, http_code, addresses, error_category, error_message, fetched_at, failed_scripts
+		FROM targets `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []TargetRun{}
+	for rows.Next() {
+		var target TargetRun
+		var fetchedAt int64
+		var failedScripts string
+		err := rows.Scan(&target.RunID, &target.Target, &target.Status, &target.Cached, &target.HTTPCode, &target.Addresses,
+			&target.ErrorCategory, &target.ErrorMessage, &fetchedAt, &failedScripts)
+		if err != nil {
+			return nil, err
+		}
+		if failedScripts != "" {
+			if err := json.Unmarshal([]byte(failedScripts), &target.FailedScripts); err != nil {
+				return nil, fmt.Errorf("failed to decode failed scripts of run %d: %w", target.RunID, err)
+			}
+		}
+		target.FetchedAt = time.UnixMilli(fetchedAt)
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+func (s *SQLite) queryFindings(ctx context.Context, clause string, args ...interface{}) ([]Finding, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT run_id, address, variant, target, src, type, count, seen_at, context, severity, lookalikes
+		FROM findings `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []Finding{}
+	for rows.Next() {
+		var finding Finding
+		var seenAt int64
+		var lookalikes string
+		err := rows.Scan(&finding.RunID, &finding.Address, &finding.Variant, &finding.Target, &finding.Src, &finding.Type, &finding.Count, &seenAt,
+			&finding.Context, &finding.Severity, &lookalikes)
+		if err != nil {
+			return nil, err
+		}
+		if lookalikes != "" {
+			if err := json.Unmarshal([]byte(lookalikes), &finding.Lookalikes); err != nil {
+				return nil, fmt.Errorf("failed to decode lookalikes of a finding of run %d: %w", finding.RunID, err)
+			}
+		}
+		finding.SeenAt = time.UnixMilli(seenAt)
+		findings = append(findings, finding)
+	}
+	return findings, rows.Err()
+}
+
+func (s *SQLite) CreateWatchlist(ctx context.Context, watchlist *Watchlist) (int64, error) {
+	targets, err := json.Marshal(watchlist.Targets)
+	if err != nil {
+		return 0, err
+	}
+	if watchlist.CreatedAt.IsZero() {
+		watchlist.CreatedAt = time.Now()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var owned int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM watchlists WHERE owner = ?`, watchlist.Owner).Scan(&owned); err != nil {
+		return 0, err
+	}
+	if owned >= MaxWatchlistsPerOwner {
+		return 0, ErrTooManyWatchlists
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO watchlists (name, targets, interval_seconds, created_at, owner) VALUES (?, ?, ?, ?, ?)`,
+		watchlist.Name, string(targets), watchlist.IntervalSeconds, watchlist.CreatedAt.UnixMilli(), watchlist.Owner)
+	if err != nil {
+		return 0, err
+	}
+	if watchlist.ID, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+	return watchlist.ID, tx.Commit()
+}
+
+func (s *SQLite) GetWatchlist(ctx context.Context, id int64) (*Watchlist, error) {
+	watchlists, err := s.queryWatchlists(ctx, `WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(watchlists) == 0 {
+		return nil, ErrWatchlistNotFound
+	}
+	return &watchlists[0], nil
+}
+
+func (s *SQLite) Watchlists(ctx context.Context) ([]Watchlist, error) {
+	return s.queryWatchlists(ctx, `ORDER BY id`)
+}
+
+func (s *SQLite) DeleteWatchlist(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM watchlists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+		return ErrWatchlistNotFound
+	}
+	return err
+}
+
+func (s *SQLite) SaveDiff(ctx context.Context, diff *Diff) (int64, error) {
+	changes, err := json.Marshal(diffChanges{Added: diff.Added, Removed: diff.Removed, Moved: diff.Moved, Skipped: diff.Skipped, Failing: diff.Failing})
+	if err != nil {
+		return 0, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE watchlists SET last_run_id = ?, last_run_at = ? WHERE id = ?`,
+		diff.RunID, diff.CreatedAt.UnixMilli(), diff.WatchlistID)
+	if err != nil {
+		return 0, err
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated == 0 {
+		return 0, ErrWatchlistNotFound
+	}
+	res, err = tx.ExecContext(ctx, `INSERT INTO watch_diffs (watchlist_id, run_id, previous_run_id, created_at, changed, changes) VALUES (?, ?, ?, ?, ?, ?)`,
+		diff.WatchlistID, diff.RunID, diff.PreviousRunID, diff.CreatedAt.UnixMilli(), diff.Changed(), string(changes))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	diff.ID = id
+	return id, nil
+}
+
+func (s *SQLite) Diffs(ctx context.Context, watchlistID int64, filter DiffFilter) ([]Diff, error) {
+	var where conditions
+	where.add("watchlist_id = ?", watchlistID)
+	if filter.Changed {
+		where.add("changed = ?", true)
+	}
+	if !filter.From.IsZero() {
+		where.add("created_at >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		where.add("created_at <= ?", filter.To.UnixMilli())
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, watchlist_id, run_id, previous_run_id, created_at, changes FROM watch_diffs`+where.String()+
+		` ORDER BY id DESC LIMIT ?`, append(where.args, filter.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	diffs := []Diff{}
+	for rows.Next() {
+		var diff Diff
+		var createdAt int64
+		var encoded string
+		if err := rows.Scan(&diff.ID, &diff.WatchlistID, &diff.RunID, &diff.PreviousRunID, &createdAt, &encoded); err != nil {
+			return nil, err
+		}
+		var changes diffChanges
+		if err := json.Unmarshal([]byte(encoded), &changes); err != nil {
+			return nil, fmt.Errorf("failed to decode diff %d: %w", diff.ID, err)
+		}
+		diff.CreatedAt = time.UnixMilli(createdAt)
+		diff.Added, diff.Removed, diff.Moved, diff.Skipped, diff.Failing = changes.Added, changes.Removed, changes.Moved, changes.Skipped, changes.Failing
+		diffs = append(diffs, diff)
+	}
+	return diffs, rows.Err()
+}
+
+// diffChanges is how the changes of a diff are kept in the changes column
+type diffChanges struct {
+	Added   []AddressChange `json:"added"`
+	Removed []AddressChange `json:"removed"`
+	Moved   []AddressChange `json:"moved"`
+	Skipped []string        `json:"skipped,omitempty"`
+	Failing []TargetFailure `json:"failing,omitempty"`
+}
+
+func (s *SQLite) queryWatchlists(ctx context.Context, clause string, args ...interface{}) ([]Watchlist, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, targets, interval_seconds, created_at, last_run_id, last_run_at, owner FROM watchlists `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchlists := []Watchlist{}
+	for rows.Next() {
+		var watchlist Watchlist
+		var targets string
+		var createdAt int64
+		var lastRunAt sql.NullInt64
+		err := rows.Scan(&watchlist.ID, &watchlist.Name, &targets, &watchlist.IntervalSeconds, &createdAt, &watchlist.LastRunID, &lastRunAt, &watchlist.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(targets), &watchlist.Targets); err != nil {
+			return nil, fmt.Errorf("failed to decode targets of watchlist %d: %w", watchlist.ID, err)
+		}
+		watchlist.CreatedAt = time.UnixMilli(createdAt)
+		if lastRunAt.Valid {
+			at := time.UnixMilli(lastRunAt.Int64)
+			watchlist.LastRunAt = &at
+		}
+		watchlists = append(watchlists, watchlist)
+	}
+	return watchlists, rows.Err()
+}
+
+func (s *SQLite) CreateWebhook(ctx context.Context, webhook *Webhook) (int64, error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return 0, err
+	}
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO webhooks (url, secret, events, watchlist_id, failure_threshold, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		webhook.URL, webhook.Secret, string(events), webhook.WatchlistID, webhook.FailureThreshold, webhook.CreatedAt.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	webhook.ID, err = res.LastInsertId()
+	return webhook.ID, err
+}
+
+func (s *SQLite) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	webhooks, err := s.queryWebhooks(ctx, `WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhooks[0], nil
+}
+
+func (s *SQLite) Webhooks(ctx context.Context) ([]Webhook, error) {
+	return s.queryWebhooks(ctx, `ORDER BY id`)
+}
+
+func (s *SQLite) DeleteWebhook(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func (s *SQLite) SaveDelivery(ctx context.Context, delivery *Delivery) error {
+	delivery.UpdatedAt = time.Now()
+	if delivery.ID != 0 {
+		_, err := s.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, status_code = ?, error = ?, updated_at = ? WHERE id = ?`,
+			delivery.Status, delivery.Attempts, delivery.StatusCode, delivery.Error, delivery.UpdatedAt.UnixMilli(), delivery.ID)
+		return err
+	}
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = delivery.UpdatedAt
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, status_code, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.WebhookID, delivery.Event, string(delivery.Payload), delivery.Status, delivery.Attempts, delivery.StatusCode, delivery.Error,
+		delivery.CreatedAt.UnixMilli(), delivery.UpdatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	delivery.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *SQLite) Deliveries(ctx context.Context, webhookID int64, limit int) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, webhook_id, event, payload, status, attempts, status_code, error, created_at, updated_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		var payload string
+		var createdAt, updatedAt int64
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+			&delivery.StatusCode, &delivery.Error, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		delivery.CreatedAt, delivery.UpdatedAt = time.UnixMilli(createdAt), time.UnixMilli(updatedAt)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLite) queryWebhooks(ctx context.Context, clause string, args ...interface{}) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, url, secret, events, watchlist_id, failure_threshold, created_at FROM webhooks `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		var createdAt int64
+		err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.WatchlistID, &webhook.FailureThreshold, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode events of webhook %d: %w", webhook.ID, err)
+		}
+		webhook.CreatedAt = time.UnixMilli(createdAt)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// conditions collects the clauses and arguments of a WHERE clause
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+func (c *conditions) add(clause string, arg interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.args = append(c.args, arg)
+}
+
+func (c *conditions) String() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
@@ -0,0 +1,182 @@
+package history
+
+import (
+	"backend/core"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *SQLite {
+	t.Helper()
+	store, err := OpenSQLite(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func scrapeResult(addresses ...string) core.ScrapeResult {
+	result := core.ScrapeResult{
+		Report: []core.TargetReport{
+			{Target: "https://one.example", Status: core.StatusOK, Addresses: len(addresses)},
+			{Target: "https://down.example", Status: core.StatusError, Error: &core.ScrapeError{Category: core.ErrorDNS, Message: "no such host"}},
+		},
+	}
+	for _, address := range addresses {
+		result.Results = append(result.Results,
+			core.AddressInfo{Address: address, Src: "https://one.example", Type: "html", Targets: []string{"https://one.example"}, Count: 1},
+			core.AddressInfo{Address: address, Src: "https://one.example/app.js", Type: "script", Targets: []string{"https://one.example"}, Count: 2},
+		)
+	}
+	return result
+}
+
+func TestSaveAndQueryRuns(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	firstID, err := store.SaveRun(ctx, NewRun(SourceAPI, first, first.Add(time.Second), scrapeResult("0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.SaveRun(ctx, NewRun(SourceJob, second, second.Add(time.Second), scrapeResult("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	run, err := store.GetRun(ctx, firstID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(run.Targets) != 2 || run.Targets[1].ErrorCategory != "dns" || len(run.Findings) != 4 {
+		t.Errorf("Unexpected run: %+v", run)
+	}
+	if run.Findings[0].Address != "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || run.Findings[0].Variant != "0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA" {
+		t.Errorf("Expected address to be lowercased with its variant kept, got %+v", run.Findings[0])
+	}
+	if _, err := store.GetRun(ctx, 999); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	filter := Filter{Target: "https://down.example"}
+	filter.Validate()
+	runs, _ := store.Runs(ctx, filter)
+	if len(runs) != 2 || runs[0].Source != SourceJob || len(runs[0].Targets) != 1 || runs[0].Targets[0].Target != "https://down.example" {
+		t.Errorf("Expected both runs newest first with only the filtered target, got %+v", runs)
+	}
+
+	filter = Filter{From: second}
+	filter.Validate()
+	if runs, _ := store.Runs(ctx, filter); len(runs) != 1 {
+		t.Errorf("Expected 1 run since %v, got %d", second, len(runs))
+	}
+
+	filter = Filter{Address: "0xBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"}
+	filter.Validate()
+	if findings, _ := store.Findings(ctx, filter); len(findings) != 2 {
+		t.Errorf("Expected 2 findings of the address, got %+v", findings)
+	}
+
+	filter = Filter{Target: "https://one.example"}
+	filter.Validate()
+	sightings, err := store.Sightings(ctx, filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sightings) != 2 {
+		t.Fatalf("Expected 2 sightings, got %+v", sightings)
+	}
+	// Seen once per run even though it was found in two sources
+	a := sightings[0]
+	if a.Address != "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || a.SeenCount != 2 || !a.FirstSeen.Equal(first.Add(time.Second)) || !a.LastSeen.Equal(second.Add(time.Second)) {
+		t.Errorf("Unexpected sighting: %+v", a)
+	}
+	if b := sightings[1]; b.SeenCount != 1 {
+		t.Errorf("Unexpected sighting: %+v", b)
+	}
+
+	filter = Filter{From: second}
+	filter.Validate()
+	if sightings, _ := store.Sightings(ctx, filter); len(sightings) != 1 {
+		t.Errorf("Expected only the address still seen since %v, got %+v", second, sightings)
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		filter Filter
+		valid  bool
+	}{
+		{Filter{}, true},
+		{Filter{Limit: maxLimit + 1}, false},
+		{Filter{From: now, To: now.Add(-time.Hour)}, false},
+	}
+	for _, test := range tests {
+		if err := test.filter.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid=%v", test.filter, err, test.valid)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	result := scrapeResult("0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	result.Results[0].Context = "old context"
+	store.SaveRun(ctx, NewRun(SourceAPI, first, first, result))
+	result = scrapeResult("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	result.Results[0].Context = "donate to 0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	store.SaveRun(ctx, NewRun(SourceCLI, second, second, result))
+
+	references, err := store.References(ctx, "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(references) != 2 {
+		t.Fatalf("Expected the page and the script, got %+v", references)
+	}
+	page := references[0]
+	if page.Src != "https://one.example" || page.Type != "html" || page.SeenCount != 2 {
+		t.Errorf("Unexpected reference: %+v", page)
+	}
+	if !page.FirstSeen.Equal(first) || !page.LastSeen.Equal(second) {
+		t.Errorf("Expected to be seen from %v to %v, got %+v", first, second, page)
+	}
+	// Variant and context come from the latest run
+	if page.Context != "donate to 0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || page.Variant != "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("Expected the latest variant and context, got %+v", page)
+	}
+
+	if references, _ := store.References(ctx, "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", 10); len(references) != 0 {
+		t.Errorf("Expected no references, got %+v", references)
+	}
+}
+
+func TestMigrateExistingStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.Close()
+
+	// Reopening must not apply the migrations a second time
+	store, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening: %v", err)
+	}
+	defer store.Close()
+	var version int
+	store.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if version != len(migrations) {
+		t.Errorf("Expected user_version %d, got %d", len(migrations), version)
+	}
+}
@@ -0,0 +1,310 @@
+package history
+
+import (
+	"backend/core"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MinWatchInterval is the shortest interval a watchlist can be re-scraped at
+	MinWatchInterval = time.Minute
+	// MaxWatchlistsPerOwner caps the watchlists a single user can create
+	MaxWatchlistsPerOwner = 20
+)
+
+var (
+	ErrWatchlistNotFound = errors.New("watchlist not found")
+	ErrInvalidWatchlist  = errors.New("invalid watchlist")
+	ErrTooManyWatchlists = fmt.Errorf("at most %d watchlists can be created per user", MaxWatchlistsPerOwner)
+)
+
+// Watchlist is a set of targets re-scraped on a schedule, each run being
+// diffed against the previous one
+type Watchlist struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	Targets         []string  `json:"targets"`
+	IntervalSeconds int       `json:"interval_seconds"`
+	CreatedAt       time.Time `json:"created_at"`
+	// Owner is the ID of the user who created the watchlist, empty when
+	// authentication is disabled
+	Owner string `json:"owner,omitempty"`
+	// LastRunID and LastRunAt are zero until the watchlist first ran
+	LastRunID int64      `json:"last_run_id,omitempty"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+}
+
+// Validate checks the watchlist, errors wrap ErrInvalidWatchlist
+func (w *Watchlist) Validate() error {
+	if len(w.Targets) == 0 {
+		return fmt.Errorf("%w: at least one target is required", ErrInvalidWatchlist)
+	}
+	for _, target := range w.Targets {
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			return fmt.Errorf("%w: target %q must start with http:// or https://", ErrInvalidWatchlist, target)
+		}
+	}
+	if w.Interval() < MinWatchInterval {
+		return fmt.Errorf("%w: interval_seconds must be at least %d", ErrInvalidWatchlist, int(MinWatchInterval.Seconds()))
+	}
+	return nil
+}
+
+func (w *Watchlist) Interval() time.Duration {
+	return time.Duration(w.IntervalSeconds) * time.Second
+}
+
+// Due reports whether the watchlist should be scraped again at now
+func (w *Watchlist) Due(now time.Time) bool {
+	return w.LastRunAt == nil || !now.Before(w.LastRunAt.Add(w.Interval()))
+}
+
+// AddressChange is an address that appeared on, disappeared from or moved
+// within a target between two runs
+type AddressChange struct {
+	Target  string `json:"target"`
+	Address string `json:"address"`
+	Variant string `json:"variant"`
+	// Sources are where the address is found now, PreviousSources where it
+	// was found in the previous run
+	Sources         []string `json:"sources,omitempty"`
+	PreviousSources []string `json:"previous_sources,omitempty"`
+	// Severity and Lookalikes are those of the findings of the address in the run
+	Severity   string           `json:"severity,omitempty"`
+	Lookalikes []core.Lookalike `json:"lookalikes,omitempty"`
+}
+
+// Diff compares a run of a watchlist with the previous one
+type Diff struct {
+	ID          int64 `json:"id"`
+	WatchlistID int64 `json:"watchlist_id"`
+	RunID       int64 `json:"run_id"`
+	// PreviousRunID is zero for the first run of a watchlist, which has
+	// nothing to be compared with
+	PreviousRunID int64           `json:"previous_run_id,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Added         []AddressChange `json:"added"`
+	Removed       []AddressChange `json:"removed"`
+	// Moved are addresses found in a source they were not found in before,
+	// such as a new script
+	Moved []AddressChange `json:"moved"`
+	// Skipped are targets that failed or had no earlier successful run to be
+	// compared with
+	Skipped []string `json:"skipped,omitempty"`
+	// Failing are the targets that failed in this run
+	Failing []TargetFailure `json:"failing,omitempty"`
+}
+
+// TargetFailure is a target that failed in a run of a watchlist
+type TargetFailure struct {
+	Target        string `json:"target"`
+	ErrorCategory string `json:"error_category,omitempty"`
+	ErrorMessage  string `json:"error_message,omitempty"`
+	// ConsecutiveFailures counts this run and the earlier runs compared with
+	// that failed on the target in a row
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+// lastSuccess returns the first of runs in which target was scraped successfully
+func lastSuccess(runs []*Run, target string) *Run {
+	for _, run := range runs {
+		for _, report := range run.Targets {
+			if report.Target == target && report.Status == core.StatusOK {
+				return run
+			}
+		}
+	}
+	return nil
+}
+
+// failedScripts returns the scripts of target that failed in run
+func failedScripts(run *Run, target string) []string {
+	for _, report := range run.Targets {
+		if report.Target == target {
+			return report.FailedScripts
+		}
+	}
+	return nil
+}
+
+// failuresInARow counts the runs at the start of runs that failed on target
+func failuresInARow(runs []*Run, target string) int {
+	failures := 0
+	for _, run := range runs {
+		failed := false
+		for _, report := range run.Targets {
+			if report.Target == target {
+				failed = report.Status != core.StatusOK
+			}
+		}
+		if !failed {
+			return failures
+		}
+		failures++
+	}
+	return failures
+}
+
+// Changed reports whether any address was added, removed or moved
+func (d *Diff) Changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Moved) > 0
+}
+
+// DiffFilter narrows diffs down by time range, zero fields don't filter
+type DiffFilter struct {
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Changed keeps only diffs with added, removed or moved addresses
+	Changed bool `form:"changed"`
+	Limit   int  `form:"limit"`
+}
+
+// Validate checks the filter and fills in the default limit
+func (f *DiffFilter) Validate() error {
+	filter := Filter{From: f.From, To: f.To, Limit: f.Limit}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	f.Limit = filter.Limit
+	return nil
+}
+
+// sourceSet maps the target and address of findings to where they were found
+type sourceSet map[[2]string]*sources
+
+type sources struct {
+	variant    string
+	srcs       []string
+	severity   string
+	lookalikes []core.Lookalike
+}
+
+// newSourceSet collects the findings of run, only those of target if it is
+// not nil, leaving out the target and source pairs of skip
+func newSourceSet(run *Run, target *string, skip map[[2]string]bool) sourceSet {
+	set := make(sourceSet)
+	for _, finding := range run.Findings {
+		if (target != nil && finding.Target != *target) || skip[[2]string{finding.Target, finding.Src}] {
+			continue
+		}
+		key := [2]string{finding.Target, finding.Address}
+		entry, ok := set[key]
+		if !ok {
+			entry = &sources{variant: finding.Variant}
+			set[key] = entry
+		}
+		if !slices.Contains(entry.srcs, finding.Src) {
+			entry.srcs = append(entry.srcs, finding.Src)
+		}
+		if finding.Severity != "" {
+			entry.severity = finding.Severity
+		}
+		for _, lookalike := range finding.Lookalikes {
+			if !slices.Contains(entry.lookalikes, lookalike) {
+				entry.lookalikes = append(entry.lookalikes, lookalike)
+			}
+		}
+	}
+	for _, entry := range set {
+		sort.Strings(entry.srcs)
+	}
+	return set
+}
+
+// DiffRuns compares the findings of current with those of earlier runs of
+// the same watchlist, given newest first. Each target is compared with the
+// newest earlier run in which it was scraped successfully, so a target that
+// failed once is not reported as having lost and then regained all of its
+// addresses. Targets failing now or without such a run are skipped, and so
+// are the scripts that failed in either run. Without earlier runs the diff
+// is empty.
+func DiffRuns(previous []*Run, current *Run) Diff {
+	diff := Diff{RunID: current.ID, Added: []AddressChange{}, Removed: []AddressChange{}, Moved: []AddressChange{}}
+	for _, target := range current.Targets {
+		if target.Status != core.StatusOK {
+			diff.Failing = append(diff.Failing, TargetFailure{
+				Target:              target.Target,
+				ErrorCategory:       target.ErrorCategory,
+				ErrorMessage:        target.ErrorMessage,
+				ConsecutiveFailures: 1 + failuresInARow(previous, target.Target),
+			})
+		}
+	}
+	if len(previous) == 0 {
+		return diff
+	}
+	diff.PreviousRunID = previous[0].ID
+
+	baselines := make(map[string]*Run)
+	for _, target := range current.Targets {
+		if target.Status == core.StatusOK {
+			baselines[target.Target] = lastSuccess(previous, target.Target)
+		}
+		if baselines[target.Target] == nil && !slices.Contains(diff.Skipped, target.Target) {
+			diff.Skipped = append(diff.Skipped, target.Target)
+		}
+	}
+
+	// A script that failed in either run has unknown addresses in it, so its
+	// findings are compared in neither
+	unfetched := make(map[[2]string]bool)
+	for target, run := range baselines {
+		if run == nil {
+			continue
+		}
+		for _, script := range append(failedScripts(current, target), failedScripts(run, target)...) {
+			unfetched[[2]string{target, script}] = true
+		}
+	}
+
+	after := newSourceSet(current, nil, unfetched)
+	before := make(sourceSet)
+	for target, run := range baselines {
+		if run != nil {
+			for key, entry := range newSourceSet(run, &target, unfetched) {
+				before[key] = entry
+			}
+		}
+	}
+	compared := func(target string) bool { return baselines[target] != nil }
+
+	for key, now := range after {
+		if !compared(key[0]) {
+			continue
+		}
+		change := AddressChange{Target: key[0], Address: key[1], Variant: now.variant, Sources: now.srcs, Severity: now.severity, Lookalikes: now.lookalikes}
+		then, ok := before[key]
+		if !ok {
+			diff.Added = append(diff.Added, change)
+			continue
+		}
+		for _, src := range now.srcs {
+			if !slices.Contains(then.srcs, src) {
+				change.PreviousSources = then.srcs
+				diff.Moved = append(diff.Moved, change)
+				break
+			}
+		}
+	}
+	for key, then := range before {
+		if _, ok := after[key]; ok || !compared(key[0]) {
+			continue
+		}
+		diff.Removed = append(diff.Removed, AddressChange{Target: key[0], Address: key[1], Variant: then.variant, PreviousSources: then.srcs})
+	}
+
+	for _, changes := range [][]AddressChange{diff.Added, diff.Removed, diff.Moved} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Target != changes[j].Target {
+				return changes[i].Target < changes[j].Target
+			}
+			return changes[i].Address < changes[j].Address
+		})
+	}
+	return diff
+}
@@ -0,0 +1,186 @@
+package history
+
+import (
+	"backend/core"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func watchRun(id int64, status string, findings ...Finding) *Run {
+	run := &Run{ID: id, Targets: []TargetRun{{Target: "https://dapp.example", Status: status}}}
+	for _, finding := range findings {
+		finding.Target = "https://dapp.example"
+		run.Findings = append(run.Findings, finding)
+	}
+	return run
+}
+
+func TestDiffRuns(t *testing.T) {
+	const a, b, c = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "0xcccccccccccccccccccccccccccccccccccccccc"
+	first := watchRun(1, core.StatusOK,
+		Finding{Address: a, Variant: a, Src: "https://dapp.example/app.js"},
+		Finding{Address: b, Variant: b, Src: "https://dapp.example"},
+	)
+	failed := watchRun(2, core.StatusError)
+	third := watchRun(3, core.StatusOK,
+		Finding{Address: a, Variant: a, Src: "https://cdn.evil.example/app.js"},
+		Finding{Address: c, Variant: c, Src: "https://dapp.example"},
+	)
+
+	if diff := DiffRuns(nil, first); diff.Changed() || diff.PreviousRunID != 0 || len(diff.Skipped) != 0 {
+		t.Errorf("Expected the first run to be a baseline, got %+v", diff)
+	}
+	if diff := DiffRuns([]*Run{first}, failed); diff.Changed() || !reflect.DeepEqual(diff.Skipped, []string{"https://dapp.example"}) {
+		t.Errorf("Expected the failed target to be skipped, got %+v", diff)
+	}
+	if diff := DiffRuns([]*Run{failed, first}, watchRun(4, core.StatusError)); len(diff.Failing) != 1 || diff.Failing[0].ConsecutiveFailures != 2 {
+		t.Errorf("Expected the target to be failing twice in a row, got %+v", diff.Failing)
+	}
+
+	// The failed run is passed over in favour of the last successful one
+	diff := DiffRuns([]*Run{failed, first}, third)
+	if diff.PreviousRunID != 2 || len(diff.Skipped) != 0 {
+		t.Errorf("Unexpected diff: %+v", diff)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Address != c {
+		t.Errorf("Expected %s to be added, got %+v", c, diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Address != b || !reflect.DeepEqual(diff.Removed[0].PreviousSources, []string{"https://dapp.example"}) {
+		t.Errorf("Expected %s to be removed, got %+v", b, diff.Removed)
+	}
+	moved := []AddressChange{{
+		Target:          "https://dapp.example",
+		Address:         a,
+		Variant:         a,
+		Sources:         []string{"https://cdn.evil.example/app.js"},
+		PreviousSources: []string{"https://dapp.example/app.js"},
+	}}
+	if !reflect.DeepEqual(diff.Moved, moved) {
+		t.Errorf("Expected %+v to be moved, got %+v", moved, diff.Moved)
+	}
+}
+
+func TestDiffRunsWithFailedScripts(t *testing.T) {
+	const a, b = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	first := watchRun(1, core.StatusOK,
+		Finding{Address: a, Variant: a, Src: "https://dapp.example/app.js"},
+		Finding{Address: b, Variant: b, Src: "https://dapp.example"},
+	)
+	second := watchRun(2, core.StatusOK, Finding{Address: b, Variant: b, Src: "https://dapp.example"})
+	second.Targets[0].FailedScripts = []string{"https://dapp.example/app.js"}
+	third := watchRun(3, core.StatusOK,
+		Finding{Address: a, Variant: a, Src: "https://dapp.example/app.js"},
+		Finding{Address: b, Variant: b, Src: "https://dapp.example"},
+	)
+
+	if diff := DiffRuns([]*Run{first}, second); diff.Changed() {
+		t.Errorf("Expected no changes while the script failed, got %+v", diff)
+	}
+	if diff := DiffRuns([]*Run{second, first}, third); diff.Changed() {
+		t.Errorf("Expected no changes once the script is fetched again, got %+v", diff)
+	}
+}
+
+func TestWatchlistsAndDiffs(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	watchlist := &Watchlist{Name: "dapp", Targets: []string{"https://dapp.example"}, IntervalSeconds: 3600}
+	if err := watchlist.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, err := store.CreateWatchlist(ctx, watchlist)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !watchlist.Due(time.Now()) {
+		t.Error("Expected a watchlist that never ran to be due")
+	}
+
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	diff := &Diff{WatchlistID: id, RunID: 7, PreviousRunID: 6, CreatedAt: at,
+		Added: []AddressChange{{Target: "https://dapp.example", Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Sources: []string{"https://dapp.example"}}}}
+	if _, err := store.SaveDiff(ctx, diff); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.SaveDiff(ctx, &Diff{WatchlistID: id, RunID: 8, PreviousRunID: 7, CreatedAt: at.Add(time.Hour)})
+
+	saved, err := store.GetWatchlist(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if saved.LastRunID != 8 || !saved.LastRunAt.Equal(at.Add(time.Hour)) || saved.Targets[0] != "https://dapp.example" {
+		t.Errorf("Unexpected watchlist: %+v", saved)
+	}
+	if saved.Due(at.Add(90*time.Minute)) || !saved.Due(at.Add(2*time.Hour)) {
+		t.Errorf("Expected the watchlist to be due an hour after its last run")
+	}
+
+	filter := DiffFilter{}
+	filter.Validate()
+	if diffs, _ := store.Diffs(ctx, id, filter); len(diffs) != 2 || diffs[0].RunID != 8 {
+		t.Errorf("Expected both diffs newest first, got %+v", diffs)
+	}
+	filter = DiffFilter{Changed: true}
+	filter.Validate()
+	diffs, err := store.Diffs(ctx, id, filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diffs) != 1 || !reflect.DeepEqual(diffs[0].Added, diff.Added) {
+		t.Errorf("Expected only the diff with changes, got %+v", diffs)
+	}
+
+	if err := store.DeleteWatchlist(ctx, id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.GetWatchlist(ctx, id); err != ErrWatchlistNotFound {
+		t.Errorf("Expected ErrWatchlistNotFound, got %v", err)
+	}
+	if diffs, _ := store.Diffs(ctx, id, filter); len(diffs) != 0 {
+		t.Errorf("Expected the diffs to be deleted with the watchlist, got %+v", diffs)
+	}
+	if _, err := store.SaveDiff(ctx, &Diff{WatchlistID: id, RunID: 9}); err != ErrWatchlistNotFound {
+		t.Errorf("Expected ErrWatchlistNotFound, got %v", err)
+	}
+}
+
+func TestWatchlistsPerOwner(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < MaxWatchlistsPerOwner; i++ {
+		if _, err := store.CreateWatchlist(ctx, &Watchlist{Targets: []string{"https://dapp.example"}, IntervalSeconds: 60, Owner: "alice"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := store.CreateWatchlist(ctx, &Watchlist{Targets: []string{"https://dapp.example"}, IntervalSeconds: 60, Owner: "alice"}); err != ErrTooManyWatchlists {
+		t.Errorf("Expected ErrTooManyWatchlists, got %v", err)
+	}
+	id, err := store.CreateWatchlist(ctx, &Watchlist{Targets: []string{"https://dapp.example"}, IntervalSeconds: 60, Owner: "bob"})
+	if err != nil {
+		t.Fatalf("Expected other owners to be unaffected, got %v", err)
+	}
+	if watchlist, _ := store.GetWatchlist(ctx, id); watchlist.Owner != "bob" {
+		t.Errorf("Expected the owner to be stored, got %+v", watchlist)
+	}
+}
+
+func TestWatchlistValidate(t *testing.T) {
+	tests := []struct {
+		watchlist Watchlist
+		valid     bool
+	}{
+		{Watchlist{Targets: []string{"https://dapp.example"}, IntervalSeconds: 60}, true},
+		{Watchlist{IntervalSeconds: 60}, false},
+		{Watchlist{Targets: []string{"dapp.example"}, IntervalSeconds: 60}, false},
+		{Watchlist{Targets: []string{"https://dapp.example"}, IntervalSeconds: 59}, false},
+	}
+	for _, test := range tests {
+		if err := test.watchlist.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid=%v", test.watchlist, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	EventAddressesAdded   = "addresses_added"
+	EventAddressesRemoved = "addresses_removed"
+	EventAddressesMoved   = "addresses_moved"
+	EventTargetFailing    = "target_failing"
+	EventLookalikeFound   = "lookalike_found"
+	// EventPing is only sent on request, to test a webhook
+	EventPing = "ping"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+
+	defaultFailureThreshold = 3
+	maxFailureThreshold     = 10
+)
+
+// Events are the events a webhook can subscribe to
+var Events = []string{EventAddressesAdded, EventAddressesRemoved, EventAddressesMoved, EventTargetFailing, EventLookalikeFound}
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// Webhook subscribes a URL to the events raised by watchlist runs
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the payloads, it is never listed
+	Secret string `json:"-"`
+	// Events selects the events sent, all of them when empty
+	Events []string `json:"events"`
+	// WatchlistID limits the webhook to one watchlist when not zero
+	WatchlistID int64 `json:"watchlist_id,omitempty"`
+	// FailureThreshold is how many runs in a row a target must fail before
+	// target_failing is sent
+	FailureThreshold int       `json:"failure_threshold"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Validate checks the webhook and fills in the default failure threshold,
+// errors wrap ErrInvalidWebhook
+func (w *Webhook) Validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an http:// or https:// URL", ErrInvalidWebhook)
+	}
+	if w.Secret == "" {
+		return fmt.Errorf("%w: a secret is required", ErrInvalidWebhook)
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("%w: unknown event %q, expected one of %v", ErrInvalidWebhook, event, Events)
+		}
+	}
+	if w.FailureThreshold == 0 {
+		w.FailureThreshold = defaultFailureThreshold
+	}
+	if w.FailureThreshold < 1 || w.FailureThreshold > maxFailureThreshold {
+		return fmt.Errorf("%w: failure_threshold must be between 1 and %d", ErrInvalidWebhook, maxFailureThreshold)
+	}
+	return nil
+}
+
+// Wants reports whether the webhook subscribes to event raised by a run of watchlistID
+func (w *Webhook) Wants(event string, watchlistID int64) bool {
+	if w.WatchlistID != 0 && w.WatchlistID != watchlistID {
+		return false
+	}
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// Delivery is one event sent to a webhook, with the outcome of its last attempt
+type Delivery struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// StatusCode and Error describe the last attempt
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
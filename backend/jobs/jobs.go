@@ -0,0 +1,249 @@
+package jobs
+
+import (
+	"backend/core"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusCanceled Status = "canceled"
+)
+
+var (
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrNotFound    = errors.New("job not found")
+	ErrNotFinished = errors.New("job has not finished yet")
+	ErrFinished    = errors.New("job has already finished")
+)
+
+type Progress struct {
+	TargetsTotal  int `json:"targets_total"`
+	TargetsDone   int `json:"targets_done"`
+	TargetsFailed int `json:"targets_failed"`
+	Addresses     int `json:"addresses"`
+}
+
+// Snapshot is a point-in-time copy of a job that is safe to serialize
+type Snapshot struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Targets    []string   `json:"targets"`
+	Progress   Progress   `json:"progress"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Partial is set when the job was cancelled or ran out of time before
+	// every target finished
+	Partial bool `json:"partial"`
+}
+
+type job struct {
+	mutex    sync.Mutex
+	snapshot Snapshot
+	opts     core.Options
+	result   core.ScrapeResult
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+type Manager struct {
+	// OnFinished, when set, is called with every job that ran once it has
+	// finished. Set it before submitting jobs.
+	OnFinished func(snapshot Snapshot, result core.ScrapeResult)
+
+	jobs       map[string]*job
+	queue      chan *job
+	mutex      sync.RWMutex
+	maxRuntime time.Duration
+	retention  time.Duration
+}
+
+// NewManager starts workers goroutines that pull jobs off a queue holding at
+// most queueSize pending jobs. Each job is cancelled after maxRuntime.
+func NewManager(workers, queueSize int, maxRuntime time.Duration) *Manager {
+	m := &Manager{
+		jobs:       make(map[string]*job),
+		queue:      make(chan *job, queueSize),
+		maxRuntime: maxRuntime,
+		retention:  1 * time.Hour,
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	go func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			m.cleanup()
+		}
+	}()
+	return m
+}
+
+// Submit queues a scrape of targets. If opts has an Observer it is called in
+// addition to the progress tracking of the manager.
+func (m *Manager) Submit(targets []string, opts core.Options) (Snapshot, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		snapshot: Snapshot{
+			ID:        newID(),
+			Status:    StatusQueued,
+			Targets:   targets,
+			Progress:  Progress{TargetsTotal: len(targets)},
+			CreatedAt: time.Now(),
+		},
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return Snapshot{}, ErrQueueFull
+	}
+	m.jobs[j.snapshot.ID] = j
+	return j.snapshot, nil
+}
+
+func (m *Manager) Get(id string) (Snapshot, error) {
+	j, ok := m.lookup(id)
+	if !ok {
+		return Snapshot{}, ErrNotFound
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.snapshot, nil
+}
+
+// Results returns the scrape result of a finished or cancelled job. A
+// cancelled job returns whatever was gathered before it was stopped.
+func (m *Manager) Results(id string) (Snapshot, core.ScrapeResult, error) {
+	j, ok := m.lookup(id)
+	if !ok {
+		return Snapshot{}, core.ScrapeResult{}, ErrNotFound
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.snapshot.FinishedAt == nil {
+		return j.snapshot, core.ScrapeResult{}, ErrNotFinished
+	}
+	return j.snapshot, j.result, nil
+}
+
+// Cancel stops a queued or running job, in-flight fetches are aborted. A
+// job that already finished returns ErrFinished.
+func (m *Manager) Cancel(id string) (Snapshot, error) {
+	j, ok := m.lookup(id)
+	if !ok {
+		return Snapshot{}, ErrNotFound
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.snapshot.FinishedAt != nil {
+		return j.snapshot, ErrFinished
+	}
+	j.snapshot.Status = StatusCanceled
+	j.cancel()
+	return j.snapshot, nil
+}
+
+func (m *Manager) lookup(id string) (*job, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+func (m *Manager) worker() {
+	for j := range m.queue {
+		m.run(j)
+	}
+}
+
+func (m *Manager) run(j *job) {
+	j.mutex.Lock()
+	if j.ctx.Err() != nil {
+		now := time.Now()
+		j.snapshot.FinishedAt = &now
+		j.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	j.snapshot.Status = StatusRunning
+	j.snapshot.StartedAt = &now
+	j.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(j.ctx, m.maxRuntime)
+	defer cancel()
+
+	opts := j.opts
+	observer := opts.Observer
+	opts.Observer = func(event core.Event) {
+		if observer != nil {
+			observer(event)
+		}
+		if event.Type != core.EventTargetFinished {
+			return
+		}
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		j.snapshot.Progress.TargetsDone++
+		if event.Report.Status != core.StatusOK {
+			j.snapshot.Progress.TargetsFailed++
+		}
+		j.snapshot.Progress.Addresses += event.Report.Addresses
+	}
+
+	result := core.ScrapeContext(ctx, j.snapshot.Targets, opts)
+
+	j.mutex.Lock()
+	finished := time.Now()
+	j.result = result
+	j.snapshot.FinishedAt = &finished
+	j.snapshot.Partial = result.Partial
+	if j.snapshot.Status != StatusCanceled {
+		j.snapshot.Status = StatusDone
+	}
+	j.cancel()
+	snapshot := j.snapshot
+	j.mutex.Unlock()
+
+	if m.OnFinished != nil {
+		m.OnFinished(snapshot, result)
+	}
+}
+
+// Function to drop finished jobs once they are older than the retention period
+func (m *Manager) cleanup() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, j := range m.jobs {
+		j.mutex.Lock()
+		expired := j.snapshot.FinishedAt != nil && time.Since(*j.snapshot.FinishedAt) > m.retention
+		j.mutex.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"backend/core"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, m *Manager, id string, done func(Snapshot) bool) Snapshot {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		snapshot, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if done(snapshot) {
+			return snapshot
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for job %s", id)
+	return Snapshot{}
+}
+
+func TestJobCompletes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0x1111111111111111111111111111111111111111")
+	}))
+	defer server.Close()
+
+	m := NewManager(1, 10, time.Minute)
+	finished := make(chan core.ScrapeResult, 1)
+	m.OnFinished = func(snapshot Snapshot, result core.ScrapeResult) {
+		finished <- result
+	}
+	job, err := m.Submit([]string{server.URL + "/jobs-complete"}, core.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Status != StatusQueued {
+		t.Errorf("Expected queued job, got %s", job.Status)
+	}
+
+	job = waitFor(t, m, job.ID, func(s Snapshot) bool { return s.FinishedAt != nil })
+	if job.Status != StatusDone {
+		t.Errorf("Expected done job, got %s", job.Status)
+	}
+	if job.Progress.TargetsDone != 1 || job.Progress.Addresses != 1 {
+		t.Errorf("Unexpected progress: %+v", job.Progress)
+	}
+	if job.Partial {
+		t.Error("Expected a complete job not to be partial")
+	}
+	if _, err := m.Cancel(job.ID); err != ErrFinished {
+		t.Errorf("Expected ErrFinished, got %v", err)
+	}
+
+	_, result, err := m.Results(job.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(result.Results))
+	}
+	if result := <-finished; len(result.Results) != 1 {
+		t.Errorf("Expected OnFinished to receive the result, got %+v", result)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	m := NewManager(1, 10, time.Minute)
+	job, err := m.Submit([]string{server.URL + "/jobs-cancel"}, core.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, m, job.ID, func(s Snapshot) bool { return s.Status == StatusRunning })
+
+	if _, _, err := m.Results(job.ID); err != ErrNotFinished {
+		t.Errorf("Expected ErrNotFinished, got %v", err)
+	}
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job = waitFor(t, m, job.ID, func(s Snapshot) bool { return s.FinishedAt != nil })
+	if job.Status != StatusCanceled {
+		t.Errorf("Expected canceled job, got %s", job.Status)
+	}
+	if job.Progress.TargetsFailed != 1 || !job.Partial {
+		t.Errorf("Expected the in-flight target to fail, got %+v", job)
+	}
+}
+
+func TestJobRunsOutOfTime(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	m := NewManager(1, 10, 50*time.Millisecond)
+	job, err := m.Submit([]string{server.URL + "/jobs-timeout"}, core.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job = waitFor(t, m, job.ID, func(s Snapshot) bool { return s.FinishedAt != nil })
+	if job.Status != StatusDone || !job.Partial {
+		t.Errorf("Expected a partial job, got %+v", job)
+	}
+}
+
+func TestUnknownJob(t *testing.T) {
+	m := NewManager(1, 10, time.Minute)
+	if _, err := m.Get("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := m.Cancel("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
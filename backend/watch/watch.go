@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"backend/core"
+	"backend/history"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// baselineRuns is how many earlier runs are searched for a successful
+	// scrape of each target
+	baselineRuns = 10
+	// runTimeout bounds a single run of a watchlist
+	runTimeout = 5 * time.Minute
+)
+
+var ErrAlreadyRunning = errors.New("watchlist is already running")
+
+// Scheduler re-scrapes the watchlists of a history store when they are due
+// and stores the diff of each run
+type Scheduler struct {
+	// OnDiff, when set, is called with every diff once it has been stored.
+	// Set it before calling Start.
+	OnDiff func(watchlist history.Watchlist, diff history.Diff)
+	// Trusted addresses are compared with the findings of every run, along
+	// with the addresses seen on each target before
+	Trusted []string
+
+	store   history.Store
+	scrape  func(ctx context.Context, targets []string, opts core.Options) core.ScrapeResult
+	mutex   sync.Mutex
+	running map[int64]bool
+}
+
+func NewScheduler(store history.Store) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		scrape:  core.ScrapeContext,
+		running: make(map[int64]bool),
+	}
+}
+
+// Start checks for due watchlists every tick until ctx is done. Due
+// watchlists are run one after another.
+func (s *Scheduler) Start(ctx context.Context, tick time.Duration) {
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			s.runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Function to run every watchlist that is due, failures are only logged
+func (s *Scheduler) runDue(ctx context.Context) {
+	watchlists, err := s.store.Watchlists(ctx)
+	if err != nil {
+		log.Printf("Error listing watchlists: %v", err)
+		return
+	}
+	for _, watchlist := range watchlists {
+		if ctx.Err() != nil {
+			return
+		}
+		if !watchlist.Due(time.Now()) {
+			continue
+		}
+		if _, err := s.Run(ctx, watchlist.ID); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+			log.Printf("Error running watchlist %d: %v", watchlist.ID, err)
+		}
+	}
+}
+
+// Run scrapes the targets of a watchlist now, stores the run and its diff
+// against the earlier runs and returns the diff
+func (s *Scheduler) Run(ctx context.Context, id int64) (*history.Diff, error) {
+	s.mutex.Lock()
+	if s.running[id] {
+		s.mutex.Unlock()
+		return nil, ErrAlreadyRunning
+	}
+	s.running[id] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.running, id)
+		s.mutex.Unlock()
+	}()
+
+	watchlist, err := s.store.GetWatchlist(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.previousRuns(ctx, watchlist.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	scrapeCtx, cancel := context.WithTimeout(ctx, runTimeout)
+	startedAt := time.Now()
+	// Cached results would hide changes made since they were stored
+	result := s.scrape(scrapeCtx, watchlist.Targets, core.Options{
+		Fresh:          true,
+		Trusted:        s.Trusted,
+		KnownAddresses: history.KnownAddresses(s.store),
+	})
+	cancel()
+	finishedAt := time.Now()
+
+	run := history.NewRun(history.SourceWatch, startedAt, finishedAt, result)
+	if _, err := s.store.SaveRun(ctx, run); err != nil {
+		return nil, err
+	}
+	diff := history.DiffRuns(previous, run)
+	diff.WatchlistID = watchlist.ID
+	diff.CreatedAt = finishedAt
+	if _, err := s.store.SaveDiff(ctx, &diff); err != nil {
+		return nil, err
+	}
+	if s.OnDiff != nil {
+		s.OnDiff(*watchlist, diff)
+	}
+	return &diff, nil
+}
+
+// Function to load the latest runs of a watchlist, newest first
+func (s *Scheduler) previousRuns(ctx context.Context, watchlistID int64) ([]*history.Run, error) {
+	diffs, err := s.store.Diffs(ctx, watchlistID, history.DiffFilter{Limit: baselineRuns})
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*history.Run, 0, len(diffs))
+	for _, diff := range diffs {
+		run, err := s.store.GetRun(ctx, diff.RunID)
+		if errors.Is(err, history.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,170 @@
+package watch
+
+import (
+	"backend/core"
+	"backend/history"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	treasury = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	donation = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	// lookalike shares the first and last four characters of donation
+	lookalike = "0xbbbb00000000000000000000000000000000bbbb"
+)
+
+func TestRunDiffsAgainstPreviousRun(t *testing.T) {
+	var mutex sync.Mutex
+	script := "/app.js"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Path {
+		case "/":
+			if script == "/app.js" {
+				fmt.Fprintf(w, `<p>Donate to %s</p><script src="%s"></script>`, donation, script)
+			} else {
+				fmt.Fprintf(w, `<p>Donate to %s</p><script src="%s"></script>`, lookalike, script)
+			}
+		case script:
+			fmt.Fprintf(w, `const treasury = "%s";`, treasury)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store, err := history.OpenSQLite(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	id, err := store.CreateWatchlist(ctx, &history.Watchlist{Name: "dapp", Targets: []string{server.URL + "/"}, IntervalSeconds: 60})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	scheduler := NewScheduler(store)
+	notified := make(chan history.Diff, 2)
+	scheduler.OnDiff = func(watchlist history.Watchlist, diff history.Diff) {
+		notified <- diff
+	}
+
+	baseline, err := scheduler.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if baseline.Changed() || baseline.PreviousRunID != 0 {
+		t.Errorf("Expected the first run to be a baseline, got %+v", baseline)
+	}
+
+	// The donation address is swapped for a lookalike and the treasury is loaded from another script
+	mutex.Lock()
+	script = "/app.v2.js"
+	mutex.Unlock()
+	diff, err := scheduler.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff.PreviousRunID != baseline.RunID {
+		t.Errorf("Unexpected diff: %+v", diff)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Address != lookalike || diff.Added[0].Severity != core.SeverityHigh || diff.Added[0].Lookalikes[0].Resembles != donation {
+		t.Errorf("Expected %s to be added as a lookalike of %s, got %+v", lookalike, donation, diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Address != donation {
+		t.Errorf("Expected %s to be removed, got %+v", donation, diff.Removed)
+	}
+	if len(diff.Moved) != 1 || diff.Moved[0].Address != treasury || diff.Moved[0].Sources[0] != server.URL+"/app.v2.js" {
+		t.Errorf("Expected %s to move to the new script, got %+v", treasury, diff.Moved)
+	}
+
+	if len(notified) != 2 {
+		t.Errorf("Expected OnDiff to be called for both runs, got %d calls", len(notified))
+	}
+	watchlist, _ := store.GetWatchlist(ctx, id)
+	if watchlist.LastRunID != diff.RunID || watchlist.Due(time.Now()) {
+		t.Errorf("Expected the watchlist to record its last run, got %+v", watchlist)
+	}
+	filter := history.DiffFilter{Changed: true}
+	filter.Validate()
+	if diffs, _ := store.Diffs(ctx, id, filter); len(diffs) != 1 || diffs[0].ID != diff.ID {
+		t.Errorf("Expected the diff with changes to be stored, got %+v", diffs)
+	}
+}
+
+func TestRunReportsHTTPErrorsAsFailing(t *testing.T) {
+	var mutex sync.Mutex
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if status != http.StatusOK {
+			http.Error(w, "Service Unavailable", status)
+			return
+		}
+		fmt.Fprintf(w, `<p>Donate to %s</p>`, donation)
+	}))
+	defer server.Close()
+	defer core.ResetBreaker(strings.TrimPrefix(server.URL, "http://"))
+
+	store, err := history.OpenSQLite(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	target := server.URL + "/"
+	id, err := store.CreateWatchlist(ctx, &history.Watchlist{Name: "dapp", Targets: []string{target}, IntervalSeconds: 60})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler := NewScheduler(store)
+	if _, err := scheduler.Run(ctx, id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The site serves a maintenance page
+	mutex.Lock()
+	status = http.StatusServiceUnavailable
+	mutex.Unlock()
+	diff, err := scheduler.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diff.Failing) != 1 || diff.Failing[0].Target != target || diff.Failing[0].ErrorCategory != string(core.ErrorHTTPStatus) {
+		t.Errorf("Expected the target to be failing, got %+v", diff.Failing)
+	}
+	if len(diff.Skipped) != 1 || diff.Skipped[0] != target || len(diff.Removed) != 0 {
+		t.Errorf("Expected the target to be skipped rather than lose its addresses, got %+v", diff)
+	}
+
+	// Once it recovers it is compared with the last successful run
+	mutex.Lock()
+	status = http.StatusOK
+	mutex.Unlock()
+	diff, err = scheduler.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff.Changed() {
+		t.Errorf("Expected no change after recovering, got %+v", diff)
+	}
+}
+
+func TestRunRejectsConcurrentRuns(t *testing.T) {
+	scheduler := NewScheduler(nil)
+	scheduler.running[1] = true
+	if _, err := scheduler.Run(context.Background(), 1); err != ErrAlreadyRunning {
+		t.Errorf("Expected ErrAlreadyRunning, got %v", err)
+	}
+}
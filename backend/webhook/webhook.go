@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"backend/core"
+	"backend/history"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256 of t.body>"
+	SignatureHeader = "X-Scraper-Signature"
+	EventHeader     = "X-Scraper-Event"
+	DeliveryHeader  = "X-Scraper-Delivery"
+
+	maxConcurrentDeliveries = 4
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature timestamp is too old")
+)
+
+// WatchlistRef identifies the watchlist an event was raised by
+type WatchlistRef struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	Event string `json:"event"`
+	// Severity is high for lookalike_found
+	Severity  string        `json:"severity,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Watchlist *WatchlistRef `json:"watchlist,omitempty"`
+	RunID     int64         `json:"run_id,omitempty"`
+	DiffID    int64         `json:"diff_id,omitempty"`
+	// Changes are the added, removed or moved addresses, depending on the event
+	Changes []history.AddressChange `json:"changes,omitempty"`
+	// Failures are the targets that reached the failure threshold
+	Failures []history.TargetFailure `json:"failures,omitempty"`
+}
+
+// Sign returns the value of SignatureHeader for body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify checks a SignatureHeader value against body, rejecting signatures
+// older than tolerance to limit replays
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+	_, expected, _ := strings.Cut(Sign(secret, timestamp, body), "v1=")
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	if time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// Dispatcher sends the events raised by watchlist runs to the webhooks of a
+// history store and logs every delivery there
+type Dispatcher struct {
+	Client *http.Client
+	// Backoff are the delays before each retry, a delivery is attempted at
+	// most len(Backoff)+1 times
+	Backoff []time.Duration
+
+	store history.Store
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func NewDispatcher(store history.Store) *Dispatcher {
+	return &Dispatcher{
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Backoff: []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute},
+		store:   store,
+		slots:   make(chan struct{}, maxConcurrentDeliveries),
+	}
+}
+
+// Notify delivers the events raised by diff to every webhook subscribed to
+// them, in the background. It fits watch.Scheduler.OnDiff.
+func (d *Dispatcher) Notify(watchlist history.Watchlist, diff history.Diff) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	webhooks, err := d.store.Webhooks(ctx)
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		return
+	}
+
+	ref := &WatchlistRef{ID: watchlist.ID, Name: watchlist.Name}
+	for _, webhook := range webhooks {
+		for _, payload := range events(webhook, diff) {
+			if !webhook.Wants(payload.Event, watchlist.ID) {
+				continue
+			}
+			payload.Watchlist, payload.RunID, payload.DiffID, payload.CreatedAt = ref, diff.RunID, diff.ID, diff.CreatedAt
+			d.wg.Add(1)
+			go func(webhook history.Webhook, payload Payload) {
+				defer d.wg.Done()
+				d.slots <- struct{}{}
+				defer func() { <-d.slots }()
+				if _, err := d.Deliver(context.Background(), webhook, payload); err != nil {
+					log.Printf("Error delivering %s to webhook %d: %v", payload.Event, webhook.ID, err)
+				}
+			}(webhook, payload)
+		}
+	}
+}
+
+// Function to list the events a diff raises for webhook
+func events(webhook history.Webhook, diff history.Diff) []Payload {
+	var payloads []Payload
+	if len(diff.Added) > 0 {
+		payloads = append(payloads, Payload{Event: history.EventAddressesAdded, Changes: diff.Added})
+	}
+	if len(diff.Removed) > 0 {
+		payloads = append(payloads, Payload{Event: history.EventAddressesRemoved, Changes: diff.Removed})
+	}
+	if len(diff.Moved) > 0 {
+		payloads = append(payloads, Payload{Event: history.EventAddressesMoved, Changes: diff.Moved})
+	}
+	var lookalikes []history.AddressChange
+	for _, change := range append(append([]history.AddressChange(nil), diff.Added...), diff.Moved...) {
+		if change.Severity == core.SeverityHigh {
+			lookalikes = append(lookalikes, change)
+		}
+	}
+	if len(lookalikes) > 0 {
+		payloads = append(payloads, Payload{Event: history.EventLookalikeFound, Severity: core.SeverityHigh, Changes: lookalikes})
+	}
+	// Sent once when the threshold is reached rather than on every failed run
+	var failures []history.TargetFailure
+	for _, failure := range diff.Failing {
+		if failure.ConsecutiveFailures == webhook.FailureThreshold {
+			failures = append(failures, failure)
+		}
+	}
+	if len(failures) > 0 {
+		payloads = append(payloads, Payload{Event: history.EventTargetFailing, Failures: failures})
+	}
+	return payloads
+}
+
+// Wait blocks until every delivery started by Notify has finished
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Deliver sends payload to webhook, retrying with backoff, and returns the
+// logged delivery. The error is that of the last attempt.
+func (d *Dispatcher) Deliver(ctx context.Context, webhook history.Webhook, payload Payload) (*history.Delivery, error) {
+	return d.deliver(ctx, webhook, payload, d.Backoff)
+}
+
+// Ping sends a ping event to webhook once, without retrying
+func (d *Dispatcher) Ping(ctx context.Context, webhook history.Webhook) (*history.Delivery, error) {
+	return d.deliver(ctx, webhook, Payload{Event: history.EventPing}, nil)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, webhook history.Webhook, payload Payload, backoff []time.Duration) (*history.Delivery, error) {
+	if payload.CreatedAt.IsZero() {
+		payload.CreatedAt = time.Now()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &history.Delivery{WebhookID: webhook.ID, Event: payload.Event, Payload: body, Status: history.DeliveryPending}
+	if err := d.store.SaveDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		statusCode, err := d.send(ctx, webhook, delivery)
+		delivery.Attempts++
+		delivery.StatusCode, delivery.Error = statusCode, ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		last := err == nil || !retryable(statusCode) || attempt >= len(backoff)
+		switch {
+		case err == nil:
+			delivery.Status = history.DeliveryDelivered
+		case last:
+			delivery.Status = history.DeliveryFailed
+		}
+		if saveErr := d.store.SaveDelivery(context.WithoutCancel(ctx), delivery); saveErr != nil {
+			log.Printf("Error logging delivery %d: %v", delivery.ID, saveErr)
+		}
+		if last {
+			return delivery, err
+		}
+
+		select {
+		case <-time.After(backoff[attempt]):
+		case <-ctx.Done():
+			delivery.Status = history.DeliveryFailed
+			d.store.SaveDelivery(context.WithoutCancel(ctx), delivery)
+			return delivery, ctx.Err()
+		}
+	}
+}
+
+// Function to make one attempt at a delivery, returning the response status
+func (d *Dispatcher) send(ctx context.Context, webhook history.Webhook, delivery *history.Delivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ethereum-address-scraper-webhook")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now().Unix(), delivery.Payload))
+
+	response, err := d.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// retryable reports whether an attempt that got statusCode is worth
+// repeating, 0 being a network error
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode >= 500 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"backend/core"
+	"backend/history"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const secret = "s3cr3t"
+
+// receiver records the payloads of the requests with a valid signature and
+// answers with the given status codes in turn, then 204
+type receiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests int
+	payloads []Payload
+	invalid  int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests++
+	if err := Verify(secret, req.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+		r.invalid++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var payload Payload
+	json.Unmarshal(body, &payload)
+	if payload.Event != req.Header.Get(EventHeader) || req.Header.Get(DeliveryHeader) == "" {
+		r.invalid++
+	}
+	r.payloads = append(r.payloads, payload)
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *history.SQLite) {
+	t.Helper()
+	store, err := history.OpenSQLite(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	dispatcher := NewDispatcher(store)
+	dispatcher.Backoff = []time.Duration{time.Millisecond, time.Millisecond}
+	return dispatcher, store
+}
+
+func createWebhook(t *testing.T, store history.Store, webhook *history.Webhook) history.Webhook {
+	t.Helper()
+	webhook.Secret = secret
+	if err := webhook.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.CreateWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return *webhook
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	now := time.Now().Unix()
+	header := Sign(secret, now, body)
+	if err := Verify(secret, header, body, time.Minute); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if err := Verify("other", header, body, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for another secret, got %v", err)
+	}
+	if err := Verify(secret, header, []byte(`{"event":"pong"}`), time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for another body, got %v", err)
+	}
+	if err := Verify(secret, Sign(secret, now-3600, body), body, time.Minute); err != ErrSignatureExpired {
+		t.Errorf("Expected ErrSignatureExpired, got %v", err)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	dispatcher, store := newTestDispatcher(t)
+	ctx := context.Background()
+
+	retried := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	server := httptest.NewServer(retried)
+	defer server.Close()
+	webhook := createWebhook(t, store, &history.Webhook{URL: server.URL})
+
+	delivery, err := dispatcher.Deliver(ctx, webhook, Payload{Event: history.EventAddressesAdded})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if delivery.Status != history.DeliveryDelivered || delivery.Attempts != 3 || delivery.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected delivery on the third attempt, got %+v", delivery)
+	}
+	if retried.invalid != 0 {
+		t.Errorf("Expected every request to be signed, got %d invalid", retried.invalid)
+	}
+
+	// Client errors other than 408 and 429 are not retried
+	rejected := &receiver{statuses: []int{http.StatusGone}}
+	server = httptest.NewServer(rejected)
+	defer server.Close()
+	webhook = createWebhook(t, store, &history.Webhook{URL: server.URL})
+	if delivery, err = dispatcher.Deliver(ctx, webhook, Payload{Event: history.EventAddressesAdded}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if delivery.Status != history.DeliveryFailed || delivery.Attempts != 1 || delivery.StatusCode != http.StatusGone {
+		t.Errorf("Expected a single failed attempt, got %+v", delivery)
+	}
+
+	deliveries, err := store.Deliveries(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != history.DeliveryFailed || deliveries[0].Error == "" {
+		t.Errorf("Expected the failed delivery to be logged, got %+v", deliveries)
+	}
+}
+
+func TestNotifyFiltersEvents(t *testing.T) {
+	dispatcher, store := newTestDispatcher(t)
+
+	all := &receiver{}
+	allServer := httptest.NewServer(all)
+	defer allServer.Close()
+	createWebhook(t, store, &history.Webhook{URL: allServer.URL, FailureThreshold: 2})
+
+	removedOnly := &receiver{}
+	removedServer := httptest.NewServer(removedOnly)
+	defer removedServer.Close()
+	createWebhook(t, store, &history.Webhook{URL: removedServer.URL, Events: []string{history.EventAddressesRemoved}})
+
+	otherWatchlist := &receiver{}
+	otherServer := httptest.NewServer(otherWatchlist)
+	defer otherServer.Close()
+	createWebhook(t, store, &history.Webhook{URL: otherServer.URL, WatchlistID: 2})
+
+	change := history.AddressChange{Target: "https://dapp.example", Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	flagged := history.AddressChange{Target: "https://dapp.example", Address: "0xaaaa00000000000000000000000000000000aaaa", Severity: core.SeverityHigh}
+	diff := history.Diff{
+		ID: 5, RunID: 9, CreatedAt: time.Now(),
+		Added:   []history.AddressChange{change, flagged},
+		Removed: []history.AddressChange{change},
+		Failing: []history.TargetFailure{
+			{Target: "https://down.example", ConsecutiveFailures: 2},
+			{Target: "https://flaky.example", ConsecutiveFailures: 1},
+		},
+	}
+	dispatcher.Notify(history.Watchlist{ID: 1, Name: "dapp"}, diff)
+	dispatcher.Wait()
+
+	if len(all.payloads) != 4 {
+		t.Fatalf("Expected added, removed, lookalike_found and target_failing, got %+v", all.payloads)
+	}
+	for _, payload := range all.payloads {
+		if payload.Watchlist == nil || payload.Watchlist.Name != "dapp" || payload.RunID != 9 || payload.DiffID != 5 {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+		if payload.Event == history.EventTargetFailing && (len(payload.Failures) != 1 || payload.Failures[0].Target != "https://down.example") {
+			t.Errorf("Expected only the target at the failure threshold, got %+v", payload.Failures)
+		}
+		if payload.Event == history.EventLookalikeFound && (payload.Severity != core.SeverityHigh || len(payload.Changes) != 1 || payload.Changes[0].Address != flagged.Address) {
+			t.Errorf("Expected only the flagged address, got %+v", payload)
+		}
+	}
+	if len(removedOnly.payloads) != 1 || removedOnly.payloads[0].Event != history.EventAddressesRemoved {
+		t.Errorf("Expected only the removed event, got %+v", removedOnly.payloads)
+	}
+	if otherWatchlist.requests != 0 {
+		t.Errorf("Expected no event for a webhook of another watchlist, got %d", otherWatchlist.requests)
+	}
+}